@@ -61,7 +61,8 @@ emerge \
     dev-vcs/mercurial \
     sys-devel/bc \
     sys-apps/hwids \
-    sys-fs/eudev
+    sys-fs/eudev \
+    sys-libs/libseccomp
 
 # Rebuild util-linux so it has static libraries. First need to remove
 # mount/umount to avoid Gentoo errors about suspicious suid hardlinks.
@@ -5,9 +5,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/apcera/kurma/pkg/apiproxy"
 	"github.com/apcera/logray"
@@ -16,7 +18,14 @@ import (
 func main() {
 	logray.AddDefaultOutput("stdout://", logray.ALL)
 
+	requiredNamespaces := flag.String("required-namespaces", "",
+		"Comma separated list of namespaces, such as \"user,net\", that pods created remotely must use")
+	flag.Parse()
+
 	opts := &apiproxy.Options{}
+	if *requiredNamespaces != "" {
+		opts.RequiredNamespaces = strings.Split(*requiredNamespaces, ",")
+	}
 
 	s := apiproxy.New(opts)
 	if err := s.Start(); err != nil {
@@ -20,12 +20,14 @@ import (
 
 	"github.com/apcera/kurma/pkg/backend"
 	"github.com/apcera/kurma/pkg/capabilities"
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/daemon"
 	"github.com/apcera/kurma/pkg/devices"
 	"github.com/apcera/kurma/pkg/image"
 	"github.com/apcera/kurma/pkg/imagestore"
 	"github.com/apcera/kurma/pkg/networkmanager"
 	"github.com/apcera/kurma/pkg/podmanager"
+	"github.com/apcera/kurma/pkg/trust"
 	"github.com/apcera/logray"
 	"github.com/apcera/util/proc"
 	"github.com/apcera/util/tarhelper"
@@ -380,6 +382,7 @@ func (r *runner) loadAvailableImages() error {
 		return fmt.Errorf("Failed to read available ACI images: %v", err)
 	}
 
+	hashes := make([]string, 0, len(files))
 	for _, fi := range files {
 		if filepath.Ext(fi.Name()) != ".aci" {
 			continue
@@ -393,10 +396,11 @@ func (r *runner) loadAvailableImages() error {
 			defer os.Remove(name)
 			defer f.Close()
 
-			_, _, err = r.imageManager.CreateImage(f)
+			hash, _, err := r.imageManager.CreateImage(f)
 			if err != nil {
 				return err
 			}
+			hashes = append(hashes, hash)
 			return nil
 		}(filepath.Join("/acis", fi.Name()))
 		if err != nil {
@@ -404,6 +408,9 @@ func (r *runner) loadAvailableImages() error {
 		}
 	}
 
+	// the bundled images back the services started by init, so keep them from
+	// being garbage collected
+	r.imageManager.AddReferences("available-images", hashes)
 	return nil
 }
 
@@ -581,12 +588,46 @@ func (r *runner) createImageManager() error {
 	iopts := &imagestore.Options{
 		Directory: filepath.Join(kurmaPath, string(kurmaPathImages)),
 		Log:       r.log.Clone(),
+		GC:        r.config.ImageGC,
+		Integrity: r.config.ImageIntegrity,
 	}
 	imageManager, err := imagestore.New(iopts)
 	if err != nil {
 		return fmt.Errorf("failed to create the image manager: %v", err)
 	}
 	r.imageManager = imageManager
+
+	trustStore, err := trust.New(trustedKeysPath)
+	if err != nil {
+		return fmt.Errorf("failed to create the trust store: %v", err)
+	}
+	for _, key := range r.config.TrustedKeys {
+		if _, err := trustStore.AddKeys(key.Prefix, strings.NewReader(key.Key)); err != nil {
+			return fmt.Errorf("failed to add trusted key for prefix %q: %v", key.Prefix, err)
+		}
+	}
+	r.trustStore = trustStore
+
+	creds, err := credentials.New(registryCredentialsPath)
+	if err != nil {
+		return fmt.Errorf("failed to create the registry credential store: %v", err)
+	}
+	for _, c := range r.config.RegistryCredentials {
+		if err := creds.Add(c); err != nil {
+			return fmt.Errorf("failed to add registry credentials: %v", err)
+		}
+	}
+	r.credentials = creds
+
+	// images are fetched through a single coordinator, which verifies their
+	// signatures when they are required
+	fopts := &image.FetchOptions{
+		Insecure:          !r.config.RequireImageSignatures,
+		TrustStore:        r.trustStore,
+		Credentials:       r.credentials,
+		DownloadDirectory: downloadsPath,
+	}
+	r.fetcher = image.NewCoordinator(fopts, r.imageManager)
 	return nil
 }
 
@@ -597,10 +638,11 @@ func (r *runner) createPodManager() error {
 	if r.config.DefaultStagerImage == "" {
 		return fmt.Errorf("a defaultStagerImage setting must be specified")
 	}
-	stagerHash, _, err := image.FetchAndLoad(r.config.DefaultStagerImage, nil, true, r.imageManager)
+	stagerHash, _, err := r.fetcher.FetchAndLoad(r.config.DefaultStagerImage)
 	if err != nil {
 		return fmt.Errorf("failed to fetch default stager image %q: %v", r.config.DefaultStagerImage, err)
 	}
+	r.imageManager.AddReferences("default-stager", []string{stagerHash})
 
 	mopts := &podmanager.Options{
 		PodDirectory:          filepath.Join(kurmaPath, string(kurmaPathPods)),
@@ -609,6 +651,9 @@ func (r *runner) createPodManager() error {
 		ParentCgroupName:      r.config.ParentCgroupName,
 		DefaultStagerHash:     stagerHash,
 		Log:                   r.log.Clone(),
+		LogRotation:           r.config.PodLogRotation,
+		UserNamespaces:        r.config.UserNamespaces,
+		AllowedHostVolumes:    r.config.AllowedHostVolumes,
 	}
 	m, err := podmanager.NewManager(r.imageManager, nil, mopts)
 	if err != nil {
@@ -636,7 +681,7 @@ func (r *runner) createNetworkManager() error {
 	networkDrivers := make([]*backend.NetworkDriver, 0, len(r.config.PodNetworks))
 
 	for _, podNet := range r.config.PodNetworks {
-		hash, _, err := image.FetchAndLoad(podNet.ACI, nil, true, r.imageManager)
+		hash, _, err := r.fetcher.FetchAndLoad(podNet.ACI)
 		if err != nil {
 			r.log.Warnf("Failed to load image for network %q: %v", podNet.Name, err)
 			continue
@@ -714,6 +759,9 @@ func (r *runner) startServer() error {
 	opts := &daemon.Options{
 		ImageManager:      r.imageManager,
 		PodManager:        r.podManager,
+		TrustStore:        r.trustStore,
+		CredentialStore:   r.credentials,
+		ImageFetcher:      r.fetcher,
 		SocketFile:        filepath.Join(kurmaPath, "socket"),
 		SocketPermissions: &perms,
 		SocketGroup:       &group,
@@ -731,7 +779,7 @@ func (r *runner) startServer() error {
 // configuration.
 func (r *runner) startInitialPods() error {
 	for d, ip := range r.config.InitialPods {
-		name, podManifest, err := ip.Process(r.imageManager)
+		name, podManifest, err := ip.Process(r.imageManager, r.fetcher)
 		if name == "" {
 			name = fmt.Sprintf("pod%d", d+1)
 		}
@@ -740,7 +788,8 @@ func (r *runner) startInitialPods() error {
 			continue
 		}
 
-		pod, err := r.podManager.Create(name, podManifest, nil)
+		options := &backend.PodOptions{RestartPolicy: ip.RestartPolicy()}
+		pod, err := r.podManager.Create(name, podManifest, options)
 		if err != nil {
 			r.log.Errorf("Failed to launch pod %q: %v", name, err)
 			continue
@@ -767,7 +816,7 @@ func (r *runner) startConsole() error {
 	}
 
 	// Get the pod manifest
-	_, podManifest, err := r.config.Console.Process(r.imageManager)
+	_, podManifest, err := r.config.Console.Process(r.imageManager, r.fetcher)
 	if err != nil {
 		r.log.Warnf("Failed to fetch console pod: %v", err)
 		return nil
@@ -800,7 +849,11 @@ func (r *runner) startConsole() error {
 		podManifest.Apps[i] = runtimeApp
 	}
 
-	if _, err := r.podManager.Create("console", podManifest, nil); err != nil {
+	// The console should always be available, so restart it if it exits.
+	options := &backend.PodOptions{
+		RestartPolicy: &kschema.RestartPolicy{Policy: kschema.RestartAlways},
+	}
+	if _, err := r.podManager.Create("console", podManifest, options); err != nil {
 		return fmt.Errorf("Failed to start console: %v", err)
 	}
 	r.log.Debug("Started console")
@@ -841,14 +894,18 @@ func (r *runner) setupDiscoveryProxy() error {
 // prefetchImages is used to fetch specified images on start up to pre-load
 // them.
 func (r *runner) prefetchImages() error {
+	hashes := make([]string, 0, len(r.config.PrefetchImages))
 	for _, aci := range r.config.PrefetchImages {
-		// TODO: configurable `insecure` option
-		_, _, err := image.FetchAndLoad(aci, nil, true, r.imageManager)
+		hash, _, err := r.fetcher.FetchAndLoad(aci)
 		if err != nil {
 			r.log.Warnf("Failed to fetch image %q: %v", aci, err)
 			continue
 		}
+		hashes = append(hashes, hash)
 		r.log.Debugf("Fetched image %s", aci)
 	}
+
+	// keep the prefetched images from being garbage collected
+	r.imageManager.AddReferences("prefetch-images", hashes)
 	return nil
 }
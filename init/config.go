@@ -7,25 +7,43 @@ import (
 
 	"github.com/apcera/kurma/kurmad"
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/apcera/kurma/pkg/logrotate"
 	"github.com/apcera/kurma/pkg/networkmanager/types"
+	"github.com/apcera/kurma/pkg/podmanager"
 	"github.com/appc/spec/schema"
 )
 
 type kurmaConfig struct {
-	Debug              bool                         `json:"debug,omitempty"`
-	SuccessfulBoot     *string                      `json:"-"`
-	OEMConfig          *OEMConfig                   `json:"oemConfig"`
-	Datasources        []string                     `json:"datasources,omitempty"`
-	Hostname           string                       `json:"hostname,omitempty"`
-	NetworkConfig      kurmaNetworkConfig           `json:"networkConfig,omitempty"`
-	Modules            []string                     `json:"modules,omitmepty"`
-	Disks              []*kurmaDiskConfiguration    `json:"disks,omitempty"`
-	ParentCgroupName   string                       `json:"parentCgroupName,omitempty"`
-	DefaultStagerImage string                       `json:"defaultStagerImage,omitempty"`
-	PrefetchImages     []string                     `json:"prefetchImages,omitempty"`
-	InitialPods        []*kurmad.InitialPodManifest `json:"initialPods,omitempty"`
-	PodNetworks        []*types.NetConf             `json:"podNetworks,omitempty"`
-	Console            kurmaConsoleService          `json:"console,omitempty"`
+	Debug                  bool                             `json:"debug,omitempty"`
+	SuccessfulBoot         *string                          `json:"-"`
+	OEMConfig              *OEMConfig                       `json:"oemConfig"`
+	Datasources            []string                         `json:"datasources,omitempty"`
+	Hostname               string                           `json:"hostname,omitempty"`
+	NetworkConfig          kurmaNetworkConfig               `json:"networkConfig,omitempty"`
+	Modules                []string                         `json:"modules,omitmepty"`
+	Disks                  []*kurmaDiskConfiguration        `json:"disks,omitempty"`
+	ParentCgroupName       string                           `json:"parentCgroupName,omitempty"`
+	DefaultStagerImage     string                           `json:"defaultStagerImage,omitempty"`
+	PrefetchImages         []string                         `json:"prefetchImages,omitempty"`
+	InitialPods            []*kurmad.InitialPodManifest     `json:"initialPods,omitempty"`
+	PodNetworks            []*types.NetConf                 `json:"podNetworks,omitempty"`
+	Console                kurmaConsoleService              `json:"console,omitempty"`
+	PodLogRotation         logrotate.Options                `json:"podLogRotation,omitempty"`
+	UserNamespaces         *podmanager.UserNamespaceOptions `json:"userNamespaces,omitempty"`
+	AllowedHostVolumes     []string                         `json:"allowedHostVolumes,omitempty"`
+	ImageGC                imagestore.GCOptions             `json:"imageGC,omitempty"`
+	ImageIntegrity         imagestore.IntegrityOptions      `json:"imageIntegrity,omitempty"`
+	RequireImageSignatures bool                             `json:"requireImageSignatures,omitempty"`
+	TrustedKeys            []*kurmaTrustedKey               `json:"trustedKeys,omitempty"`
+	RegistryCredentials    []*credentials.Credential        `json:"registryCredentials,omitempty"`
+}
+
+type kurmaTrustedKey struct {
+	Prefix string `json:"prefix,omitempty"`
+	Key    string `json:"key"`
 }
 
 type OEMConfig struct {
@@ -64,9 +82,12 @@ const (
 	kurmaPathPods    = kurmaPathUsage("pods")
 	kurmaPathVolumes = kurmaPathUsage("volumes")
 
-	kurmaPath      = "/var/kurma"
-	mountPath      = "/mnt"
-	systemPodsPath = "/var/kurma/system"
+	kurmaPath               = "/var/kurma"
+	mountPath               = "/mnt"
+	systemPodsPath          = "/var/kurma/system"
+	trustedKeysPath         = "/var/kurma/trustedkeys"
+	registryCredentialsPath = "/var/kurma/credentials.json"
+	downloadsPath           = "/var/kurma/downloads"
 )
 
 type kurmaConsoleService struct {
@@ -77,7 +98,7 @@ type kurmaConsoleService struct {
 	SSHKeys     []string                   `json:"sshKeys,omitempty"`
 }
 
-func (s *kurmaConsoleService) Process(imageManager backend.ImageManager) (string, *schema.PodManifest, error) {
+func (s *kurmaConsoleService) Process(imageManager backend.ImageManager, fetcher *image.Coordinator) (string, *schema.PodManifest, error) {
 	if s.ACI != nil && s.PodManifest != nil {
 		return "", nil, fmt.Errorf(`both "aci" and "podManifest" cannot be set at the same time`)
 	}
@@ -85,9 +106,9 @@ func (s *kurmaConsoleService) Process(imageManager backend.ImageManager) (string
 		return "", nil, fmt.Errorf(`must set either "aci" or "podManifest"`)
 	}
 	if s.ACI != nil {
-		return s.ACI.Process(imageManager)
+		return s.ACI.Process(imageManager, fetcher)
 	}
-	return s.PodManifest.Process(imageManager)
+	return s.PodManifest.Process(imageManager, fetcher)
 }
 
 func (cfg *kurmaConfig) mergeConfig(o *kurmaConfig) {
@@ -168,4 +189,42 @@ func (cfg *kurmaConfig) mergeConfig(o *kurmaConfig) {
 	if len(o.PodNetworks) > 0 {
 		cfg.PodNetworks = append(cfg.PodNetworks, o.PodNetworks...)
 	}
+
+	// pod log rotation
+	if o.PodLogRotation.Enabled() {
+		cfg.PodLogRotation = o.PodLogRotation
+	}
+
+	// user namespaces
+	if o.UserNamespaces.Enabled() {
+		cfg.UserNamespaces = o.UserNamespaces
+	}
+
+	// image garbage collection
+	if o.ImageGC.Enabled() {
+		cfg.ImageGC = o.ImageGC
+	}
+
+	// image integrity
+	if o.ImageIntegrity.Record {
+		cfg.ImageIntegrity = o.ImageIntegrity
+	}
+
+	// allowed host volumes
+	if len(o.AllowedHostVolumes) > 0 {
+		cfg.AllowedHostVolumes = append(cfg.AllowedHostVolumes, o.AllowedHostVolumes...)
+	}
+
+	// image signatures
+	if o.RequireImageSignatures {
+		cfg.RequireImageSignatures = true
+	}
+	if len(o.TrustedKeys) > 0 {
+		cfg.TrustedKeys = append(cfg.TrustedKeys, o.TrustedKeys...)
+	}
+
+	// registry credentials
+	if len(o.RegistryCredentials) > 0 {
+		cfg.RegistryCredentials = append(cfg.RegistryCredentials, o.RegistryCredentials...)
+	}
 }
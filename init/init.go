@@ -6,6 +6,9 @@ import (
 	"fmt"
 
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/trust"
 	"github.com/apcera/logray"
 )
 
@@ -18,6 +21,9 @@ type runner struct {
 	podManager     backend.PodManager
 	imageManager   backend.ImageManager
 	networkManager backend.NetworkManager
+	trustStore     *trust.Store
+	credentials    *credentials.Store
+	fetcher        *image.Coordinator
 }
 
 // Run takes over the process and launches KurmaOS.
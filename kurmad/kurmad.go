@@ -8,11 +8,16 @@ import (
 	"strings"
 
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/apcera/kurma/pkg/logrotate"
 	"github.com/apcera/kurma/pkg/networkmanager/types"
+	"github.com/apcera/kurma/pkg/podmanager"
 	"github.com/apcera/logray"
 	"github.com/appc/spec/schema"
 
+	kschema "github.com/apcera/kurma/schema"
 	atypes "github.com/appc/spec/schema/types"
 )
 
@@ -46,6 +51,28 @@ type Config struct {
 	// will use for the volume mounts.
 	VolumesDirectory string `json:"volumesDirectory,omitempty"`
 
+	// DownloadsDirectory is the directory holding partially downloaded images,
+	// so downloads which are interrupted are resumed the next time the image
+	// is fetched. Partial downloads aren't kept when it is empty.
+	DownloadsDirectory string `json:"downloadsDirectory,omitempty"`
+
+	// TrustedKeysDirectory is the directory holding the public keys which are
+	// trusted to sign images.
+	TrustedKeysDirectory string `json:"trustedKeysDirectory,omitempty"`
+
+	// RegistryCredentialsFile is the file holding the credentials used to
+	// authenticate with the hosts images are retrieved from. Credentials
+	// added through the API are saved to it.
+	RegistryCredentialsFile string `json:"registryCredentialsFile,omitempty"`
+
+	// RegistryCredentials are credentials for the hosts images are retrieved
+	// from, which are added to those in the RegistryCredentialsFile.
+	RegistryCredentials []*credentials.Credential `json:"registryCredentials,omitempty"`
+
+	// RequireImageSignatures requires that images fetched by kurmad, including
+	// the stager and network plugins, are signed by a trusted key.
+	RequireImageSignatures bool `json:"requireImageSignatures,omitempty"`
+
 	// DefaultStagerImage is the uri of the default ACI image
 	// to be used for stager run when launching pods.
 	DefaultStagerImage string `json:"defaultStagerImage,omitempty"`
@@ -61,20 +88,53 @@ type Config struct {
 	// PodNetworks is the collection of networks which will be provisioned
 	// by the network manager for pods.
 	PodNetworks []*types.NetConf `json:"podNetworks"`
+
+	// KeepPodsOnShutdown leaves pods running when kurmad receives a shutdown
+	// signal. They will be recovered the next time kurmad starts, which allows
+	// kurmad to be upgraded without restarting every pod.
+	KeepPodsOnShutdown bool `json:"keepPodsOnShutdown,omitempty"`
+
+	// PodLogRotation configures the maximum size of the stager and app logs for
+	// pods, and how many rotated logs are kept.
+	PodLogRotation logrotate.Options `json:"podLogRotation,omitempty"`
+
+	// ImageGC configures the periodic removal of unused images when the images
+	// directory's filesystem runs low on space.
+	ImageGC imagestore.GCOptions `json:"imageGC,omitempty"`
+
+	// ImageIntegrity configures recording digests of the files within images
+	// and verifying them to detect corruption or tampering.
+	ImageIntegrity imagestore.IntegrityOptions `json:"imageIntegrity,omitempty"`
+
+	// AllowedHostVolumes is the list of host paths which pods may bind into
+	// their host volumes. Host volumes are rejected when it is empty.
+	AllowedHostVolumes []string `json:"allowedHostVolumes,omitempty"`
+
+	// UserNamespaces configures the ranges of host user and group IDs that pods
+	// are mapped into when run within a user namespace. Pods are not run in
+	// user namespaces when it isn't set.
+	UserNamespaces *podmanager.UserNamespaceOptions `json:"userNamespaces,omitempty"`
 }
 
 // InitialPodManifest is used to handle the initial pod configuration section,
 // where either an image specification string can be given, or a partial pod
 // manifest.
 type InitialPodManifest struct {
-	name  string
-	image string
-	pod   *schema.PodManifest
+	name          string
+	image         string
+	pod           *schema.PodManifest
+	restartPolicy *kschema.RestartPolicy
+}
+
+// RestartPolicy returns the restart policy configured for the pod, if any.
+func (ip *InitialPodManifest) RestartPolicy() *kschema.RestartPolicy {
+	return ip.restartPolicy
 }
 
 // process handles processing the initial configuration input and turning it
-// into a ready to run pod manifest.
-func (ip *InitialPodManifest) Process(imageManager backend.ImageManager) (string, *schema.PodManifest, error) {
+// into a ready to run pod manifest. Images which aren't already loaded are
+// fetched through the provided coordinator.
+func (ip *InitialPodManifest) Process(imageManager backend.ImageManager, fetcher *image.Coordinator) (string, *schema.PodManifest, error) {
 	if ip.pod != nil {
 		for i, app := range ip.pod.Apps {
 			if app.Image.ID.Val != "" {
@@ -106,7 +166,7 @@ func (ip *InitialPodManifest) Process(imageManager backend.ImageManager) (string
 	hash, imageManifest := imageManager.FindImage(ip.image, "")
 	if imageManifest == nil {
 		var err error
-		hash, imageManifest, err = image.FetchAndLoad(ip.image, nil, true, imageManager)
+		hash, imageManifest, err = fetcher.FetchAndLoad(ip.image)
 		if err != nil {
 			return ip.name, nil, fmt.Errorf("failed to get a retrieve image %q: %v", ip.image, err)
 		}
@@ -158,12 +218,17 @@ func (ip *InitialPodManifest) unmarshalImageUrl(b []byte) error {
 func (ip *InitialPodManifest) unmarshalPodManifest(b []byte) error {
 	// first unmarshal some extra fields
 	extra := struct {
-		Name string `json:"name"`
+		Name          string                 `json:"name"`
+		RestartPolicy *kschema.RestartPolicy `json:"restartPolicy"`
 	}{}
 	if err := json.Unmarshal(b, &extra); err != nil {
 		return err
 	}
+	if err := extra.RestartPolicy.AssertValid(); err != nil {
+		return err
+	}
 	ip.name = extra.Name
+	ip.restartPolicy = extra.RestartPolicy
 
 	// then unmarshal to the pod object
 	ip.pod = schema.BlankPodManifest()
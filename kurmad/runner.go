@@ -12,11 +12,13 @@ import (
 	"syscall"
 
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/daemon"
 	"github.com/apcera/kurma/pkg/image"
 	"github.com/apcera/kurma/pkg/imagestore"
 	"github.com/apcera/kurma/pkg/networkmanager"
 	"github.com/apcera/kurma/pkg/podmanager"
+	"github.com/apcera/kurma/pkg/trust"
 	"github.com/apcera/logray"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
@@ -46,6 +48,9 @@ type runner struct {
 	podManager     backend.PodManager
 	imageManager   backend.ImageManager
 	networkManager backend.NetworkManager
+	trustStore     *trust.Store
+	credentials    *credentials.Store
+	fetcher        *image.Coordinator
 }
 
 // setupSignalHandling sets up the callbacks for signals to cleanly shutdown.
@@ -59,7 +64,9 @@ func (r *runner) setupSignalHandling() {
 			switch sig {
 			case syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT:
 				r.log.Infof("Received %s. Shutting down.", sig.String())
-				if r.podManager != nil {
+				if r.config != nil && r.config.KeepPodsOnShutdown {
+					r.log.Info("Leaving pods running to be recovered on restart.")
+				} else if r.podManager != nil {
 					r.podManager.Shutdown()
 				}
 				r.log.Flush()
@@ -134,6 +141,15 @@ func (r *runner) createDirectories() error {
 	if !filepath.IsAbs(r.config.VolumesDirectory) {
 		r.config.VolumesDirectory = filepath.Join(wd, r.config.VolumesDirectory)
 	}
+	if r.config.DownloadsDirectory != "" && !filepath.IsAbs(r.config.DownloadsDirectory) {
+		r.config.DownloadsDirectory = filepath.Join(wd, r.config.DownloadsDirectory)
+	}
+	if r.config.TrustedKeysDirectory != "" && !filepath.IsAbs(r.config.TrustedKeysDirectory) {
+		r.config.TrustedKeysDirectory = filepath.Join(wd, r.config.TrustedKeysDirectory)
+	}
+	if r.config.RegistryCredentialsFile != "" && !filepath.IsAbs(r.config.RegistryCredentialsFile) {
+		r.config.RegistryCredentialsFile = filepath.Join(wd, r.config.RegistryCredentialsFile)
+	}
 
 	if err := os.MkdirAll(r.config.ImagesDirectory, os.FileMode(0755)); err != nil {
 		return fmt.Errorf("failed to create images directory: %v", err)
@@ -150,15 +166,19 @@ func (r *runner) createDirectories() error {
 // prefetchImages is used to fetch specified images on start up to pre-load
 // them.
 func (r *runner) prefetchImages() {
+	hashes := make([]string, 0, len(r.config.PrefetchImages))
 	for _, img := range r.config.PrefetchImages {
-		// TODO: configurable `insecure` option
-		_, _, err := image.FetchAndLoad(img, nil, true, r.imageManager)
+		hash, _, err := r.fetcher.FetchAndLoad(img)
 		if err != nil {
 			r.log.Warnf("Failed to fetch image %q: %v", img, err)
 			continue
 		}
+		hashes = append(hashes, hash)
 		r.log.Debugf("Fetched image %q", img)
 	}
+
+	// keep the prefetched images from being garbage collected
+	r.imageManager.AddReferences("prefetch-images", hashes)
 }
 
 // createImageManager creates the image manager that is used to store and
@@ -167,12 +187,45 @@ func (r *runner) createImageManager() error {
 	iopts := &imagestore.Options{
 		Directory: r.config.ImagesDirectory,
 		Log:       r.log.Clone(),
+		GC:        r.config.ImageGC,
+		Integrity: r.config.ImageIntegrity,
 	}
 	imageManager, err := imagestore.New(iopts)
 	if err != nil {
 		return fmt.Errorf("failed to create the image manager: %v", err)
 	}
 	r.imageManager = imageManager
+
+	creds, err := credentials.New(r.config.RegistryCredentialsFile)
+	if err != nil {
+		return fmt.Errorf("failed to create the registry credential store: %v", err)
+	}
+	for _, c := range r.config.RegistryCredentials {
+		if err := creds.Add(c); err != nil {
+			return fmt.Errorf("failed to add registry credentials: %v", err)
+		}
+	}
+	r.credentials = creds
+
+	if r.config.TrustedKeysDirectory != "" {
+		trustStore, err := trust.New(r.config.TrustedKeysDirectory)
+		if err != nil {
+			return fmt.Errorf("failed to create the trust store: %v", err)
+		}
+		r.trustStore = trustStore
+	} else if r.config.RequireImageSignatures {
+		return fmt.Errorf("a trustedKeysDirectory setting must be specified to require image signatures")
+	}
+
+	// images are fetched through a single coordinator, which verifies their
+	// signatures when they are required
+	fopts := &image.FetchOptions{
+		Insecure:          !r.config.RequireImageSignatures,
+		TrustStore:        r.trustStore,
+		Credentials:       r.credentials,
+		DownloadDirectory: r.config.DownloadsDirectory,
+	}
+	r.fetcher = image.NewCoordinator(fopts, r.imageManager)
 	return nil
 }
 
@@ -183,10 +236,11 @@ func (r *runner) createPodManager() error {
 	if r.config.DefaultStagerImage == "" {
 		return fmt.Errorf("a defaultStagerImage setting must be specified")
 	}
-	stagerHash, _, err := image.FetchAndLoad(r.config.DefaultStagerImage, nil, true, r.imageManager)
+	stagerHash, _, err := r.fetcher.FetchAndLoad(r.config.DefaultStagerImage)
 	if err != nil {
 		return fmt.Errorf("failed to fetch default stager image %q: %v", r.config.DefaultStagerImage, err)
 	}
+	r.imageManager.AddReferences("default-stager", []string{stagerHash})
 
 	mopts := &podmanager.Options{
 		PodDirectory:          r.config.PodsDirectory,
@@ -196,6 +250,9 @@ func (r *runner) createPodManager() error {
 		DefaultStagerHash:     stagerHash,
 		Log:                   r.log.Clone(),
 		Debug:                 r.config.Debug,
+		LogRotation:           r.config.PodLogRotation,
+		UserNamespaces:        r.config.UserNamespaces,
+		AllowedHostVolumes:    r.config.AllowedHostVolumes,
 	}
 	m, err := podmanager.NewManager(r.imageManager, nil, mopts)
 	if err != nil {
@@ -221,7 +278,7 @@ func (r *runner) createNetworkManager() {
 	networkDrivers := make([]*backend.NetworkDriver, 0, len(r.config.PodNetworks))
 
 	for _, podNet := range r.config.PodNetworks {
-		hash, _, err := image.FetchAndLoad(podNet.ACI, nil, true, r.imageManager)
+		hash, _, err := r.fetcher.FetchAndLoad(podNet.ACI)
 		if err != nil {
 			r.log.Warnf("Failed to load image for network %q: %v", podNet.Name, err)
 			continue
@@ -258,6 +315,9 @@ func (r *runner) startDaemon() error {
 	opts := &daemon.Options{
 		ImageManager:         r.imageManager,
 		PodManager:           r.podManager,
+		TrustStore:           r.trustStore,
+		CredentialStore:      r.credentials,
+		ImageFetcher:         r.fetcher,
 		SocketRemoveIfExists: true,
 		SocketFile:           r.config.SocketPath,
 		SocketPermissions:    &perms,
@@ -275,8 +335,14 @@ func (r *runner) startDaemon() error {
 
 // startInitialPods runs the initial pods from the configuration file.
 func (r *runner) startInitialPods() {
+	// Initial pods may have been recovered from a previous run of kurmad.
+	existing := make(map[string]bool)
+	for _, pod := range r.podManager.Pods() {
+		existing[pod.Name()] = true
+	}
+
 	for d, ip := range r.config.InitialPods {
-		name, podManifest, err := ip.Process(r.imageManager)
+		name, podManifest, err := ip.Process(r.imageManager, r.fetcher)
 		if name == "" {
 			name = fmt.Sprintf("initial-pod-%d", d+1)
 		}
@@ -284,8 +350,13 @@ func (r *runner) startInitialPods() {
 			r.log.Errorf("Failed to configure pod %q, skipping: %s", name, err)
 			continue
 		}
+		if existing[name] {
+			r.log.Infof("Initial pod %q is already running, skipping.", name)
+			continue
+		}
 
-		pod, err := r.podManager.Create(name, podManifest, nil)
+		options := &backend.PodOptions{RestartPolicy: ip.RestartPolicy()}
+		pod, err := r.podManager.Create(name, podManifest, options)
 		if err != nil {
 			r.log.Errorf("Failed to launch pod %q: %v", name, err)
 			continue
@@ -5,11 +5,15 @@ package apiclient
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/apcera/kurma/schema"
 	"github.com/apcera/util/wsconn"
@@ -25,11 +29,32 @@ type Client interface {
 	GetPod(uuid string) (*Pod, error)
 	DestroyPod(uuid string) error
 	EnterContainer(uuid string, appName string, app *schema.RunApp) (net.Conn, error)
+	PodLogs(uuid string, appName string, tail int, follow bool) (net.Conn, error)
 
 	CreateImage(reader io.Reader) (*Image, error)
+	FetchImage(req *ImageFetchRequest, progress func(*ImageFetchProgress)) (*Image, error)
 	ListImages() ([]*Image, error)
 	GetImage(hash string) (*Image, error)
 	DeleteImage(hash string) error
+	VerifyImage(hash string) error
+	TagImage(hash, reference string) error
+	UntagImage(reference string) error
+	ResolveImage(reference string) (*Image, error)
+	ExportImage(hash string, dependencies bool) (io.ReadCloser, error)
+	GarbageCollectImages() ([]string, error)
+
+	CreateVolume(name string) (*Volume, error)
+	ListVolumes() ([]*Volume, error)
+	GetVolume(name string) (*Volume, error)
+	DeleteVolume(name string) error
+
+	ListTrustedKeys() ([]*TrustedKey, error)
+	AddTrustedKeys(prefix, key string) ([]*TrustedKey, error)
+	RemoveTrustedKey(prefix, fingerprint string) error
+
+	ListRegistryCredentials() ([]*RegistryCredential, error)
+	AddRegistryCredential(credential *RegistryCredential) error
+	RemoveRegistryCredential(host string) error
 }
 
 type client struct {
@@ -172,6 +197,51 @@ func (c *client) EnterContainer(uuid string, appName string, app *schema.RunApp)
 	return wsc, nil
 }
 
+func (c *client) PodLogs(uuid string, appName string, tail int, follow bool) (net.Conn, error) {
+	u, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = fmt.Sprintf("/pods/%s/logs", url.QueryEscape(uuid))
+
+	query := url.Values{}
+	if appName != "" {
+		query.Set("app", appName)
+	}
+	if tail > 0 {
+		query.Set("tail", strconv.Itoa(tail))
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+	u.RawQuery = query.Encode()
+
+	// set headers
+	headers := http.Header{
+		"Origin": {u.String()},
+	}
+	u.Scheme = "ws"
+
+	// dial the connection
+	conn, err := c.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	// initialize the websocket
+	ws, resp, err := websocket.NewClient(conn, u, headers, 1024, 1024)
+	if err != nil {
+		conn.Close()
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			b, _ := ioutil.ReadAll(resp.Body)
+			return nil, fmt.Errorf("%s", strings.TrimSpace(string(b)))
+		}
+		return nil, err
+	}
+
+	return wsconn.NewWebsocketConnection(ws), nil
+}
+
 func (c *client) CreateImage(reader io.Reader) (*Image, error) {
 	u, err := url.Parse(c.baseUrl)
 	if err != nil {
@@ -201,6 +271,59 @@ func (c *client) CreateImage(reader io.Reader) (*Image, error) {
 	return imageResp.Image, nil
 }
 
+// FetchImage has the host retrieve and load an image. When progress is given,
+// it is called as the image is downloaded.
+func (c *client) FetchImage(fetchReq *ImageFetchRequest, progress func(*ImageFetchProgress)) (*Image, error) {
+	if progress == nil {
+		var resp *ImageResponse
+		if err := c.execute("Images.Fetch", fetchReq, &resp); err != nil {
+			return nil, err
+		}
+		return resp.Image, nil
+	}
+
+	u, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/images/fetch"
+
+	b, err := json.Marshal(fetchReq)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HttpClient.Post(u.String(), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to fetch image: %s", strings.TrimSpace(string(b)))
+	}
+
+	// the progress is streamed until the image has been loaded
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var status *ImageFetchStatus
+		if err := decoder.Decode(&status); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("failed to read the image fetch status: %v", err)
+		}
+		switch {
+		case status.Error != "":
+			return nil, errors.New(status.Error)
+		case status.Image != nil:
+			return status.Image, nil
+		case status.Progress != nil && progress != nil:
+			progress(status.Progress)
+		}
+	}
+}
+
 func (c *client) ListImages() ([]*Image, error) {
 	var resp *ImageListResponse
 	err := c.execute("Images.List", nil, &resp)
@@ -223,6 +346,151 @@ func (c *client) DeleteImage(hash string) error {
 	return c.execute("Images.Delete", hash, nil)
 }
 
+func (c *client) VerifyImage(hash string) error {
+	return c.execute("Images.Verify", hash, nil)
+}
+
+func (c *client) TagImage(hash, reference string) error {
+	return c.execute("Images.Tag", &ImageTagRequest{Hash: hash, Reference: reference}, &None{})
+}
+
+func (c *client) UntagImage(reference string) error {
+	return c.execute("Images.Untag", reference, &None{})
+}
+
+func (c *client) ResolveImage(reference string) (*Image, error) {
+	var resp *ImageResponse
+	err := c.execute("Images.Resolve", reference, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+func (c *client) ExportImage(hash string, dependencies bool) (io.ReadCloser, error) {
+	u, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = fmt.Sprintf("/images/%s/export", url.QueryEscape(hash))
+	if dependencies {
+		u.RawQuery = url.Values{"dependencies": {"true"}}.Encode()
+	}
+
+	resp, err := c.HttpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to export image: %s", strings.TrimSpace(string(b)))
+	}
+	return &exportReader{resp: resp}, nil
+}
+
+// exportReader reads an exported image, returning any error the export
+// reported in the response's trailer once the image has been read.
+type exportReader struct {
+	resp *http.Response
+}
+
+func (r *exportReader) Read(p []byte) (int, error) {
+	n, err := r.resp.Body.Read(p)
+	if err == io.EOF {
+		if msg := r.resp.Trailer.Get(ImageExportErrorTrailer); msg != "" {
+			return n, fmt.Errorf("failed to export image: %s", msg)
+		}
+	}
+	return n, err
+}
+
+func (r *exportReader) Close() error {
+	return r.resp.Body.Close()
+}
+
+func (c *client) GarbageCollectImages() ([]string, error) {
+	var resp *ImageGCResponse
+	err := c.execute("Images.GarbageCollect", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Deleted, nil
+}
+
+func (c *client) CreateVolume(name string) (*Volume, error) {
+	var resp *VolumeResponse
+	err := c.execute("Volumes.Create", name, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Volume, nil
+}
+
+func (c *client) ListVolumes() ([]*Volume, error) {
+	var resp *VolumeListResponse
+	err := c.execute("Volumes.List", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Volumes, nil
+}
+
+func (c *client) GetVolume(name string) (*Volume, error) {
+	var resp *VolumeResponse
+	err := c.execute("Volumes.Get", name, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Volume, nil
+}
+
+func (c *client) DeleteVolume(name string) error {
+	return c.execute("Volumes.Delete", name, &None{})
+}
+
+func (c *client) ListTrustedKeys() ([]*TrustedKey, error) {
+	var resp *TrustedKeyListResponse
+	err := c.execute("TrustedKeys.List", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+func (c *client) AddTrustedKeys(prefix, key string) ([]*TrustedKey, error) {
+	var resp *TrustedKeyListResponse
+	req := &TrustedKeyAddRequest{Prefix: prefix, Key: key}
+	err := c.execute("TrustedKeys.Add", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+func (c *client) RemoveTrustedKey(prefix, fingerprint string) error {
+	req := &TrustedKeyRemoveRequest{Prefix: prefix, Fingerprint: fingerprint}
+	return c.execute("TrustedKeys.Remove", req, nil)
+}
+
+func (c *client) ListRegistryCredentials() ([]*RegistryCredential, error) {
+	var resp *RegistryCredentialListResponse
+	err := c.execute("RegistryCredentials.List", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Credentials, nil
+}
+
+func (c *client) AddRegistryCredential(credential *RegistryCredential) error {
+	return c.execute("RegistryCredentials.Add", credential, nil)
+}
+
+func (c *client) RemoveRegistryCredential(host string) error {
+	return c.execute("RegistryCredentials.Remove", host, nil)
+}
+
 func (c *client) execute(cmd string, args, reply interface{}) error {
 	buf, err := json2.EncodeClientRequest(cmd, args)
 	if err != nil {
@@ -16,19 +16,40 @@ type Pod struct {
 	Pod      *schema.PodManifest `json:"pod"`
 	Networks []*ntypes.IPResult  `json:"networks"`
 	State    State               `json:"state"`
+
+	StagerState string       `json:"stagerState,omitempty"`
+	Apps        []*AppStatus `json:"apps,omitempty"`
+}
+
+type AppStatus struct {
+	Name       string `json:"name"`
+	Pid        int    `json:"pid,omitempty"`
+	Exited     bool   `json:"exited"`
+	ExitCode   int    `json:"exitCode"`
+	ExitReason string `json:"exitReason,omitempty"`
+	Restarts   int    `json:"restarts,omitempty"`
 }
 
 type Image struct {
-	Hash     string                `json:"hash"`
-	Manifest *schema.ImageManifest `json:"manifest"`
-	Size     int64                 `json:"size"`
+	Hash           string                `json:"hash"`
+	Manifest       *schema.ImageManifest `json:"manifest"`
+	Size           int64                 `json:"size"`
+	CompressedSize int64                 `json:"compressedSize,omitempty"`
+	TotalSize      int64                 `json:"totalSize"`
+	Tags           []string              `json:"tags,omitempty"`
 }
 
 type PodCreateRequest struct {
-	Name            string              `json:"name"`
-	Pod             *schema.PodManifest `json:"pod"`
-	Networks        []string            `json:"networks,omitempty"`
-	StagerImageHash string              `json:"stagerImageHash,omitempty"`
+	Name            string                 `json:"name"`
+	Pod             *schema.PodManifest    `json:"pod"`
+	Networks        []string               `json:"networks,omitempty"`
+	StagerImageHash string                 `json:"stagerImageHash,omitempty"`
+	RestartPolicy   *kschema.RestartPolicy `json:"restartPolicy,omitempty"`
+
+	// Images maps the names of the pod's apps to references to their images,
+	// in the form "name[:tag]", which are resolved to the images' hashes by
+	// the host.
+	Images map[string]string `json:"images,omitempty"`
 }
 
 type PodListResponse struct {
@@ -58,6 +79,89 @@ type ImageResponse struct {
 	Image *Image `json:"image"`
 }
 
+// ImageTagRequest tags the image with a reference in the form "name[:tag]".
+type ImageTagRequest struct {
+	Hash      string `json:"hash"`
+	Reference string `json:"reference"`
+}
+
+type ImageGCResponse struct {
+	Deleted []string `json:"deleted"`
+}
+
+// ImageExportErrorTrailer is the HTTP trailer used to report an error which
+// occurs after an image export has begun streaming.
+const ImageExportErrorTrailer = "X-Kurma-Export-Error"
+
+type ImageFetchRequest struct {
+	URI      string            `json:"uri"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Insecure bool              `json:"insecure,omitempty"`
+}
+
+type ImageFetchProgress struct {
+	URI        string `json:"uri"`
+	Downloaded int64  `json:"downloaded"`
+	Total      int64  `json:"total"`
+}
+
+// ImageFetchStatus is streamed as newline delimited JSON in response to an
+// image fetch. Progress is reported while the image is downloaded, and the
+// final status holds either the loaded image or the error fetching it.
+type ImageFetchStatus struct {
+	Progress *ImageFetchProgress `json:"progress,omitempty"`
+	Image    *Image              `json:"image,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+type Volume struct {
+	Name string   `json:"name"`
+	Size int64    `json:"size"`
+	Pods []string `json:"pods,omitempty"`
+}
+
+type VolumeListResponse struct {
+	Volumes []*Volume `json:"volumes"`
+}
+
+type VolumeResponse struct {
+	Volume *Volume `json:"volume"`
+}
+
+type TrustedKey struct {
+	Prefix      string   `json:"prefix"`
+	Fingerprint string   `json:"fingerprint"`
+	Identities  []string `json:"identities,omitempty"`
+}
+
+type TrustedKeyAddRequest struct {
+	Prefix string `json:"prefix"`
+	Key    string `json:"key"`
+}
+
+type TrustedKeyRemoveRequest struct {
+	Prefix      string `json:"prefix"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type TrustedKeyListResponse struct {
+	Keys []*TrustedKey `json:"keys"`
+}
+
+// RegistryCredential holds the credentials used to authenticate with a host
+// that images are retrieved from. The password and token are never returned
+// when credentials are listed.
+type RegistryCredential struct {
+	Host     string `json:"host"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+type RegistryCredentialListResponse struct {
+	Credentials []*RegistryCredential `json:"credentials"`
+}
+
 type None struct{}
 
 type State string
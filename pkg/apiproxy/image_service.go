@@ -5,9 +5,12 @@ package apiproxy
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/gorilla/mux"
 )
 
 type ImageService struct {
@@ -28,6 +31,61 @@ func (s *Server) imageCreateRequest(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (s *Server) imageExportRequest(w http.ResponseWriter, req *http.Request) {
+	dependencies, _ := strconv.ParseBool(req.URL.Query().Get("dependencies"))
+
+	// call out before streaming so errors can be returned to the client
+	r, err := s.client.ExportImage(mux.Vars(req)["hash"], dependencies)
+	if err != nil {
+		s.log.Errorf("Failed to call to kurma daemon: %v", err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer r.Close()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Trailer", apiclient.ImageExportErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, r); err != nil {
+		s.log.Errorf("Failed to export image: %v", err)
+		w.Header().Set(apiclient.ImageExportErrorTrailer, err.Error())
+	}
+}
+
+func (s *Server) imageFetchRequest(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	var fetchReq apiclient.ImageFetchRequest
+	if err := json.NewDecoder(req.Body).Decode(&fetchReq); err != nil || fetchReq.URI == "" {
+		http.Error(w, "Invalid image fetch request", 400)
+		return
+	}
+	if err := validateFetchURI(fetchReq.URI); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	// the daemon's progress is relayed as it is received
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	send := func(status *apiclient.ImageFetchStatus) {
+		encoder.Encode(status)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	image, err := s.client.FetchImage(&fetchReq, func(progress *apiclient.ImageFetchProgress) {
+		send(&apiclient.ImageFetchStatus{Progress: progress})
+	})
+	if err != nil {
+		s.log.Errorf("Failed to fetch image %q: %v", fetchReq.URI, err)
+		send(&apiclient.ImageFetchStatus{Error: err.Error()})
+		return
+	}
+	send(&apiclient.ImageFetchStatus{Image: image})
+}
+
 func (s *ImageService) List(r *http.Request, args *apiclient.None, resp *apiclient.ImageListResponse) error {
 	images, err := s.server.client.ListImages()
 	if err != nil {
@@ -37,6 +95,18 @@ func (s *ImageService) List(r *http.Request, args *apiclient.None, resp *apiclie
 	return nil
 }
 
+func (s *ImageService) Fetch(r *http.Request, req *apiclient.ImageFetchRequest, resp *apiclient.ImageResponse) error {
+	if err := validateFetchURI(req.URI); err != nil {
+		return err
+	}
+	image, err := s.server.client.FetchImage(req, nil)
+	if err != nil {
+		return err
+	}
+	resp.Image = image
+	return nil
+}
+
 func (s *ImageService) Get(r *http.Request, hash *string, resp *apiclient.ImageResponse) error {
 	if hash == nil {
 		return fmt.Errorf("no image hash was specified")
@@ -55,3 +125,42 @@ func (s *ImageService) Delete(r *http.Request, hash *string, resp *apiclient.Ima
 	}
 	return s.server.client.DeleteImage(*hash)
 }
+
+func (s *ImageService) Verify(r *http.Request, hash *string, resp *apiclient.None) error {
+	if hash == nil {
+		return fmt.Errorf("no image hash was specified")
+	}
+	return s.server.client.VerifyImage(*hash)
+}
+
+func (s *ImageService) Tag(r *http.Request, req *apiclient.ImageTagRequest, resp *apiclient.None) error {
+	return s.server.client.TagImage(req.Hash, req.Reference)
+}
+
+func (s *ImageService) Untag(r *http.Request, reference *string, resp *apiclient.None) error {
+	if reference == nil {
+		return fmt.Errorf("no image reference was specified")
+	}
+	return s.server.client.UntagImage(*reference)
+}
+
+func (s *ImageService) Resolve(r *http.Request, reference *string, resp *apiclient.ImageResponse) error {
+	if reference == nil {
+		return fmt.Errorf("no image reference was specified")
+	}
+	image, err := s.server.client.ResolveImage(*reference)
+	if err != nil {
+		return err
+	}
+	resp.Image = image
+	return nil
+}
+
+func (s *ImageService) GarbageCollect(r *http.Request, args *apiclient.None, resp *apiclient.ImageGCResponse) error {
+	deleted, err := s.server.client.GarbageCollectImages()
+	if err != nil {
+		return err
+	}
+	resp.Deleted = deleted
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package apiproxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/apcera/util/wsconn"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) podLogsRequest(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	tail, _ := strconv.Atoi(query.Get("tail"))
+	follow, _ := strconv.ParseBool(query.Get("follow"))
+
+	// call out before upgrading so errors can be returned to the client
+	owsc, err := s.client.PodLogs(mux.Vars(req)["uuid"], query.Get("app"), tail, follow)
+	if err != nil {
+		s.log.Errorf("Failed to call to kurma daemon: %v", err)
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer owsc.Close()
+
+	iws, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade logs connection: %v", err)
+		return
+	}
+
+	// create the websocket connection
+	iwsc := wsconn.NewWebsocketConnection(iws)
+	defer iwsc.Close()
+
+	// Closing the daemon connection when the client goes away stops following.
+	go func() {
+		io.Copy(owsc, iwsc)
+		owsc.Close()
+	}()
+	io.Copy(iwsc, owsc)
+}
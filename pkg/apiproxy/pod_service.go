@@ -15,10 +15,16 @@ type PodService struct {
 
 func (s *PodService) Create(r *http.Request, req *apiclient.PodCreateRequest, resp *apiclient.PodResponse) error {
 	// locally validate the manifest to gate remote vs local container functionality
-	if err := validatePodManifest(req.Pod); err != nil {
+	if err := validatePodManifest(req.Pod, s.server.options.RequiredNamespaces); err != nil {
 		return fmt.Errorf("image manifest is not valid: %v", err)
 	}
 
+	// The stager runs with host privilege, so only the host's default stager
+	// may be used by pods launched remotely.
+	if req.StagerImageHash != "" {
+		return fmt.Errorf("a stager image cannot be specified for pods launched remotely")
+	}
+
 	c, err := s.server.client.CreatePod(req)
 	if err != nil {
 		return err
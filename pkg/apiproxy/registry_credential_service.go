@@ -0,0 +1,25 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package apiproxy
+
+import (
+	"net/http"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+)
+
+// RegistryCredentialService only lists the host's registry credentials, without
+// their secrets. Credentials can only be added or removed with the local API,
+// since remote callers could otherwise replace them.
+type RegistryCredentialService struct {
+	server *Server
+}
+
+func (s *RegistryCredentialService) List(r *http.Request, args *apiclient.None, resp *apiclient.RegistryCredentialListResponse) error {
+	creds, err := s.server.client.ListRegistryCredentials()
+	if err != nil {
+		return err
+	}
+	resp.Credentials = creds
+	return nil
+}
@@ -17,6 +17,11 @@ import (
 // instantiating a new api.Server.
 type Options struct {
 	BindAddress string
+
+	// RequiredNamespaces is the list of namespaces, such as "user" or "net",
+	// that pods created through the proxy must run in rather than using the
+	// host's namespace.
+	RequiredNamespaces []string
 }
 
 // Server represents the process that acts as a daemon to receive container
@@ -59,12 +64,18 @@ func (s *Server) Start() error {
 	svr.RegisterCodec(json2.NewCodec(), "application/json")
 	svr.RegisterService(&PodService{server: s}, "Pods")
 	svr.RegisterService(&ImageService{server: s}, "Images")
+	svr.RegisterService(&VolumeService{server: s}, "Volumes")
+	svr.RegisterService(&TrustedKeyService{server: s}, "TrustedKeys")
+	svr.RegisterService(&RegistryCredentialService{server: s}, "RegistryCredentials")
 
 	router := mux.NewRouter()
 	router.Handle("/rpc", svr)
 	router.HandleFunc("/info", s.infoRequest).Methods("GET")
 	router.HandleFunc("/containers/enter", s.containerEnterRequest).Methods("GET")
+	router.HandleFunc("/pods/{uuid}/logs", s.podLogsRequest).Methods("GET")
 	router.HandleFunc("/images/create", s.imageCreateRequest).Methods("POST")
+	router.HandleFunc("/images/fetch", s.imageFetchRequest).Methods("POST")
+	router.HandleFunc("/images/{hash}/export", s.imageExportRequest).Methods("GET")
 
 	s.log.Debug("Server is ready")
 	go func() {
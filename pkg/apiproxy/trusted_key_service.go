@@ -0,0 +1,25 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package apiproxy
+
+import (
+	"net/http"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+)
+
+// TrustedKeyService only lists the host's trusted keys. Keys can only be added
+// or removed with the local API, since a key trusted for every image would
+// defeat requiring image signatures.
+type TrustedKeyService struct {
+	server *Server
+}
+
+func (s *TrustedKeyService) List(r *http.Request, args *apiclient.None, resp *apiclient.TrustedKeyListResponse) error {
+	keys, err := s.server.client.ListTrustedKeys()
+	if err != nil {
+		return err
+	}
+	resp.Keys = keys
+	return nil
+}
@@ -4,12 +4,14 @@ package apiproxy
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 
 	kschema "github.com/apcera/kurma/schema"
 	"github.com/appc/spec/schema"
 )
 
-func validatePodManifest(manifest *schema.PodManifest) error {
+func validatePodManifest(manifest *schema.PodManifest, requiredNamespaces []string) error {
 	if len(manifest.Apps) == 0 {
 		return fmt.Errorf("the imageManifest must specify an App")
 	}
@@ -28,9 +30,79 @@ func validatePodManifest(manifest *schema.PodManifest) error {
 		}
 	}
 
+	// Reject any host volumes, since they expose the host's filesystem. These
+	// can only be used with the local API.
+	for _, volume := range manifest.Volumes {
+		if volume.Kind == "host" {
+			return fmt.Errorf("host volumes cannot be used by pods launched remotely")
+		}
+	}
+
 	// FIXME once network isolation is in, this should force adding the container
 	// namespaces isolator to ensure any remotely sourced images are network
 	// namespaced.
 
+	return requireNamespaces(manifest, requiredNamespaces)
+}
+
+// requireNamespaces ensures the pod doesn't request the host's namespace for
+// any of the required namespaces. The required namespaces are then explicitly
+// requested in the pod's namespaces isolator, so the pod will fail to start
+// rather than silently run without them if the host doesn't support them, such
+// as when user namespaces aren't configured.
+func requireNamespaces(manifest *schema.PodManifest, required []string) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	index := -1
+	nsiso := kschema.NewLinuxNamespace().(*kschema.LinuxNamespaces)
+	for i, iso := range manifest.Isolators {
+		if iso.Name.String() != kschema.LinuxNamespacesName {
+			continue
+		}
+		if niso, ok := iso.Value().(*kschema.LinuxNamespaces); ok {
+			index = i
+			nsiso = niso
+		}
+	}
+
+	for _, ns := range required {
+		if val, _ := nsiso.Get(ns); val == kschema.LinuxNamespaceHost {
+			return fmt.Errorf("pods created remotely may not use the host's %s namespace", ns)
+		}
+		nsiso.Set(ns, kschema.LinuxNamespaceDefault)
+	}
+	if err := nsiso.AssertValid(); err != nil {
+		return err
+	}
+
+	iso, err := nsiso.AsIsolator()
+	if err != nil {
+		return fmt.Errorf("failed to generate the namespaces isolator: %v", err)
+	}
+	if index >= 0 {
+		manifest.Isolators[index] = *iso
+	} else {
+		manifest.Isolators = append(manifest.Isolators, *iso)
+	}
+	return nil
+}
+
+// validateFetchURI rejects fetching images from files or OCI image layouts,
+// since they expose the host's filesystem. These can only be fetched with the
+// local API.
+func validateFetchURI(imageURI string) error {
+	u, err := url.Parse(imageURI)
+	if err != nil {
+		// Docker images with a digest but no registry aren't valid URLs
+		if strings.HasPrefix(imageURI, "docker://") {
+			return nil
+		}
+		return fmt.Errorf("invalid image URI %q: %v", imageURI, err)
+	}
+	if u.Scheme == "file" || u.Scheme == "oci" {
+		return fmt.Errorf("images cannot be fetched from the host's filesystem remotely")
+	}
 	return nil
 }
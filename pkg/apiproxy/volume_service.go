@@ -0,0 +1,54 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package apiproxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+)
+
+type VolumeService struct {
+	server *Server
+}
+
+func (s *VolumeService) Create(r *http.Request, name *string, resp *apiclient.VolumeResponse) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	volume, err := s.server.client.CreateVolume(*name)
+	if err != nil {
+		return err
+	}
+	resp.Volume = volume
+	return nil
+}
+
+func (s *VolumeService) List(r *http.Request, args *apiclient.None, resp *apiclient.VolumeListResponse) error {
+	volumes, err := s.server.client.ListVolumes()
+	if err != nil {
+		return err
+	}
+	resp.Volumes = volumes
+	return nil
+}
+
+func (s *VolumeService) Get(r *http.Request, name *string, resp *apiclient.VolumeResponse) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	volume, err := s.server.client.GetVolume(*name)
+	if err != nil {
+		return err
+	}
+	resp.Volume = volume
+	return nil
+}
+
+func (s *VolumeService) Delete(r *http.Request, name *string, resp *apiclient.None) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	return s.server.client.DeleteVolume(*name)
+}
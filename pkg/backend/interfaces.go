@@ -68,15 +68,61 @@ type ImageManager interface {
 	GetImage(hash string) *schema.ImageManifest
 
 	// FindImage will find the image manifest and hash for the specified name and
-	// version label.
+	// version label. When the version is empty, the image with the greatest
+	// version is returned. Tags are not consulted.
 	FindImage(name, version string) (string, *schema.ImageManifest)
 
-	// GetImageSize will return the on disk size of the image.
-	GetImageSize(hash string) (int64, error)
+	// TagImage tags the image with the name and tag, replacing the image the
+	// tag previously referred to.
+	TagImage(hash, name, tag string) error
 
-	// DeleteImage will remove the specified image hash from disk.
+	// UntagImage removes the name and tag from the image it refers to.
+	UntagImage(name, tag string) error
+
+	// ResolveImage returns the hash and manifest of the image the name and tag
+	// refer to. Tags which haven't been set refer to the image with the name
+	// and a matching version label.
+	ResolveImage(name, tag string) (string, *schema.ImageManifest)
+
+	// ImageTags returns the references, in the form "name:tag", which refer to
+	// the image.
+	ImageTags(hash string) []string
+
+	// GetImageSize will return the on disk size of the image, the size it was
+	// uploaded with, and the total on disk size including its dependencies.
+	GetImageSize(hash string) (*ImageSize, error)
+
+	// VerifyImage checks that the image's files still match the digests
+	// recorded when it was created.
+	VerifyImage(hash string) error
+
+	// ExportImage will write the image to the writer as an uncompressed ACI,
+	// without its dependencies. The ACI is rebuilt from the image's files, so
+	// its hash differs from the image's and images which depend on the image
+	// by its ID won't resolve to it.
+	ExportImage(hash string, w io.Writer) error
+
+	// ExportImageTree will write the image merged with all of its dependencies
+	// to the writer as a single uncompressed ACI.
+	ExportImageTree(hash string, w io.Writer) error
+
+	// DeleteImage will remove the specified image hash from disk. It will fail
+	// if the image is in use or another image depends on it.
 	DeleteImage(hash string) error
 
+	// AddReferences marks the images as in use by the owner, protecting them and
+	// their dependencies from removal. It replaces any references previously
+	// held by the owner. Images which still exist once it returns are
+	// protected, even if they were being garbage collected when it was called.
+	AddReferences(owner string, hashes []string)
+
+	// RemoveReferences releases all the images referenced by the owner.
+	RemoveReferences(owner string)
+
+	// GarbageCollect removes all images that are not in use and returns the
+	// hashes of the images removed.
+	GarbageCollect() ([]string, error)
+
 	// ResolveTree will resolve the dependency tree for the specified image. It
 	// will return a []string returning the order images should be merged, the
 	// []string with all the relevant image paths on disk, the map of all the
@@ -99,6 +145,20 @@ type ResolutionTree struct {
 	Manifests map[string]*schema.ImageManifest
 }
 
+// ImageSize contains the sizes, in bytes, of an image.
+type ImageSize struct {
+	// Extracted is the size of the image's extracted filesystem on disk.
+	Extracted int64
+
+	// Compressed is the size of the image as it was uploaded, or 0 if it isn't
+	// known.
+	Compressed int64
+
+	// Total is the extracted size of the image along with all of its resolved
+	// dependencies.
+	Total int64
+}
+
 // PodManager is responsible for the pod lifecycle management.
 type PodManager interface {
 	// SetHostSocketFile sets the path to the host's socket file for granting API
@@ -123,6 +183,32 @@ type PodManager interface {
 	// Shutdown requests that the pod manager shut down running pods to prepare to
 	// exit.
 	Shutdown()
+
+	// Volumes returns the named volumes stored on the host.
+	Volumes() ([]*Volume, error)
+
+	// Volume returns the named volume, or an error if it does not exist.
+	Volume(name string) (*Volume, error)
+
+	// CreateVolume creates a new, empty named volume.
+	CreateVolume(name string) (*Volume, error)
+
+	// DeleteVolume removes the named volume and its contents. It fails if the
+	// volume is in use by any pods.
+	DeleteVolume(name string) error
+}
+
+// Volume describes a named volume, which persists on the host beyond the
+// lifetime of the pods that use it.
+type Volume struct {
+	// Name is the name of the volume.
+	Name string
+
+	// Size is the disk space used by the volume's contents, in bytes.
+	Size int64
+
+	// Pods is the list of the UUIDs of pods currently using the volume.
+	Pods []string
 }
 
 // PodOptions is a set of locally available options to extend instrumentation
@@ -130,26 +216,32 @@ type PodManager interface {
 type PodOptions struct {
 	// StagerHash is the hash of the image that should be used as the stager for
 	// the pod.
-	StagerHash string
+	StagerHash string `json:"stagerHash"`
 
 	// StagerMounts is a set of libcontainer mounts that will be applied directly
 	// to the stager.
-	StagerMounts []*configs.Mount
+	StagerMounts []*configs.Mount `json:"stagerMounts,omitempty"`
 
 	// RawVolumes is a set of PodManifest volumes that will be appended directly
 	// to the pod manifest and skip typical processing like volumes specified by
 	// the user provided pod manifest.
-	RawVolumes []types.Volume
+	RawVolumes []types.Volume `json:"rawVolumes,omitempty"`
 
 	// Networks defines the named network configurations that should be attached
 	// to this pod. Not specifying any networks will trigger the daemon's default
 	// networks to be used.
-	Networks []string
+	Networks []string `json:"networks,omitempty"`
+
+	// RestartPolicy defines whether the pod's apps should be restarted when they
+	// exit, and whether the pod should be restarted if its stager exits. A nil
+	// policy never restarts.
+	RestartPolicy *kschema.RestartPolicy `json:"restartPolicy,omitempty"`
 
 	// ContainerIO represents specific inputs/outputs that should be passed along
 	// to the stager for use in the specified containers. The key of the map is
-	// the application name from the pod manifest.
-	ContainerIO map[string]*IOs
+	// the application name from the pod manifest. These are only valid within
+	// the process that created the pod, so they are not persisted.
+	ContainerIO map[string]*IOs `json:"-"`
 }
 
 // IOs is used to contain specific standard inputs and outputs that should be
@@ -171,6 +263,9 @@ type StagerManifest struct {
 	// The pod's configured name. This is likely to be used as the hostname.
 	Name string `json:"name"`
 
+	// The pod's UUID.
+	UUID string `json:"uuid"`
+
 	// The pod manifest.
 	Pod *schema.PodManifest `json:"pod"`
 
@@ -182,11 +277,49 @@ type StagerManifest struct {
 	// first and the bottom most layer last.
 	AppImageOrder map[string][]string `json:"appImageOrder"`
 
+	// RestartPolicy is the policy the stager should apply to apps within the pod
+	// when they exit.
+	RestartPolicy *kschema.RestartPolicy `json:"restartPolicy,omitempty"`
+
+	// UserNamespace is the ID mapping for the user namespace the pod's apps
+	// should run in. When it is nil, no user namespace is used.
+	UserNamespace *UserNamespace `json:"userNamespace,omitempty"`
+
 	// StagerConfig is an arbitruary JSON configuration that will be passed along
 	// for the stager.
 	StagerConfig json.RawMessage `json:"stagerConfig"`
 }
 
+// UserNamespace describes the user and group ID mappings for a pod's user
+// namespace. IDs 0 through Size-1 within the pod map to the host IDs beginning
+// at HostUID and HostGID.
+type UserNamespace struct {
+	HostUID int `json:"hostUid"`
+	HostGID int `json:"hostGid"`
+	Size    int `json:"size"`
+}
+
+// PodStatus is the runtime status of a pod as reported by its stager.
+type PodStatus struct {
+	// StagerState is the stager's own view of the pod, such as whether it is
+	// still setting up or tearing down.
+	StagerState string
+
+	// Apps is the status of each app within the pod, in the order they're
+	// defined in the pod manifest.
+	Apps []*AppStatus
+}
+
+// AppStatus is the runtime status of an individual app within a pod.
+type AppStatus struct {
+	Name       string
+	Pid        int
+	Exited     bool
+	ExitCode   int
+	ExitReason string
+	Restarts   int
+}
+
 // Pod represents the interactions that are possible with an individual instance
 // running within the PodManager.
 type Pod interface {
@@ -205,6 +338,10 @@ type Pod interface {
 	// State returns the current operating state of the pod.
 	State() PodState
 
+	// Status returns the runtime status reported by the pod's stager, including
+	// the status of each of the pod's apps.
+	Status() (*PodStatus, error)
+
 	// Stop triggers the shutdown of the Pod.
 	Stop() error
 
@@ -213,6 +350,12 @@ type Pod interface {
 	// stream in and out.
 	Enter(appName string, app *kschema.RunApp, stdin io.Reader, stdout, stderr io.Writer, postStart func()) (*os.Process, error)
 
+	// Logs writes the output of the specified app to the provided writer, or the
+	// stager's output if no app name is given. When tail is greater than zero,
+	// only the last tail lines are written. When follow is set, new output
+	// continues to be written until the done channel is closed or the pod stops.
+	Logs(appName string, tail int, follow bool, w io.Writer, done <-chan struct{}) error
+
 	// WaitForState is used to poll until the state of the pod reaches a desired
 	// state.
 	WaitForState(timeout time.Duration, states ...PodState) error
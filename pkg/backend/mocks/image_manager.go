@@ -15,9 +15,21 @@ type ImageManager struct {
 	ListImagesFunc   func() map[string]*schema.ImageManifest
 	GetImageFunc     func(hash string) *schema.ImageManifest
 	FindImageFunc    func(name, version string) (string, *schema.ImageManifest)
-	GetImageSizeFunc func(hash string) (int64, error)
+	TagImageFunc     func(hash, name, tag string) error
+	UntagImageFunc   func(name, tag string) error
+	ResolveImageFunc func(name, tag string) (string, *schema.ImageManifest)
+	ImageTagsFunc    func(hash string) []string
+	GetImageSizeFunc func(hash string) (*backend.ImageSize, error)
+	VerifyImageFunc  func(hash string) error
 	DeleteImageFunc  func(hash string) error
 	ResolveTreeFunc  func(hash string) (*backend.ResolutionTree, error)
+
+	ExportImageFunc     func(hash string, w io.Writer) error
+	ExportImageTreeFunc func(hash string, w io.Writer) error
+
+	AddReferencesFunc    func(owner string, hashes []string)
+	RemoveReferencesFunc func(owner string)
+	GarbageCollectFunc   func() ([]string, error)
 }
 
 func (im *ImageManager) Rescan() error {
@@ -40,10 +52,41 @@ func (im *ImageManager) FindImage(name, version string) (string, *schema.ImageMa
 	return im.FindImageFunc(name, version)
 }
 
-func (im *ImageManager) GetImageSize(hash string) (int64, error) {
+func (im *ImageManager) TagImage(hash, name, tag string) error {
+	return im.TagImageFunc(hash, name, tag)
+}
+
+func (im *ImageManager) UntagImage(name, tag string) error {
+	return im.UntagImageFunc(name, tag)
+}
+
+func (im *ImageManager) ResolveImage(name, tag string) (string, *schema.ImageManifest) {
+	return im.ResolveImageFunc(name, tag)
+}
+
+func (im *ImageManager) ImageTags(hash string) []string {
+	if im.ImageTagsFunc != nil {
+		return im.ImageTagsFunc(hash)
+	}
+	return nil
+}
+
+func (im *ImageManager) GetImageSize(hash string) (*backend.ImageSize, error) {
 	return im.GetImageSizeFunc(hash)
 }
 
+func (im *ImageManager) VerifyImage(hash string) error {
+	return im.VerifyImageFunc(hash)
+}
+
+func (im *ImageManager) ExportImage(hash string, w io.Writer) error {
+	return im.ExportImageFunc(hash, w)
+}
+
+func (im *ImageManager) ExportImageTree(hash string, w io.Writer) error {
+	return im.ExportImageTreeFunc(hash, w)
+}
+
 func (im *ImageManager) DeleteImage(hash string) error {
 	return im.DeleteImageFunc(hash)
 }
@@ -51,3 +94,19 @@ func (im *ImageManager) DeleteImage(hash string) error {
 func (im *ImageManager) ResolveTree(hash string) (*backend.ResolutionTree, error) {
 	return im.ResolveTreeFunc(hash)
 }
+
+func (im *ImageManager) AddReferences(owner string, hashes []string) {
+	if im.AddReferencesFunc != nil {
+		im.AddReferencesFunc(owner, hashes)
+	}
+}
+
+func (im *ImageManager) RemoveReferences(owner string) {
+	if im.RemoveReferencesFunc != nil {
+		im.RemoveReferencesFunc(owner)
+	}
+}
+
+func (im *ImageManager) GarbageCollect() ([]string, error) {
+	return im.GarbageCollectFunc()
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/appc/spec/schema/types"
 	"github.com/syndtr/gocapability/capability"
 )
 
@@ -21,6 +22,33 @@ func GetAllCapabilities() []string {
 	return capabilityList
 }
 
+// FromSet returns the capabilities listed in an appc capabilities isolator in
+// their "CAP_" prefixed form. An error is returned if any of them isn't
+// supported by the running kernel.
+func FromSet(set types.LinuxCapabilitiesSet) ([]string, error) {
+	caps := make([]string, 0, len(set.Set()))
+	for _, c := range set.Set() {
+		name := strings.ToUpper(string(c))
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		if !isSupported(name) {
+			return nil, fmt.Errorf("unrecognized capability %q", string(c))
+		}
+		caps = append(caps, name)
+	}
+	return caps, nil
+}
+
+func isSupported(name string) bool {
+	for _, c := range capabilityList {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Copied from github.com/syndtr/gocapability, because kurmaOS is started before
 // proc is mounted, this read may fail in its init() func. It is replicated here
 // so we can recalculate the last cap after proc is mounted.
@@ -0,0 +1,29 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+// +build !windows
+
+package capabilities
+
+import (
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestFromSet(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	set, err := types.NewLinuxCapabilitiesRetainSet("CAP_NET_ADMIN", "kill")
+	tt.TestExpectSuccess(t, err)
+	caps, err := FromSet(set)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, caps, []string{"CAP_NET_ADMIN", "CAP_KILL"})
+
+	set, err = types.NewLinuxCapabilitiesRetainSet("CAP_BOGUS")
+	tt.TestExpectSuccess(t, err)
+	_, err = FromSet(set)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `unrecognized capability "CAP_BOGUS"`)
+}
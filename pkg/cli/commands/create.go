@@ -5,12 +5,14 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 
 	"github.com/apcera/kurma/pkg/apiclient"
 	"github.com/apcera/kurma/pkg/cli"
 	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/remote"
 	"github.com/apcera/util/tempfile"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
@@ -29,6 +31,8 @@ var (
 	createManifestFile string
 	createName         string
 	createNetworks     []string
+	createRestart      string
+	createMaxRetries   int
 )
 
 func init() {
@@ -36,6 +40,8 @@ func init() {
 	CreateCmd.Flags().StringVarP(&createName, "name", "n", "", "pod's name")
 	CreateCmd.Flags().StringVarP(&createManifestFile, "manifest", "", "", "specific manifest to use")
 	CreateCmd.Flags().StringSliceVarP(&createNetworks, "net", "", []string{}, "network to attach to the pod")
+	CreateCmd.Flags().StringVarP(&createRestart, "restart", "", "", "restart policy: never, on-failure, or always")
+	CreateCmd.Flags().IntVarP(&createMaxRetries, "restart-max-retries", "", 0, "maximum restarts, 0 for unlimited")
 }
 
 func createPodFromFile(file string) (*apiclient.Image, error) {
@@ -45,25 +51,43 @@ func createPodFromFile(file string) (*apiclient.Image, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		if os.IsNotExist(err) {
-			info, err := cli.GetClient().Info()
+			labels, err := hostLabels()
 			if err != nil {
-				fmt.Printf("Failed to retrieve host information: %v\n", err)
+				fmt.Printf("%v\n", err)
 				os.Exit(1)
 			}
-			labels := make(map[types.ACIdentifier]string)
-			labels[types.ACIdentifier("os")] = "linux"
-			labels[types.ACIdentifier("arch")] = info.Arch
 
-			layers, err := image.Fetch(file, labels, true)
+			// images which aren't on the local filesystem are fetched by the host
+			if !isLocalImage(file) {
+				image, err := pullImage(file, labels, true)
+				if err != nil {
+					fmt.Printf("Failed to retrieve the container image: %v\n", err)
+					os.Exit(1)
+				}
+				return image, nil
+			}
+
+			bar := newProgressBar()
+			opts := &image.FetchOptions{
+				Labels:   make(map[types.ACIdentifier]string),
+				Insecure: true,
+				Progress: func(p remote.Progress) { bar.update(p.URI, p.Downloaded, p.Total) },
+			}
+			for name, value := range labels {
+				opts.Labels[types.ACIdentifier(name)] = value
+			}
+			layers, err := opts.Fetch(file)
+			bar.finish()
 			if err != nil {
 				fmt.Printf("Failed to retrieve the container image: %v\n", err)
 				os.Exit(1)
 			}
-			if len(layers) != 1 {
-				fmt.Println("Multi-layer images currently not supported")
+			image, err := uploadLayers(layers)
+			if err != nil {
+				fmt.Printf("Failed to create the image: %v\n", err)
 				os.Exit(1)
 			}
-			f = layers[0]
+			return image, nil
 		} else {
 			fmt.Printf("Failed to open the container image: %v\n", err)
 			os.Exit(1)
@@ -81,6 +105,39 @@ func createPodFromFile(file string) (*apiclient.Image, error) {
 	return image, nil
 }
 
+// uploadLayers creates each of the fetched layers on the host and returns the
+// first, which is the image that was requested. The layers are created from the
+// bottom up, so each layer's dependencies exist by the time it is created, and
+// they are closed once they are uploaded.
+func uploadLayers(layers []tempfile.ReadSeekCloser) (*apiclient.Image, error) {
+	for _, l := range layers {
+		defer l.Close()
+	}
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no image layers were retrieved")
+	}
+
+	var image *apiclient.Image
+	for i := len(layers) - 1; i >= 0; i-- {
+		var err error
+		image, err = cli.GetClient().CreateImage(layers[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// isLocalImage returns whether the image URI refers to a file or OCI image
+// layout, which must be fetched locally and uploaded to the host.
+func isLocalImage(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "file" || u.Scheme == "oci"
+}
+
 func cmdCreate(cmd *cobra.Command, args []string) {
 	// if a manifest file is given, then read it and use it as the manifest
 	manifest := schema.BlankPodManifest()
@@ -163,6 +220,16 @@ func cmdCreate(cmd *cobra.Command, args []string) {
 		Pod:      manifest,
 		Networks: createNetworks,
 	}
+	if createRestart != "" {
+		req.RestartPolicy = &kschema.RestartPolicy{
+			Policy:     kschema.RestartPolicyName(createRestart),
+			MaxRetries: createMaxRetries,
+		}
+		if err := req.RestartPolicy.AssertValid(); err != nil {
+			fmt.Printf("Invalid restart policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// create the container
 	pod, err := cli.GetClient().CreatePod(req)
@@ -0,0 +1,128 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/apcera/kurma/pkg/cli"
+	"github.com/apcera/termtables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	CredentialsCmd = &cobra.Command{
+		Use:   "credentials",
+		Short: "Manage the credentials used to retrieve images",
+	}
+
+	CredentialsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the hosts which have credentials",
+		Run:   cmdCredentialsList,
+	}
+
+	CredentialsAddCmd = &cobra.Command{
+		Use:   "add HOST",
+		Short: "Set the credentials used for a host",
+		Run:   cmdCredentialsAdd,
+	}
+
+	CredentialsRemoveCmd = &cobra.Command{
+		Use:   "remove HOST",
+		Short: "Remove the credentials for a host",
+		Run:   cmdCredentialsRemove,
+	}
+
+	credentialsUsername string
+	credentialsPassword string
+	credentialsToken    string
+)
+
+func init() {
+	cli.RootCmd.AddCommand(CredentialsCmd)
+	CredentialsCmd.AddCommand(CredentialsListCmd)
+	CredentialsCmd.AddCommand(CredentialsAddCmd)
+	CredentialsCmd.AddCommand(CredentialsRemoveCmd)
+
+	CredentialsAddCmd.Flags().StringVarP(&credentialsUsername, "username", "u", "", "username to authenticate as")
+	CredentialsAddCmd.Flags().StringVarP(&credentialsPassword, "password", "p", "", "password for the username, read from stdin if unset")
+	CredentialsAddCmd.Flags().StringVarP(&credentialsToken, "token", "t", "", "bearer token to authenticate with")
+}
+
+func cmdCredentialsList(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		fmt.Printf("Invalid command options specified.\n")
+		os.Exit(1)
+	}
+
+	creds, err := cli.GetClient().ListRegistryCredentials()
+	if err != nil {
+		fmt.Printf("Failed to get list of credentials: %v\n", err)
+		os.Exit(1)
+	}
+
+	// create the table
+	table := termtables.CreateTable()
+
+	table.AddHeaders("Host", "Authentication")
+
+	for _, c := range creds {
+		auth := "token"
+		if c.Username != "" {
+			auth = "user " + c.Username
+		}
+		table.AddRow(c.Host, auth)
+	}
+	fmt.Printf("%s", table.Render())
+}
+
+func cmdCredentialsAdd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	c := &apiclient.RegistryCredential{
+		Host:     args[0],
+		Username: credentialsUsername,
+		Password: credentialsPassword,
+		Token:    credentialsToken,
+	}
+	if c.Username != "" && c.Password == "" {
+		fmt.Printf("Password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			fmt.Printf("\nFailed to read the password: %v\n", err)
+			os.Exit(1)
+		}
+		c.Password = strings.TrimRight(password, "\r\n")
+	}
+
+	if err := cli.GetClient().AddRegistryCredential(c); err != nil {
+		fmt.Printf("Failed to add the credentials: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Added credentials for %s\n", c.Host)
+}
+
+func cmdCredentialsRemove(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	if err := cli.GetClient().RemoveRegistryCredential(args[0]); err != nil {
+		fmt.Printf("Failed to remove the credentials: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed credentials for %s\n", args[0])
+}
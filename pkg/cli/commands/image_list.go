@@ -4,10 +4,14 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/apcera/kurma/pkg/apiclient"
 	"github.com/apcera/kurma/pkg/cli"
 	"github.com/apcera/termtables"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
 
@@ -23,17 +27,77 @@ var (
 		Run:   cmdImageList,
 	}
 
+	ImageGCCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "Remove images which are not in use",
+		Run:   cmdImageGC,
+	}
+
+	ImageVerifyCmd = &cobra.Command{
+		Use:   "verify HASH",
+		Short: "Verify an image's files against the digests recorded when it was created",
+		Run:   cmdImageVerify,
+	}
+
 	ImageUploadCmd = &cobra.Command{
 		Use:   "upload FILE",
 		Short: "Upload an image to the system",
 		Run:   cmdImageUpload,
 	}
+
+	ImagePullCmd = &cobra.Command{
+		Use:   "pull URI",
+		Short: "Fetch an image onto the system from a remote source",
+		Run:   cmdImagePull,
+	}
+
+	ImageTagCmd = &cobra.Command{
+		Use:   "tag HASH NAME[:TAG]",
+		Short: "Tag an image with a name and tag",
+		Run:   cmdImageTag,
+	}
+
+	ImageUntagCmd = &cobra.Command{
+		Use:   "untag NAME[:TAG]",
+		Short: "Remove a tag from an image",
+		Run:   cmdImageUntag,
+	}
+
+	ImageExportCmd = &cobra.Command{
+		Use:   "export HASH",
+		Short: "Export an image from the system as an ACI",
+		Long: `Export an image from the system as an ACI. By default the image is
+merged with its dependencies into a single ACI which can be run on its own.
+
+With --dependencies=false only the image itself is exported. The exported ACI
+has a different hash than the image, so images which depend on it by its hash
+won't use it.`,
+		Run: cmdImageExport,
+	}
+
+	imageExportOutput       string
+	imageExportDependencies bool
+	imagePullInsecure       bool
+	imagePullLabels         []string
 )
 
 func init() {
 	cli.RootCmd.AddCommand(ImageCmd)
 	ImageCmd.AddCommand(ImageUploadCmd)
 	ImageCmd.AddCommand(ImageListCmd)
+	ImageCmd.AddCommand(ImageGCCmd)
+	ImageCmd.AddCommand(ImageVerifyCmd)
+	ImageCmd.AddCommand(ImageExportCmd)
+	ImageCmd.AddCommand(ImagePullCmd)
+	ImageCmd.AddCommand(ImageTagCmd)
+	ImageCmd.AddCommand(ImageUntagCmd)
+	ImageExportCmd.Flags().StringVarP(&imageExportOutput, "output", "o", "", "file to write the image to")
+	ImageExportCmd.Flags().BoolVarP(&imageExportDependencies, "dependencies", "d", true,
+		"merge the image's dependencies into the exported image")
+	ImagePullCmd.Flags().BoolVarP(&imagePullInsecure, "insecure", "", false,
+		"skip verifying the image's signature, if the host allows it")
+	ImagePullCmd.Flags().StringSliceVarP(&imagePullLabels, "label", "l", []string{},
+		"label used to discover the image, as NAME=VALUE")
 }
 
 func cmdImageList(cmd *cobra.Command, args []string) {
@@ -51,10 +115,11 @@ func cmdImageList(cmd *cobra.Command, args []string) {
 	// create the table
 	table := termtables.CreateTable()
 
-	table.AddHeaders("UUID", "Name")
+	table.AddHeaders("UUID", "Name", "Tags", "Size", "Total Size")
 
 	for _, image := range images {
-		table.AddRow(getShortHash(image.Hash), image.Manifest.Name)
+		table.AddRow(getShortHash(image.Hash), image.Manifest.Name, strings.Join(image.Tags, ", "),
+			humanize.Bytes(uint64(image.Size)), humanize.Bytes(uint64(image.TotalSize)))
 	}
 	fmt.Printf("%s", table.Render())
 }
@@ -90,3 +155,200 @@ func cmdImageUpload(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("Successfully uploaded image %s\n", image.Manifest.Name)
 }
+
+func cmdImagePull(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	labels, err := hostLabels()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	for _, label := range imagePullLabels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Printf("Invalid label %q, expected NAME=VALUE\n", label)
+			os.Exit(1)
+		}
+		labels[parts[0]] = parts[1]
+	}
+
+	image, err := pullImage(args[0], labels, imagePullInsecure)
+	if err != nil {
+		fmt.Printf("Failed to fetch the image: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Fetched image %s (%s)\n", image.Manifest.Name, getShortHash(image.Hash))
+}
+
+// hostLabels returns the labels used to discover images for the host.
+func hostLabels() (map[string]string, error) {
+	info, err := cli.GetClient().Info()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve host information: %v", err)
+	}
+	return map[string]string{"os": "linux", "arch": info.Arch}, nil
+}
+
+// pullImage has the host fetch the image, showing the progress of its
+// download.
+func pullImage(uri string, labels map[string]string, insecure bool) (*apiclient.Image, error) {
+	req := &apiclient.ImageFetchRequest{
+		URI:      uri,
+		Labels:   labels,
+		Insecure: insecure,
+	}
+	bar := newProgressBar()
+	image, err := cli.GetClient().FetchImage(req, func(p *apiclient.ImageFetchProgress) {
+		bar.update(p.URI, p.Downloaded, p.Total)
+	})
+	bar.finish()
+	return image, err
+}
+
+func cmdImageTag(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	hash, err := resolveImageHash(args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cli.GetClient().TagImage(hash, args[1]); err != nil {
+		fmt.Printf("Failed to tag the image: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Tagged image %s as %s\n", getShortHash(hash), args[1])
+}
+
+func cmdImageUntag(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	if err := cli.GetClient().UntagImage(args[0]); err != nil {
+		fmt.Printf("Failed to remove the tag: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed tag %s\n", args[0])
+}
+
+func cmdImageGC(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		fmt.Printf("Invalid command options specified.\n")
+		os.Exit(1)
+	}
+
+	deleted, err := cli.GetClient().GarbageCollectImages()
+	for _, hash := range deleted {
+		fmt.Printf("Deleted image %s\n", getShortHash(hash))
+	}
+	if err != nil {
+		fmt.Printf("Failed to remove unused images: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed %d unused images\n", len(deleted))
+}
+
+func cmdImageVerify(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	hash, err := resolveImageHash(args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	if err := cli.GetClient().VerifyImage(hash); err != nil {
+		fmt.Printf("Failed to verify the image: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Image %s verified successfully\n", getShortHash(hash))
+}
+
+func cmdImageExport(cmd *cobra.Command, args []string) {
+	if len(args) != 1 || imageExportOutput == "" {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	hash, err := resolveImageHash(args[0])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+
+	r, err := cli.GetClient().ExportImage(hash, imageExportDependencies)
+	if err != nil {
+		fmt.Printf("Failed to export the image: %v\n", err)
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	f, err := os.Create(imageExportOutput)
+	if err != nil {
+		fmt.Printf("Failed to create the output file: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(imageExportOutput)
+		fmt.Printf("Failed to export the image: %v\n", err)
+		os.Exit(1)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(imageExportOutput)
+		fmt.Printf("Failed to write the image: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported image %s to %s\n", getShortHash(hash), imageExportOutput)
+}
+
+// resolveImageHash expands a shortened image hash, as shown by the image
+// list, into the full hash.
+func resolveImageHash(prefix string) (string, error) {
+	images, err := cli.GetClient().ListImages()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get list of images: %v", err)
+	}
+
+	var matches []string
+	for _, image := range images {
+		if image.Hash == prefix {
+			return image.Hash, nil
+		}
+		if strings.HasPrefix(image.Hash, prefix) {
+			matches = append(matches, image.Hash)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("No image matches %q", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("Multiple images match %q", prefix)
+	}
+}
@@ -41,7 +41,7 @@ func cmdList(cmd *cobra.Command, args []string) {
 	// create the table
 	table := termtables.CreateTable()
 
-	table.AddHeaders("UUID", "Name", "Apps", "State", "IP(s)")
+	table.AddHeaders("UUID", "Name", "Apps", "App Status", "State", "IP(s)")
 	sort.Sort(sortedPods(pods))
 
 	for n, pod := range pods {
@@ -53,10 +53,11 @@ func cmdList(cmd *cobra.Command, args []string) {
 		}
 
 		for i, app := range pod.Pod.Apps {
+			status := appStatusString(pod, app.Name.String())
 			if i == 0 {
-				table.AddRow(pod.UUID, pod.Name, app.Name.String(), pod.State, strings.Join(ips, " "))
+				table.AddRow(pod.UUID, pod.Name, app.Name.String(), status, pod.State, strings.Join(ips, " "))
 			} else {
-				table.AddRow("", "", app.Name.String(), "")
+				table.AddRow("", "", app.Name.String(), status, "")
 			}
 		}
 		if n < len(pods)-1 {
@@ -67,6 +68,31 @@ func cmdList(cmd *cobra.Command, args []string) {
 
 }
 
+// appStatusString returns a short description of the named app's status
+// within the pod, such as whether it is running or the code it exited with.
+func appStatusString(pod *apiclient.Pod, name string) string {
+	for _, app := range pod.Apps {
+		if app.Name != name {
+			continue
+		}
+
+		var status string
+		switch {
+		case app.Exited:
+			status = fmt.Sprintf("exited (%d)", app.ExitCode)
+		case app.Pid > 0:
+			status = "running"
+		default:
+			status = "pending"
+		}
+		if app.Restarts > 0 {
+			status = fmt.Sprintf("%s, %d restarts", status, app.Restarts)
+		}
+		return status
+	}
+	return ""
+}
+
 type sortedPods []*apiclient.Pod
 
 func (a sortedPods) Len() int      { return len(a) }
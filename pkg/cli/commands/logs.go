@@ -0,0 +1,61 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/apcera/kurma/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	LogsCmd = &cobra.Command{
+		Use:   "logs UUID [APP]",
+		Short: "Show the output of a pod's app, or of its stager",
+		Run:   cmdLogs,
+	}
+
+	logsFollow bool
+	logsTail   int
+)
+
+func init() {
+	cli.RootCmd.AddCommand(LogsCmd)
+	LogsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "follow new output")
+	LogsCmd.Flags().IntVarP(&logsTail, "tail", "t", 0, "only show the last N lines")
+}
+
+func cmdLogs(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	var appName string
+	if len(args) == 2 {
+		appName = args[1]
+	}
+
+	conn, err := cli.GetClient().PodLogs(args[0], appName, logsTail, logsFollow)
+	if err != nil {
+		fmt.Printf("Failed to retrieve logs: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Close the connection on interrupt so the server stops following.
+	signalc := make(chan os.Signal, 1)
+	signal.Notify(signalc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalc
+		conn.Close()
+	}()
+
+	io.Copy(os.Stdout, conn)
+	conn.Close()
+}
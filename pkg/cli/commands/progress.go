@@ -0,0 +1,84 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	progressBarWidth    = 30
+	progressBarInterval = 100 * time.Millisecond
+)
+
+// progressBar renders the progress of image downloads, with a line for each
+// image downloaded.
+type progressBar struct {
+	w       io.Writer
+	uri     string
+	drawn   time.Time
+	pending string
+	lock    sync.Mutex
+}
+
+func newProgressBar() *progressBar {
+	return &progressBar{w: os.Stderr}
+}
+
+// update redraws the bar for the image. Updates for the same image are
+// throttled, except for the one completing it.
+func (p *progressBar) update(uri string, downloaded, total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if uri != p.uri {
+		p.finishLine()
+		p.uri = uri
+	}
+	p.pending = formatProgress(uri, downloaded, total)
+	done := total >= 0 && downloaded >= total
+	if !done && time.Since(p.drawn) < progressBarInterval {
+		return
+	}
+	fmt.Fprintf(p.w, "\r%s", p.pending)
+	p.drawn = time.Now()
+}
+
+// finish completes the line of the last image downloaded.
+func (p *progressBar) finish() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.finishLine()
+	p.uri = ""
+}
+
+func (p *progressBar) finishLine() {
+	if p.uri == "" {
+		return
+	}
+	fmt.Fprintf(p.w, "\r%s\n", p.pending)
+}
+
+// formatProgress returns the line showing how much of the image has been
+// downloaded. A bar is only shown when the image's size is known.
+func formatProgress(uri string, downloaded, total int64) string {
+	name := path.Base(uri)
+	if total <= 0 {
+		return fmt.Sprintf("%s %s", name, humanize.Bytes(uint64(downloaded)))
+	}
+	filled := int(downloaded * progressBarWidth / total)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	return fmt.Sprintf("%s [%s%s] %s / %s", name,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		humanize.Bytes(uint64(downloaded)), humanize.Bytes(uint64(total)))
+}
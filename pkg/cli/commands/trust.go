@@ -0,0 +1,117 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/cli"
+	"github.com/apcera/termtables"
+	"github.com/spf13/cobra"
+)
+
+var (
+	TrustCmd = &cobra.Command{
+		Use:   "trust",
+		Short: "Manage the keys trusted to sign images",
+	}
+
+	TrustListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the trusted keys",
+		Run:   cmdTrustList,
+	}
+
+	TrustAddCmd = &cobra.Command{
+		Use:   "add FILE",
+		Short: "Trust the armored public keys within the file",
+		Run:   cmdTrustAdd,
+	}
+
+	TrustRemoveCmd = &cobra.Command{
+		Use:   "remove FINGERPRINT",
+		Short: "Stop trusting a key",
+		Run:   cmdTrustRemove,
+	}
+
+	trustPrefix string
+)
+
+func init() {
+	cli.RootCmd.AddCommand(TrustCmd)
+	TrustCmd.AddCommand(TrustListCmd)
+	TrustCmd.AddCommand(TrustAddCmd)
+	TrustCmd.AddCommand(TrustRemoveCmd)
+
+	TrustAddCmd.Flags().StringVarP(&trustPrefix, "prefix", "", "", "image name prefix the keys are trusted for, all images if unset")
+	TrustRemoveCmd.Flags().StringVarP(&trustPrefix, "prefix", "", "", "image name prefix the key is trusted for")
+}
+
+func cmdTrustList(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		fmt.Printf("Invalid command options specified.\n")
+		os.Exit(1)
+	}
+
+	keys, err := cli.GetClient().ListTrustedKeys()
+	if err != nil {
+		fmt.Printf("Failed to get list of trusted keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	// create the table
+	table := termtables.CreateTable()
+
+	table.AddHeaders("Prefix", "Fingerprint", "Identities")
+
+	for _, key := range keys {
+		prefix := key.Prefix
+		if prefix == "" {
+			prefix = "(all images)"
+		}
+		table.AddRow(prefix, key.Fingerprint, strings.Join(key.Identities, ", "))
+	}
+	fmt.Printf("%s", table.Render())
+}
+
+func cmdTrustAdd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	b, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Failed to read the keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	keys, err := cli.GetClient().AddTrustedKeys(trustPrefix, string(b))
+	if err != nil {
+		fmt.Printf("Failed to trust the keys: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, key := range keys {
+		fmt.Printf("Trusted key %s (%s)\n", key.Fingerprint, strings.Join(key.Identities, ", "))
+	}
+}
+
+func cmdTrustRemove(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	if err := cli.GetClient().RemoveTrustedKey(trustPrefix, args[0]); err != nil {
+		fmt.Printf("Failed to remove the key: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Removed key %s\n", args[0])
+}
@@ -0,0 +1,129 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/cli"
+	"github.com/apcera/termtables"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	VolumeCmd = &cobra.Command{
+		Use:   "volume",
+		Short: "Manage named volumes within the system",
+	}
+
+	VolumeListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List named volumes within the system",
+		Run:   cmdVolumeList,
+	}
+
+	VolumeShowCmd = &cobra.Command{
+		Use:   "show NAME",
+		Short: "Show a named volume's size and the pods using it",
+		Run:   cmdVolumeShow,
+	}
+
+	VolumeCreateCmd = &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a named volume",
+		Run:   cmdVolumeCreate,
+	}
+
+	VolumeDeleteCmd = &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a named volume which is not in use",
+		Run:   cmdVolumeDelete,
+	}
+)
+
+func init() {
+	cli.RootCmd.AddCommand(VolumeCmd)
+	VolumeCmd.AddCommand(VolumeListCmd)
+	VolumeCmd.AddCommand(VolumeShowCmd)
+	VolumeCmd.AddCommand(VolumeCreateCmd)
+	VolumeCmd.AddCommand(VolumeDeleteCmd)
+}
+
+func cmdVolumeList(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		fmt.Printf("Invalid command options specified.\n")
+		os.Exit(1)
+	}
+
+	volumes, err := cli.GetClient().ListVolumes()
+	if err != nil {
+		fmt.Printf("Failed to get list of volumes: %v\n", err)
+		os.Exit(1)
+	}
+
+	// create the table
+	table := termtables.CreateTable()
+
+	table.AddHeaders("Name", "Size", "Pods")
+
+	for _, volume := range volumes {
+		table.AddRow(volume.Name, humanize.Bytes(uint64(volume.Size)), len(volume.Pods))
+	}
+	fmt.Printf("%s", table.Render())
+}
+
+func cmdVolumeShow(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Must specify the name of the volume to show.\n")
+		cmd.Help()
+		return
+	}
+
+	volume, err := cli.GetClient().GetVolume(args[0])
+	if err != nil {
+		fmt.Printf("Failed to retrieve volume: %v\n", err)
+		os.Exit(1)
+	}
+
+	pods := "none"
+	if len(volume.Pods) > 0 {
+		pods = strings.Join(volume.Pods, ", ")
+	}
+	fmt.Printf("Volume %s:\n\n", volume.Name)
+	fmt.Printf("Size: %s\n", humanize.Bytes(uint64(volume.Size)))
+	fmt.Printf("Pods: %s\n", pods)
+}
+
+func cmdVolumeCreate(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	volume, err := cli.GetClient().CreateVolume(args[0])
+	if err != nil {
+		fmt.Printf("Failed to create the volume: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Created volume %s\n", volume.Name)
+}
+
+func cmdVolumeDelete(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		fmt.Printf("Invalid command options specified.\n")
+		cmd.Help()
+		return
+	}
+
+	if err := cli.GetClient().DeleteVolume(args[0]); err != nil {
+		fmt.Printf("Failed to delete the volume: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Deleted volume %s\n", args[0])
+}
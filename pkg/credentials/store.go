@@ -0,0 +1,252 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package credentials
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DockerHub is the host which credentials for Docker Hub are stored
+	// under. Credentials for it are used with any of Docker Hub's hosts.
+	DockerHub = "docker.io"
+)
+
+var (
+	// dockerHubHosts are the hosts which Docker Hub is accessed through.
+	dockerHubHosts = map[string]bool{
+		DockerHub:              true,
+		"index.docker.io":      true,
+		"registry-1.docker.io": true,
+	}
+)
+
+// Credential holds what is used to authenticate with a host that images are
+// retrieved from. Either a username and password, which are used for HTTP
+// basic authentication and to request registry tokens, or a bearer token is
+// given.
+type Credential struct {
+	// Host is the host, with an optional port, that the credentials are sent
+	// to. Credentials without a port are used for any port on the host.
+	Host string `json:"host"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Token is a bearer token sent in place of a username and password.
+	Token string `json:"token,omitempty"`
+}
+
+// Validate ensures the credential names a host and has a single means of
+// authenticating with it.
+func (c *Credential) Validate() error {
+	if c.Host == "" || strings.ContainsAny(c.Host, "/ ") {
+		return fmt.Errorf("invalid credential host %q", c.Host)
+	}
+	switch {
+	case c.Token != "" && c.Username != "":
+		return fmt.Errorf("credentials for %s must have either a username or a token, not both", c.Host)
+	case c.Token == "" && c.Username == "":
+		return fmt.Errorf("credentials for %s must have a username or a token", c.Host)
+	}
+	return nil
+}
+
+// Header returns the value of the Authorization header which presents the
+// credential.
+func (c *Credential) Header() string {
+	if c.Token != "" {
+		return "Bearer " + c.Token
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+	return "Basic " + auth
+}
+
+// Store holds the credentials for the hosts that images are retrieved from.
+// When it is backed by a file, changes to the credentials are saved to it. A
+// nil Store holds no credentials.
+type Store struct {
+	file        string
+	credentials map[string]*Credential
+	lock        sync.RWMutex
+}
+
+// New creates a Store which loads and saves its credentials to the file, or
+// which only holds them in memory if no file is given.
+func New(file string) (*Store, error) {
+	s := &Store{
+		file:        file,
+		credentials: make(map[string]*Credential),
+	}
+	if file == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the credentials file: %v", err)
+	}
+	var credentials []*Credential
+	if err := json.Unmarshal(b, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse the credentials file: %v", err)
+	}
+	for _, c := range credentials {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+		s.credentials[c.Host] = c
+	}
+	return s, nil
+}
+
+// Add sets the credentials for the credential's host, replacing any it
+// already had.
+func (s *Store) Add(c *Credential) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	cc := *c
+	s.credentials[c.Host] = &cc
+	return s.save()
+}
+
+// Remove removes the credentials for the host.
+func (s *Store) Remove(host string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, exists := s.credentials[host]; !exists {
+		return fmt.Errorf("no credentials are configured for %s", host)
+	}
+	delete(s.credentials, host)
+	return s.save()
+}
+
+// List returns all of the credentials, sorted by host.
+func (s *Store) List() []*Credential {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	credentials := make([]*Credential, 0, len(s.credentials))
+	for _, c := range s.credentials {
+		cc := *c
+		credentials = append(credentials, &cc)
+	}
+	sort.Sort(byHost(credentials))
+	return credentials
+}
+
+// Get returns the credentials used for the host, which may include a port.
+// Credentials for the exact host and port are preferred over those for just
+// the host, and Docker Hub's hosts fall back to those stored for DockerHub. It
+// returns nil if there are none.
+func (s *Store) Get(host string) *Credential {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	c, exists := s.credentials[host]
+	if !exists {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			c, exists = s.credentials[h]
+		}
+	}
+	if !exists && dockerHubHosts[host] {
+		c, exists = s.credentials[DockerHub]
+	}
+	if !exists {
+		return nil
+	}
+	cc := *c
+	return &cc
+}
+
+// Authorize adds the credentials for the request's host to it. It returns
+// whether the host had any. Credentials are only added to HTTPS requests, so
+// they are never sent in the clear.
+func (s *Store) Authorize(req *http.Request) bool {
+	if req.URL.Scheme != "https" {
+		return false
+	}
+	c := s.Get(req.URL.Host)
+	if c == nil {
+		return false
+	}
+	req.Header.Set("Authorization", c.Header())
+	return true
+}
+
+// Headers returns the headers which authenticate requests to each host, in
+// the form used for App Container Image discovery. Discovery sends them on
+// every request to the host, so they must not be used when discovery is
+// allowed to fall back to plain HTTP.
+func (s *Store) Headers() map[string]http.Header {
+	headers := make(map[string]http.Header)
+	for _, c := range s.List() {
+		headers[c.Host] = http.Header{"Authorization": {c.Header()}}
+	}
+	return headers
+}
+
+// save writes the credentials to the store's file, if it has one. The file is
+// only readable by its owner, since it holds secrets.
+func (s *Store) save() error {
+	if s.file == "" {
+		return nil
+	}
+
+	credentials := make([]*Credential, 0, len(s.credentials))
+	for _, c := range s.credentials {
+		credentials = append(credentials, c)
+	}
+	sort.Sort(byHost(credentials))
+	b, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.file), ".credentials")
+	if err != nil {
+		return fmt.Errorf("failed to save the credentials: %v", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save the credentials: %v", err)
+	}
+	return nil
+}
+
+type byHost []*Credential
+
+func (c byHost) Len() int           { return len(c) }
+func (c byHost) Less(i, j int) bool { return c[i].Host < c[j].Host }
+func (c byHost) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
@@ -0,0 +1,79 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package credentials
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestStore(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	file := filepath.Join(tt.TempDir(t), "credentials.json")
+	store, err := New(file)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(store.List()), 0)
+
+	tt.TestExpectSuccess(t, store.Add(&Credential{Host: "quay.io", Username: "user", Password: "pass"}))
+	tt.TestExpectSuccess(t, store.Add(&Credential{Host: "example.com:8443", Token: "secret"}))
+	tt.TestExpectSuccess(t, store.Add(&Credential{Host: DockerHub, Username: "hub", Password: "pass"}))
+
+	tt.TestExpectError(t, store.Add(&Credential{Host: "quay.io"}))
+	tt.TestExpectError(t, store.Add(&Credential{Host: "quay.io", Username: "user", Token: "secret"}))
+	tt.TestExpectError(t, store.Add(&Credential{Host: "example.com/path", Token: "secret"}))
+
+	// secrets are only readable by their owner
+	fi, err := os.Stat(file)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, fi.Mode().Perm(), os.FileMode(0600))
+
+	// credentials are loaded again from the file
+	store, err = New(file)
+	tt.TestExpectSuccess(t, err)
+	credentials := store.List()
+	tt.TestEqual(t, len(credentials), 3)
+	tt.TestEqual(t, credentials[0].Host, DockerHub)
+	tt.TestEqual(t, credentials[2].Host, "quay.io")
+
+	tt.TestEqual(t, store.Get("quay.io:443").Username, "user")
+	tt.TestEqual(t, store.Get("registry-1.docker.io").Username, "hub")
+	tt.TestEqual(t, store.Get("example.com:8443").Token, "secret")
+	tt.TestEqual(t, store.Get("example.com") == nil, true)
+
+	req, err := http.NewRequest("GET", "https://example.com:8443/image.aci", nil)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, store.Authorize(req), true)
+	tt.TestEqual(t, req.Header.Get("Authorization"), "Bearer secret")
+
+	req, err = http.NewRequest("GET", "https://quay.io/image.aci", nil)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, store.Authorize(req), true)
+	username, password, _ := req.BasicAuth()
+	tt.TestEqual(t, []string{username, password}, []string{"user", "pass"})
+
+	// credentials are never added to plain HTTP requests
+	req, err = http.NewRequest("GET", "http://quay.io/image.aci", nil)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, store.Authorize(req), false)
+	tt.TestEqual(t, req.Header.Get("Authorization"), "")
+
+	tt.TestEqual(t, store.Headers()["example.com:8443"].Get("Authorization"), "Bearer secret")
+
+	tt.TestExpectSuccess(t, store.Remove("quay.io"))
+	tt.TestExpectError(t, store.Remove("quay.io"))
+	store, err = New(file)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(store.List()), 2)
+
+	// a nil store has no credentials
+	store = nil
+	tt.TestEqual(t, store.Get("quay.io") == nil, true)
+	tt.TestEqual(t, store.Authorize(req), false)
+	tt.TestEqual(t, len(store.Headers()), 0)
+}
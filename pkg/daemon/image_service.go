@@ -6,8 +6,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/apcera/kurma/pkg/remote"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/gorilla/mux"
 )
 
 type ImageService struct {
@@ -28,6 +38,119 @@ func (s *Server) imageCreateRequest(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (s *Server) imageExportRequest(w http.ResponseWriter, req *http.Request) {
+	hash := mux.Vars(req)["hash"]
+	if s.options.ImageManager.GetImage(hash) == nil {
+		http.Error(w, "Not Found", 404)
+		return
+	}
+	dependencies, _ := strconv.ParseBool(req.URL.Query().Get("dependencies"))
+
+	export := s.options.ImageManager.ExportImage
+	if dependencies {
+		export = s.options.ImageManager.ExportImageTree
+	}
+
+	// Errors can't change the status once the image is streaming, so they are
+	// reported in the trailer.
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Trailer", apiclient.ImageExportErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+	if err := export(hash, w); err != nil {
+		s.log.Errorf("Failed to export image %s: %v", hash, err)
+		w.Header().Set(apiclient.ImageExportErrorTrailer, err.Error())
+	}
+}
+
+// fetchProgressInterval is the minimum time between the progress updates sent
+// for each image being downloaded by an image fetch.
+const fetchProgressInterval = 250 * time.Millisecond
+
+func (s *Server) imageFetchRequest(w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+	var fetchReq apiclient.ImageFetchRequest
+	if err := json.NewDecoder(req.Body).Decode(&fetchReq); err != nil || fetchReq.URI == "" {
+		http.Error(w, "Invalid image fetch request", 400)
+		return
+	}
+
+	// The progress is streamed as the image is downloaded, followed by the
+	// image or the error fetching it.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	var lock sync.Mutex
+	encoder := json.NewEncoder(w)
+	send := func(status *apiclient.ImageFetchStatus) {
+		lock.Lock()
+		defer lock.Unlock()
+		encoder.Encode(status)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	sent := make(map[string]time.Time)
+	progress := func(p remote.Progress) {
+		lock.Lock()
+		last := sent[p.URI]
+		done := p.Total >= 0 && p.Downloaded >= p.Total
+		if !done && time.Since(last) < fetchProgressInterval {
+			lock.Unlock()
+			return
+		}
+		sent[p.URI] = time.Now()
+		lock.Unlock()
+
+		send(&apiclient.ImageFetchStatus{Progress: &apiclient.ImageFetchProgress{
+			URI:        p.URI,
+			Downloaded: p.Downloaded,
+			Total:      p.Total,
+		}})
+	}
+
+	image, err := s.fetchImage(&fetchReq, progress)
+	if err != nil {
+		s.log.Errorf("Failed to fetch image %q: %v", fetchReq.URI, err)
+		send(&apiclient.ImageFetchStatus{Error: err.Error()})
+		return
+	}
+	send(&apiclient.ImageFetchStatus{Image: image})
+}
+
+// fetchImage retrieves and loads the requested image on the host.
+func (s *Server) fetchImage(fetchReq *apiclient.ImageFetchRequest, progress remote.ProgressFunc) (*apiclient.Image, error) {
+	if s.options.ImageFetcher == nil {
+		return nil, fmt.Errorf("image fetching is not enabled")
+	}
+	if fetchReq.URI == "" {
+		return nil, fmt.Errorf("no image URI was specified")
+	}
+
+	req := &image.FetchRequest{
+		URI:      fetchReq.URI,
+		Labels:   make(map[types.ACIdentifier]string),
+		Insecure: fetchReq.Insecure,
+		Progress: progress,
+	}
+	for name, value := range fetchReq.Labels {
+		id, err := types.NewACIdentifier(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label %q: %v", name, err)
+		}
+		req.Labels[*id] = value
+	}
+
+	hash, manifest, err := s.options.ImageFetcher.Fetch(req)
+	if err != nil {
+		return nil, err
+	}
+	imageSize, err := s.options.ImageManager.GetImageSize(hash)
+	if err != nil {
+		return nil, err
+	}
+	return newImage(hash, manifest, imageSize, s.options.ImageManager.ImageTags(hash)), nil
+}
+
 func (s *ImageService) List(r *http.Request, args *apiclient.None, resp *apiclient.ImageListResponse) error {
 	images := s.server.options.ImageManager.ListImages()
 	resp.Images = make([]*apiclient.Image, 0, len(images))
@@ -37,7 +160,7 @@ func (s *ImageService) List(r *http.Request, args *apiclient.None, resp *apiclie
 			s.server.log.Warnf("Failed to get image size %s: %v", hash, err)
 			continue
 		}
-		resp.Images = append(resp.Images, &apiclient.Image{Hash: hash, Manifest: image, Size: imageSize})
+		resp.Images = append(resp.Images, newImage(hash, image, imageSize, s.server.options.ImageManager.ImageTags(hash)))
 	}
 	return nil
 }
@@ -54,7 +177,45 @@ func (s *ImageService) Get(r *http.Request, hash *string, resp *apiclient.ImageR
 	if err != nil {
 		return err
 	}
-	resp.Image = &apiclient.Image{Hash: *hash, Manifest: image, Size: imageSize}
+	resp.Image = newImage(*hash, image, imageSize, s.server.options.ImageManager.ImageTags(*hash))
+	return nil
+}
+
+func (s *ImageService) Tag(r *http.Request, req *apiclient.ImageTagRequest, resp *apiclient.None) error {
+	name, tag := imagestore.ParseReference(req.Reference)
+	return s.server.options.ImageManager.TagImage(req.Hash, name, tag)
+}
+
+func (s *ImageService) Untag(r *http.Request, reference *string, resp *apiclient.None) error {
+	if reference == nil {
+		return fmt.Errorf("no image reference was specified")
+	}
+	name, tag := imagestore.ParseReference(*reference)
+	return s.server.options.ImageManager.UntagImage(name, tag)
+}
+
+func (s *ImageService) Resolve(r *http.Request, reference *string, resp *apiclient.ImageResponse) error {
+	if reference == nil {
+		return fmt.Errorf("no image reference was specified")
+	}
+	hash, image := s.server.resolveImage(*reference)
+	if image == nil {
+		return fmt.Errorf("image %q not found", *reference)
+	}
+	imageSize, err := s.server.options.ImageManager.GetImageSize(hash)
+	if err != nil {
+		return err
+	}
+	resp.Image = newImage(hash, image, imageSize, s.server.options.ImageManager.ImageTags(hash))
+	return nil
+}
+
+func (s *ImageService) Fetch(r *http.Request, req *apiclient.ImageFetchRequest, resp *apiclient.ImageResponse) error {
+	image, err := s.server.fetchImage(req, nil)
+	if err != nil {
+		return err
+	}
+	resp.Image = image
 	return nil
 }
 
@@ -64,3 +225,29 @@ func (s *ImageService) Delete(r *http.Request, hash *string, resp *apiclient.Ima
 	}
 	return s.server.options.ImageManager.DeleteImage(*hash)
 }
+
+func (s *ImageService) Verify(r *http.Request, hash *string, resp *apiclient.None) error {
+	if hash == nil {
+		return fmt.Errorf("no image hash was specified")
+	}
+	return s.server.options.ImageManager.VerifyImage(*hash)
+}
+
+func (s *ImageService) GarbageCollect(r *http.Request, args *apiclient.None, resp *apiclient.ImageGCResponse) error {
+	deleted, err := s.server.options.ImageManager.GarbageCollect()
+	resp.Deleted = deleted
+	return err
+}
+
+// newImage converts the image's manifest, sizes and tags into the form returned by
+// the API.
+func newImage(hash string, manifest *schema.ImageManifest, size *backend.ImageSize, tags []string) *apiclient.Image {
+	return &apiclient.Image{
+		Hash:           hash,
+		Manifest:       manifest,
+		Size:           size.Extracted,
+		CompressedSize: size.Compressed,
+		TotalSize:      size.Total,
+		Tags:           tags,
+	}
+}
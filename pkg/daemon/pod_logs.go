@@ -0,0 +1,63 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package daemon
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/apcera/util/wsconn"
+	"github.com/appc/spec/schema/types"
+	"github.com/gorilla/mux"
+)
+
+func (s *Server) podLogsRequest(w http.ResponseWriter, req *http.Request) {
+	// get the pod
+	pod := s.options.PodManager.Pod(mux.Vars(req)["uuid"])
+	if pod == nil {
+		http.Error(w, "Not Found", 404)
+		return
+	}
+
+	// parse the options
+	query := req.URL.Query()
+	appName := query.Get("app")
+	if appName != "" && pod.PodManifest().Apps.Get(types.ACName(appName)) == nil {
+		http.Error(w, "App Not Found", 404)
+		return
+	}
+	tail := 0
+	if t := query.Get("tail"); t != "" {
+		var err error
+		tail, err = strconv.Atoi(t)
+		if err != nil || tail < 0 {
+			http.Error(w, "Invalid tail value", 400)
+			return
+		}
+	}
+	follow, _ := strconv.ParseBool(query.Get("follow"))
+
+	ws, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		s.log.Errorf("Failed to upgrade logs connection: %v", err)
+		return
+	}
+
+	// create the websocket connection
+	wsc := wsconn.NewWebsocketConnection(ws)
+	defer wsc.Close()
+
+	// Watch for the client to disconnect so following can be stopped.
+	done := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, wsc)
+		close(done)
+	}()
+
+	if err := pod.Logs(appName, tail, follow, wsc, done); err != nil {
+		s.log.Warnf("Failed to stream logs for pod %s: %v", pod.UUID(), err)
+	}
+	s.log.Debugf("Logs request finished")
+}
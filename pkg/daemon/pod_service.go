@@ -8,6 +8,9 @@ import (
 
 	"github.com/apcera/kurma/pkg/apiclient"
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
 )
 
 type PodService struct {
@@ -15,7 +18,19 @@ type PodService struct {
 }
 
 func (s *PodService) Create(r *http.Request, req *apiclient.PodCreateRequest, resp *apiclient.PodResponse) error {
-	c, err := s.server.options.PodManager.Create(req.Name, req.Pod, nil)
+	if req.Pod == nil {
+		return fmt.Errorf("no pod manifest was specified")
+	}
+	if err := s.server.resolvePodImages(req); err != nil {
+		return err
+	}
+
+	options := &backend.PodOptions{
+		StagerHash:    req.StagerImageHash,
+		Networks:      req.Networks,
+		RestartPolicy: req.RestartPolicy,
+	}
+	c, err := s.server.options.PodManager.Create(req.Name, req.Pod, options)
 	if err != nil {
 		return err
 	}
@@ -55,12 +70,74 @@ func (s *PodService) Destroy(r *http.Request, uuid *string, ret *apiclient.None)
 	return pod.Stop()
 }
 
+// resolvePodImages sets the hashes of the images of the pod's apps which were
+// given by reference. Apps which only give the name of their image are
+// resolved by its version label, or the name's latest tag.
+func (s *Server) resolvePodImages(req *apiclient.PodCreateRequest) error {
+	for appName := range req.Images {
+		if req.Pod.Apps.Get(types.ACName(appName)) == nil {
+			return fmt.Errorf("app %q was not found in the pod", appName)
+		}
+	}
+
+	for i := range req.Pod.Apps {
+		app := &req.Pod.Apps[i]
+		reference, exists := req.Images[app.Name.String()]
+		if !exists {
+			if !app.Image.ID.Empty() || app.Image.Name == nil {
+				continue
+			}
+			reference = app.Image.Name.String()
+			if version, ok := app.Image.Labels.Get("version"); ok {
+				reference += ":" + version
+			}
+		}
+
+		hash, image := s.resolveImage(reference)
+		if image == nil {
+			return fmt.Errorf("image %q for app %q not found", reference, app.Name)
+		}
+		id, err := types.NewHash(hash)
+		if err != nil {
+			return err
+		}
+		app.Image.ID = *id
+		app.Image.Name = &image.Name
+	}
+	return nil
+}
+
+// resolveImage returns the hash and manifest of the image the reference, in
+// the form "name[:tag]", refers to.
+func (s *Server) resolveImage(reference string) (string, *schema.ImageManifest) {
+	name, tag := imagestore.ParseReference(reference)
+	return s.options.ImageManager.ResolveImage(name, tag)
+}
+
 func exportPod(c backend.Pod) *apiclient.Pod {
-	return &apiclient.Pod{
+	pod := &apiclient.Pod{
 		UUID:     c.UUID(),
 		Name:     c.Name(),
 		Pod:      c.PodManifest(),
 		Networks: c.Networks(),
 		State:    apiclient.State(c.State().String()),
 	}
+
+	// The status is best effort, as the stager may not have written its state
+	// yet or may be in the process of being torn down.
+	if status, err := c.Status(); err == nil {
+		pod.StagerState = status.StagerState
+		pod.Apps = make([]*apiclient.AppStatus, len(status.Apps))
+		for i, app := range status.Apps {
+			pod.Apps[i] = &apiclient.AppStatus{
+				Name:       app.Name,
+				Pid:        app.Pid,
+				Exited:     app.Exited,
+				ExitCode:   app.ExitCode,
+				ExitReason: app.ExitReason,
+				Restarts:   app.Restarts,
+			}
+		}
+	}
+	return pod
 }
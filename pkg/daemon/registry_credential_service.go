@@ -0,0 +1,67 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/apcera/kurma/pkg/credentials"
+)
+
+type RegistryCredentialService struct {
+	server *Server
+}
+
+func (s *RegistryCredentialService) List(r *http.Request, args *apiclient.None, resp *apiclient.RegistryCredentialListResponse) error {
+	store, err := s.credentialStore()
+	if err != nil {
+		return err
+	}
+
+	// secrets are never returned
+	creds := store.List()
+	resp.Credentials = make([]*apiclient.RegistryCredential, 0, len(creds))
+	for _, c := range creds {
+		resp.Credentials = append(resp.Credentials, &apiclient.RegistryCredential{
+			Host:     c.Host,
+			Username: c.Username,
+		})
+	}
+	return nil
+}
+
+func (s *RegistryCredentialService) Add(r *http.Request, req *apiclient.RegistryCredential, resp *apiclient.None) error {
+	if req == nil {
+		return fmt.Errorf("no credentials were specified")
+	}
+	store, err := s.credentialStore()
+	if err != nil {
+		return err
+	}
+	return store.Add(&credentials.Credential{
+		Host:     req.Host,
+		Username: req.Username,
+		Password: req.Password,
+		Token:    req.Token,
+	})
+}
+
+func (s *RegistryCredentialService) Remove(r *http.Request, host *string, resp *apiclient.None) error {
+	if host == nil || *host == "" {
+		return fmt.Errorf("no host was specified")
+	}
+	store, err := s.credentialStore()
+	if err != nil {
+		return err
+	}
+	return store.Remove(*host)
+}
+
+func (s *RegistryCredentialService) credentialStore() (*credentials.Store, error) {
+	if s.server.options.CredentialStore == nil {
+		return nil, fmt.Errorf("no registry credential store is configured")
+	}
+	return s.server.options.CredentialStore, nil
+}
@@ -9,6 +9,9 @@ import (
 	"path/filepath"
 
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/image"
+	"github.com/apcera/kurma/pkg/trust"
 	"github.com/apcera/logray"
 	"github.com/gorilla/mux"
 	rpc "github.com/gorilla/rpc/v2"
@@ -20,6 +23,9 @@ import (
 type Options struct {
 	ImageManager         backend.ImageManager
 	PodManager           backend.PodManager
+	TrustStore           *trust.Store
+	CredentialStore      *credentials.Store
+	ImageFetcher         *image.Coordinator
 	SocketRemoveIfExists bool
 	SocketFile           string
 	SocketGroup          *int
@@ -79,12 +85,18 @@ func (s *Server) Start() error {
 	svr.RegisterCodec(json2.NewCodec(), "application/json")
 	svr.RegisterService(&PodService{server: s}, "Pods")
 	svr.RegisterService(&ImageService{server: s}, "Images")
+	svr.RegisterService(&VolumeService{server: s}, "Volumes")
+	svr.RegisterService(&TrustedKeyService{server: s}, "TrustedKeys")
+	svr.RegisterService(&RegistryCredentialService{server: s}, "RegistryCredentials")
 
 	router := mux.NewRouter()
 	router.Handle("/rpc", svr)
 	router.HandleFunc("/info", s.infoRequest).Methods("GET")
 	router.HandleFunc("/containers/enter", s.containerEnterRequest).Methods("GET")
+	router.HandleFunc("/pods/{uuid}/logs", s.podLogsRequest).Methods("GET")
 	router.HandleFunc("/images/create", s.imageCreateRequest).Methods("POST")
+	router.HandleFunc("/images/fetch", s.imageFetchRequest).Methods("POST")
+	router.HandleFunc("/images/{hash}/export", s.imageExportRequest).Methods("GET")
 
 	s.log.Debug("Server is ready")
 	go func() {
@@ -0,0 +1,75 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/apcera/kurma/pkg/trust"
+)
+
+type TrustedKeyService struct {
+	server *Server
+}
+
+func (s *TrustedKeyService) List(r *http.Request, args *apiclient.None, resp *apiclient.TrustedKeyListResponse) error {
+	store, err := s.trustStore()
+	if err != nil {
+		return err
+	}
+	keys, err := store.Keys()
+	if err != nil {
+		return err
+	}
+	resp.Keys = apiTrustedKeys(keys)
+	return nil
+}
+
+func (s *TrustedKeyService) Add(r *http.Request, req *apiclient.TrustedKeyAddRequest, resp *apiclient.TrustedKeyListResponse) error {
+	if req == nil || req.Key == "" {
+		return fmt.Errorf("no key was specified")
+	}
+	store, err := s.trustStore()
+	if err != nil {
+		return err
+	}
+	keys, err := store.AddKeys(req.Prefix, strings.NewReader(req.Key))
+	if err != nil {
+		return err
+	}
+	resp.Keys = apiTrustedKeys(keys)
+	return nil
+}
+
+func (s *TrustedKeyService) Remove(r *http.Request, req *apiclient.TrustedKeyRemoveRequest, resp *apiclient.None) error {
+	if req == nil || req.Fingerprint == "" {
+		return fmt.Errorf("no key fingerprint was specified")
+	}
+	store, err := s.trustStore()
+	if err != nil {
+		return err
+	}
+	return store.RemoveKey(req.Prefix, req.Fingerprint)
+}
+
+func (s *TrustedKeyService) trustStore() (*trust.Store, error) {
+	if s.server.options.TrustStore == nil {
+		return nil, fmt.Errorf("no trusted keys directory is configured")
+	}
+	return s.server.options.TrustStore, nil
+}
+
+func apiTrustedKeys(keys []*trust.Key) []*apiclient.TrustedKey {
+	apiKeys := make([]*apiclient.TrustedKey, 0, len(keys))
+	for _, key := range keys {
+		apiKeys = append(apiKeys, &apiclient.TrustedKey{
+			Prefix:      key.Prefix,
+			Fingerprint: key.Fingerprint,
+			Identities:  key.Identities,
+		})
+	}
+	return apiKeys
+}
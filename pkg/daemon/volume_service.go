@@ -0,0 +1,66 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/apcera/kurma/pkg/apiclient"
+	"github.com/apcera/kurma/pkg/backend"
+)
+
+type VolumeService struct {
+	server *Server
+}
+
+func (s *VolumeService) Create(r *http.Request, name *string, resp *apiclient.VolumeResponse) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	volume, err := s.server.options.PodManager.CreateVolume(*name)
+	if err != nil {
+		return err
+	}
+	resp.Volume = apiVolume(volume)
+	return nil
+}
+
+func (s *VolumeService) List(r *http.Request, args *apiclient.None, resp *apiclient.VolumeListResponse) error {
+	volumes, err := s.server.options.PodManager.Volumes()
+	if err != nil {
+		return err
+	}
+	resp.Volumes = make([]*apiclient.Volume, 0, len(volumes))
+	for _, volume := range volumes {
+		resp.Volumes = append(resp.Volumes, apiVolume(volume))
+	}
+	return nil
+}
+
+func (s *VolumeService) Get(r *http.Request, name *string, resp *apiclient.VolumeResponse) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	volume, err := s.server.options.PodManager.Volume(*name)
+	if err != nil {
+		return err
+	}
+	resp.Volume = apiVolume(volume)
+	return nil
+}
+
+func (s *VolumeService) Delete(r *http.Request, name *string, resp *apiclient.None) error {
+	if name == nil {
+		return fmt.Errorf("no volume name was specified")
+	}
+	return s.server.options.PodManager.DeleteVolume(*name)
+}
+
+func apiVolume(volume *backend.Volume) *apiclient.Volume {
+	return &apiclient.Volume{
+		Name: volume.Name,
+		Size: volume.Size,
+		Pods: volume.Pods,
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package image
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/remote"
+	"github.com/apcera/kurma/pkg/remote/aci"
+	"github.com/appc/spec/discovery"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// A Coordinator fetches and loads images on behalf of concurrent callers. An
+// image which is already being retrieved isn't retrieved again, instead the
+// callers wait for the pull in progress to finish. Images with pinned
+// versions are remembered, so they are only retrieved again if they are
+// removed from the image manager. Endpoints discovered for App Container
+// Images are cached as well.
+type Coordinator struct {
+	options      FetchOptions
+	imageManager backend.ImageManager
+
+	// pulls are the pulls in progress, by the key of their request.
+	pulls map[string]*pull
+
+	// index maps the keys of requests for images with pinned versions to the
+	// hashes they were loaded as.
+	index map[string]string
+
+	// fetchAndLoad retrieves and loads an image with the options, and is
+	// replaced by tests.
+	fetchAndLoad func(options *FetchOptions, imageURI string) (string, *schema.ImageManifest, error)
+
+	lock sync.Mutex
+}
+
+// FetchRequest describes an image for a Coordinator to fetch and load.
+type FetchRequest struct {
+	URI string
+
+	// Labels are used along with the Coordinator's labels when discovering App
+	// Container Images, and take precedence over them.
+	Labels map[types.ACIdentifier]string
+
+	// Insecure skips verifying the image's signature. It is ignored when the
+	// Coordinator requires signatures.
+	Insecure bool
+
+	// Progress is called as the image and its dependencies are downloaded. It
+	// may be nil.
+	Progress remote.ProgressFunc
+}
+
+// pull is the result of fetching and loading an image, which is available
+// once done is closed.
+type pull struct {
+	done     chan struct{}
+	hash     string
+	manifest *schema.ImageManifest
+	err      error
+
+	// progress are the callers' progress callbacks, which are guarded by the
+	// Coordinator's lock.
+	progress []remote.ProgressFunc
+}
+
+// NewCoordinator creates a Coordinator which fetches images with the options
+// and loads them into the image manager.
+func NewCoordinator(options *FetchOptions, imageManager backend.ImageManager) *Coordinator {
+	c := &Coordinator{
+		options:      *options,
+		imageManager: imageManager,
+		pulls:        make(map[string]*pull),
+		index:        make(map[string]string),
+	}
+	c.options.endpoints = aci.NewEndpointCache(aci.DefaultDiscoveryTTL)
+	c.fetchAndLoad = func(options *FetchOptions, imageURI string) (string, *schema.ImageManifest, error) {
+		return options.FetchAndLoad(imageURI, c.imageManager)
+	}
+	return c
+}
+
+// FetchAndLoad retrieves a container image and loads it, along with all of its
+// layers and dependencies, unless it is a pinned version of an image which
+// was already loaded. Concurrent calls for the same image share a single
+// pull.
+func (c *Coordinator) FetchAndLoad(imageURI string) (string, *schema.ImageManifest, error) {
+	return c.FetchAndLoadProgress(imageURI, nil)
+}
+
+// FetchAndLoadProgress is like FetchAndLoad, and calls progress as the image
+// and its dependencies are downloaded. Callers joining a pull in progress are
+// only told about the progress made after they joined.
+func (c *Coordinator) FetchAndLoadProgress(imageURI string, progress remote.ProgressFunc) (string, *schema.ImageManifest, error) {
+	return c.Fetch(&FetchRequest{URI: imageURI, Insecure: true, Progress: progress})
+}
+
+// Fetch retrieves and loads the requested image, like FetchAndLoadProgress.
+// Only requests for the same image with the same labels and security share a
+// pull.
+func (c *Coordinator) Fetch(req *FetchRequest) (string, *schema.ImageManifest, error) {
+	options := c.options
+	options.Insecure = c.options.Insecure && req.Insecure
+	if len(req.Labels) > 0 {
+		options.Labels = make(map[types.ACIdentifier]string)
+		for name, value := range c.options.Labels {
+			options.Labels[name] = value
+		}
+		for name, value := range req.Labels {
+			options.Labels[name] = value
+		}
+	}
+	key := fetchKey(req.URI, options.Labels, options.Insecure)
+
+	c.lock.Lock()
+	if hash, exists := c.index[key]; exists {
+		if manifest := c.imageManager.GetImage(hash); manifest != nil {
+			c.lock.Unlock()
+			return hash, manifest, nil
+		}
+		delete(c.index, key)
+	}
+
+	p, exists := c.pulls[key]
+	if !exists {
+		p = &pull{done: make(chan struct{})}
+		c.pulls[key] = p
+	}
+	if req.Progress != nil {
+		p.progress = append(p.progress, req.Progress)
+	}
+	c.lock.Unlock()
+
+	if !exists {
+		c.pull(&options, req.URI, key, p)
+	}
+	<-p.done
+	return p.hash, p.manifest, p.err
+}
+
+// pull fetches and loads the image, then hands the result to any other
+// callers waiting on it.
+func (c *Coordinator) pull(options *FetchOptions, imageURI, key string, p *pull) {
+	options.Progress = func(progress remote.Progress) {
+		c.lock.Lock()
+		callbacks := p.progress
+		c.lock.Unlock()
+		for _, f := range callbacks {
+			f(progress)
+		}
+	}
+	p.hash, p.manifest, p.err = c.fetchAndLoad(options, imageURI)
+
+	c.lock.Lock()
+	delete(c.pulls, key)
+	if p.err == nil && isPinned(imageURI) {
+		c.index[key] = p.hash
+	}
+	c.lock.Unlock()
+
+	close(p.done)
+}
+
+// fetchKey identifies requests which retrieve the same image.
+func fetchKey(imageURI string, labels map[types.ACIdentifier]string, insecure bool) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(pairs)
+	return fmt.Sprintf("%s,%v,%v", imageURI, pairs, insecure)
+}
+
+// isPinned returns whether the image URI refers to a fixed version of an
+// image. Docker images are pinned by digest, and App Container Images by a
+// version other than "latest". Images retrieved by path or URL are never
+// pinned, since what they refer to may change.
+func isPinned(imageURI string) bool {
+	if strings.HasPrefix(imageURI, "docker://") {
+		return strings.Contains(imageURI, "@sha256:")
+	}
+
+	u, err := url.Parse(imageURI)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "aci", "":
+		app, err := discovery.NewAppFromString(imageURI)
+		if err != nil {
+			return false
+		}
+		version := app.Labels["version"]
+		return version != "" && version != "latest"
+	}
+	return false
+}
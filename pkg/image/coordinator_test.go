@@ -0,0 +1,235 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/apcera/kurma/pkg/remote"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// newTestCoordinator creates a Coordinator which loads a test image for each
+// fetch, and counts the fetches of each image URI. Fetches block until release
+// is closed.
+func newTestCoordinator(t *testing.T) (*Coordinator, map[string]int, chan struct{}, func()) {
+	dir, err := ioutil.TempDir("", "imagestore")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	imageManager, err := imagestore.New(&imagestore.Options{Directory: dir})
+	if err != nil {
+		t.Fatalf("Failed to create the image manager: %v", err)
+	}
+
+	var lock sync.Mutex
+	fetches := make(map[string]int)
+	release := make(chan struct{})
+
+	c := NewCoordinator(&FetchOptions{}, imageManager)
+	c.fetchAndLoad = func(options *FetchOptions, imageURI string) (string, *schema.ImageManifest, error) {
+		lock.Lock()
+		fetches[imageURI]++
+		lock.Unlock()
+
+		<-release
+		options.Progress(remote.Progress{URI: imageURI, Downloaded: 10, Total: 10})
+		if imageURI == "example.com/missing:1.0" {
+			return "", nil, fmt.Errorf("image %s not found", imageURI)
+		}
+		return imageManager.CreateImage(bytes.NewReader(buildTestACI(t, testManifest("example.com/app"))))
+	}
+	return c, fetches, release, func() { os.RemoveAll(dir) }
+}
+
+func TestCoordinatorConcurrentPulls(t *testing.T) {
+	c, fetches, release, cleanup := newTestCoordinator(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	hashes := make([]string, 5)
+	for i := range hashes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash, _, err := c.FetchAndLoad("file:///app.aci")
+			if err != nil {
+				t.Errorf("Expected no error fetching the image, got %v", err)
+			}
+			hashes[i] = hash
+		}(i)
+	}
+
+	// let every caller join the pull before it finishes
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches["file:///app.aci"] != 1 {
+		t.Fatalf("Expected the image to be fetched once, got %d", fetches["file:///app.aci"])
+	}
+	for _, hash := range hashes {
+		if hash != hashes[0] || hash == "" {
+			t.Fatalf("Expected every caller to get the same hash, got %v", hashes)
+		}
+	}
+
+	// images which aren't pinned are fetched again later
+	if _, _, err := c.FetchAndLoad("file:///app.aci"); err != nil {
+		t.Fatalf("Expected no error fetching the image, got %v", err)
+	}
+	if fetches["file:///app.aci"] != 2 {
+		t.Fatalf("Expected the image to be fetched again, got %d fetches", fetches["file:///app.aci"])
+	}
+}
+
+func TestCoordinatorProgress(t *testing.T) {
+	c, _, release, cleanup := newTestCoordinator(t)
+	defer cleanup()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	reports := make([]int, 3)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := c.FetchAndLoadProgress("file:///app.aci", func(progress remote.Progress) {
+				if progress.Downloaded != 10 || progress.Total != 10 {
+					t.Errorf("Expected 10 of 10 bytes downloaded, got %d of %d", progress.Downloaded, progress.Total)
+				}
+				lock.Lock()
+				reports[i]++
+				lock.Unlock()
+			})
+			if err != nil {
+				t.Errorf("Expected no error fetching the image, got %v", err)
+			}
+		}(i)
+	}
+
+	// each caller sharing the pull is told about its progress
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i, n := range reports {
+		if n != 1 {
+			t.Fatalf("Expected caller %d to get one progress report, got %d", i, n)
+		}
+	}
+}
+
+func TestCoordinatorPinnedImages(t *testing.T) {
+	c, fetches, release, cleanup := newTestCoordinator(t)
+	defer cleanup()
+	close(release)
+
+	uri := "example.com/app:1.0"
+	hash, _, err := c.FetchAndLoad(uri)
+	if err != nil {
+		t.Fatalf("Expected no error fetching the image, got %v", err)
+	}
+	if _, _, err := c.FetchAndLoad(uri); err != nil {
+		t.Fatalf("Expected no error fetching the image, got %v", err)
+	}
+	if fetches[uri] != 1 {
+		t.Fatalf("Expected the pinned image to be fetched once, got %d", fetches[uri])
+	}
+
+	// once the image is removed, it is fetched again
+	if err := c.imageManager.DeleteImage(hash); err != nil {
+		t.Fatalf("Failed to delete the image: %v", err)
+	}
+	if _, _, err := c.FetchAndLoad(uri); err != nil {
+		t.Fatalf("Expected no error fetching the image, got %v", err)
+	}
+	if fetches[uri] != 2 {
+		t.Fatalf("Expected the removed image to be fetched again, got %d fetches", fetches[uri])
+	}
+
+	// failures aren't remembered
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.FetchAndLoad("example.com/missing:1.0"); err == nil {
+			t.Fatalf("Expected an error fetching a missing image")
+		}
+	}
+	if fetches["example.com/missing:1.0"] != 2 {
+		t.Fatalf("Expected the missing image to be fetched each time, got %d", fetches["example.com/missing:1.0"])
+	}
+}
+
+func TestCoordinatorFetchRequests(t *testing.T) {
+	c, fetches, release, cleanup := newTestCoordinator(t)
+	defer cleanup()
+	close(release)
+
+	// record the options each image is fetched with
+	var options []*FetchOptions
+	fetchAndLoad := c.fetchAndLoad
+	c.fetchAndLoad = func(o *FetchOptions, imageURI string) (string, *schema.ImageManifest, error) {
+		options = append(options, o)
+		return fetchAndLoad(o, imageURI)
+	}
+	c.options.Insecure = true
+	c.options.Labels = map[types.ACIdentifier]string{"os": "linux", "arch": "amd64"}
+
+	uri := "example.com/app:1.0"
+	requests := []*FetchRequest{
+		{URI: uri, Insecure: true},
+		{URI: uri, Insecure: true, Labels: map[types.ACIdentifier]string{"arch": "arm64"}},
+		{URI: uri},
+		{URI: uri, Insecure: true},
+	}
+	for _, req := range requests {
+		if _, _, err := c.Fetch(req); err != nil {
+			t.Fatalf("Expected no error fetching the image, got %v", err)
+		}
+	}
+
+	// requests with different labels or security don't share pinned images
+	if fetches[uri] != 3 {
+		t.Fatalf("Expected the image to be fetched 3 times, got %d", fetches[uri])
+	}
+	if options[1].Labels["arch"] != "arm64" || options[1].Labels["os"] != "linux" {
+		t.Fatalf("Expected the request's labels to be merged, got %v", options[1].Labels)
+	}
+	if !options[0].Insecure || options[2].Insecure {
+		t.Fatalf("Expected only the insecure request to skip verification")
+	}
+
+	// the coordinator's requirement for signatures can't be overridden
+	c.options.Insecure = false
+	if _, _, err := c.Fetch(&FetchRequest{URI: "example.com/other:1.0", Insecure: true}); err != nil {
+		t.Fatalf("Expected no error fetching the image, got %v", err)
+	}
+	if options[3].Insecure {
+		t.Fatalf("Expected the image to be verified when signatures are required")
+	}
+}
+
+func TestIsPinned(t *testing.T) {
+	tests := map[string]bool{
+		"example.com/app:1.0":                  true,
+		"example.com/app,version=2.0,os=linux": true,
+		"example.com/app":                      false,
+		"example.com/app:latest":               false,
+		"docker://nats@sha256:0123abcd":        true,
+		"docker://nats:1.0":                    false,
+		"https://example.com/app-1.0.aci":      false,
+		"file:///images/app.aci":               false,
+		"oci:/images/app:1.0":                  false,
+	}
+	for uri, pinned := range tests {
+		if isPinned(uri) != pinned {
+			t.Errorf("Expected isPinned(%q) to be %v", uri, pinned)
+		}
+	}
+}
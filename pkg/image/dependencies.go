@@ -0,0 +1,142 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/util/hashutil"
+	"github.com/apcera/util/tempfile"
+	"github.com/appc/spec/aci"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// A dependencyFetcher walks the dependencies of an image and fetches any which
+// are not already loaded in the image manager.
+type dependencyFetcher struct {
+	// labels are the labels used to discover the top level image. Only its os
+	// and arch labels are applied to each dependency, since the others, such as
+	// its version, describe the top level image alone. The dependency's own
+	// labels take precedence, and the os and arch labels default to those of
+	// the host.
+	labels map[types.ACIdentifier]string
+
+	imageManager backend.ImageManager
+
+	// fetch is used to retrieve a dependency which isn't available.
+	fetch func(imageURI string, labels map[types.ACIdentifier]string) ([]tempfile.ReadSeekCloser, error)
+
+	// seen tracks the images whose dependencies have already been walked, to
+	// guard against circular dependencies.
+	seen map[string]bool
+}
+
+// fetchDependencies ensures that all of the dependencies of the image, along
+// with their own dependencies, are loaded.
+func (df *dependencyFetcher) fetchDependencies(hash string, manifest *schema.ImageManifest) error {
+	if df.seen[hash] {
+		return nil
+	}
+	df.seen[hash] = true
+
+	for _, dep := range manifest.Dependencies {
+		dephash, depmanifest := df.findDependency(dep)
+		if depmanifest == nil {
+			var err error
+			dephash, depmanifest, err = df.fetchDependency(dep)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := df.fetchDependencies(dephash, depmanifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDependency looks up the dependency in the image manager. A dependency
+// with an image ID is only matched by its hash, otherwise it is matched by
+// name and version label. The image manager hashes images as they were loaded,
+// so one loaded compressed isn't found by its ID and is fetched and checked
+// again.
+func (df *dependencyFetcher) findDependency(dep types.Dependency) (string, *schema.ImageManifest) {
+	if dep.ImageID != nil {
+		hash := dep.ImageID.String()
+		return hash, df.imageManager.GetImage(hash)
+	}
+
+	version, _ := dep.Labels.Get("version")
+	return df.imageManager.FindImage(dep.ImageName.String(), version)
+}
+
+// fetchDependency discovers and loads the dependency. If the dependency
+// specifies an image ID, the fetched image must match it.
+func (df *dependencyFetcher) fetchDependency(dep types.Dependency) (string, *schema.ImageManifest, error) {
+	labels := map[types.ACIdentifier]string{
+		"os":   runtime.GOOS,
+		"arch": runtime.GOARCH,
+	}
+	for _, k := range []types.ACIdentifier{"os", "arch"} {
+		if v, ok := df.labels[k]; ok {
+			labels[k] = v
+		}
+	}
+	for _, l := range dep.Labels {
+		labels[l.Name] = l.Value
+	}
+
+	layers, err := df.fetch(dep.ImageName.String(), labels)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch dependent image %s: %v", dep.ImageName, err)
+	}
+
+	// the image is checked before it is loaded, so a mismatched image is never
+	// added to the image manager
+	if dep.ImageID != nil {
+		if err := checkImageID(layers, dep.ImageID.String()); err != nil {
+			for _, l := range layers {
+				l.Close()
+			}
+			return "", nil, fmt.Errorf("dependent image %s %v", dep.ImageName, err)
+		}
+	}
+
+	hash, manifest, err := loadLayers(layers, df.imageManager)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load dependent image %s: %v", dep.ImageName, err)
+	}
+	return hash, manifest, nil
+}
+
+// checkImageID ensures the first of the fetched layers, which is the image
+// that was requested, has the image ID. The ID is the hash of the uncompressed
+// image, rather than of the possibly compressed file which the image manager
+// hashes. The layer is rewound afterwards.
+func checkImageID(layers []tempfile.ReadSeekCloser, id string) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("was not retrieved")
+	}
+	r, err := aci.NewCompressedReader(layers[0])
+	if err != nil {
+		return fmt.Errorf("could not be read: %v", err)
+	}
+	defer r.Close()
+	hr := hashutil.NewSha512(r)
+	if _, err := io.Copy(ioutil.Discard, hr); err != nil {
+		return fmt.Errorf("could not be read: %v", err)
+	}
+	if _, err := layers[0].Seek(0, 0); err != nil {
+		return fmt.Errorf("could not be read: %v", err)
+	}
+	if hash := fmt.Sprintf("sha512-%s", hr.Sha512()); hash != id {
+		return fmt.Errorf("was fetched with hash %s, but %s is required", hash, id)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/apcera/util/hashutil"
+	"github.com/apcera/util/tempfile"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+// buildTestACI returns an image archive containing only the manifest.
+func buildTestACI(t *testing.T, manifest *schema.ImageManifest) []byte {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("Failed to marshal the manifest: %v", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	archive := tar.NewWriter(buffer)
+	header := &tar.Header{Name: "manifest", Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}
+	if err := archive.WriteHeader(header); err != nil {
+		t.Fatalf("Failed to write the manifest header: %v", err)
+	}
+	if _, err := archive.Write(b); err != nil {
+		t.Fatalf("Failed to write the manifest: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to close the archive: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func testManifest(name string, deps ...types.Dependency) *schema.ImageManifest {
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	manifest.Dependencies = deps
+	return manifest
+}
+
+func imageHash(b []byte) string {
+	hr := hashutil.NewSha512(bytes.NewReader(b))
+	ioutil.ReadAll(hr)
+	return fmt.Sprintf("sha512-%s", hr.Sha512())
+}
+
+func mustHash(t *testing.T, s string) *types.Hash {
+	h, err := types.NewHash(s)
+	if err != nil {
+		t.Fatalf("Failed to parse hash %q: %v", s, err)
+	}
+	return h
+}
+
+func newTestFetcher(t *testing.T, remote map[string][]byte) (*dependencyFetcher, func()) {
+	dir, err := ioutil.TempDir("", "imagestore")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	imageManager, err := imagestore.New(&imagestore.Options{Directory: dir})
+	if err != nil {
+		t.Fatalf("Failed to create the image manager: %v", err)
+	}
+
+	df := &dependencyFetcher{
+		imageManager: imageManager,
+		seen:         make(map[string]bool),
+		fetch: func(imageURI string, labels map[types.ACIdentifier]string) ([]tempfile.ReadSeekCloser, error) {
+			b, ok := remote[imageURI+":"+labels["version"]]
+			if !ok {
+				return nil, fmt.Errorf("image %s not found", imageURI)
+			}
+			f, err := tempfile.New(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			return []tempfile.ReadSeekCloser{f}, nil
+		},
+	}
+	return df, func() { os.RemoveAll(dir) }
+}
+
+func TestFetchDependencies(t *testing.T) {
+	base := buildTestACI(t, testManifest("example.com/base"))
+	middle := buildTestACI(t, testManifest("example.com/middle", types.Dependency{
+		ImageName: "example.com/base",
+		Labels:    types.Labels{{Name: "version", Value: "1.0"}},
+	}))
+
+	df, cleanup := newTestFetcher(t, map[string][]byte{
+		"example.com/base:1.0":   base,
+		"example.com/middle:2.0": middle,
+	})
+	defer cleanup()
+
+	// the middle image is pinned by its hash, and pulls in base
+	manifest := testManifest("example.com/app", types.Dependency{
+		ImageName: "example.com/middle",
+		ImageID:   mustHash(t, imageHash(middle)),
+		Labels:    types.Labels{{Name: "version", Value: "2.0"}},
+	})
+	if err := df.fetchDependencies("sha512-app", manifest); err != nil {
+		t.Fatalf("Expected no error fetching dependencies, got %v", err)
+	}
+
+	if df.imageManager.GetImage(imageHash(middle)) == nil {
+		t.Fatalf("Expected the middle image to be loaded")
+	}
+	if df.imageManager.GetImage(imageHash(base)) == nil {
+		t.Fatalf("Expected the base image to be loaded")
+	}
+}
+
+func TestFetchDependenciesCompressed(t *testing.T) {
+	base := buildTestACI(t, testManifest("example.com/base"))
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(base)
+	gz.Close()
+
+	df, cleanup := newTestFetcher(t, map[string][]byte{
+		"example.com/base:1.0": compressed.Bytes(),
+	})
+	defer cleanup()
+
+	// the image ID is the hash of the uncompressed image
+	manifest := testManifest("example.com/app", types.Dependency{
+		ImageName: "example.com/base",
+		ImageID:   mustHash(t, imageHash(base)),
+		Labels:    types.Labels{{Name: "version", Value: "1.0"}},
+	})
+	if err := df.fetchDependencies("sha512-app", manifest); err != nil {
+		t.Fatalf("Expected no error fetching dependencies, got %v", err)
+	}
+	if df.imageManager.GetImage(imageHash(compressed.Bytes())) == nil {
+		t.Fatalf("Expected the base image to be loaded")
+	}
+
+	// the hash of the compressed image isn't its ID
+	df, cleanup = newTestFetcher(t, map[string][]byte{
+		"example.com/base:1.0": compressed.Bytes(),
+	})
+	defer cleanup()
+	manifest.Dependencies[0].ImageID = mustHash(t, imageHash(compressed.Bytes()))
+	if err := df.fetchDependencies("sha512-app", manifest); err == nil {
+		t.Fatalf("Expected a hash mismatch error")
+	}
+}
+
+func TestFetchDependenciesHashMismatch(t *testing.T) {
+	base := buildTestACI(t, testManifest("example.com/base"))
+
+	other := buildTestACI(t, testManifest("example.com/other"))
+
+	df, cleanup := newTestFetcher(t, map[string][]byte{
+		"example.com/base:":  base,
+		"example.com/other:": other,
+	})
+	defer cleanup()
+
+	manifest := testManifest("example.com/app", types.Dependency{
+		ImageName: "example.com/base",
+		ImageID:   mustHash(t, imageHash([]byte("other"))),
+	})
+	err := df.fetchDependencies("sha512-app", manifest)
+	if err == nil || !strings.Contains(err.Error(), "is required") {
+		t.Fatalf("Expected a hash mismatch error, got %v", err)
+	}
+	if len(df.imageManager.ListImages()) != 0 {
+		t.Fatalf("Expected the mismatched image not to be loaded")
+	}
+
+	// an image which was already loaded is left in place
+	if _, _, err := df.imageManager.CreateImage(bytes.NewReader(other)); err != nil {
+		t.Fatalf("Expected no error creating the image, got %v", err)
+	}
+	manifest = testManifest("example.com/app", types.Dependency{
+		ImageName: "example.com/other",
+		ImageID:   mustHash(t, imageHash([]byte("other"))),
+	})
+	if err := df.fetchDependencies("sha512-app2", manifest); err == nil {
+		t.Fatalf("Expected a hash mismatch error")
+	}
+	if df.imageManager.GetImage(imageHash(other)) == nil {
+		t.Fatalf("Expected the existing image to be kept")
+	}
+}
+
+func TestFetchDependenciesMissing(t *testing.T) {
+	df, cleanup := newTestFetcher(t, nil)
+	defer cleanup()
+
+	manifest := testManifest("example.com/app", types.Dependency{ImageName: "example.com/base"})
+	if err := df.fetchDependencies("sha512-app", manifest); err == nil {
+		t.Fatalf("Expected an error fetching a missing dependency")
+	}
+}
+
+func TestFetchDependenciesLabels(t *testing.T) {
+	base := buildTestACI(t, testManifest("example.com/base"))
+
+	df, cleanup := newTestFetcher(t, map[string][]byte{
+		"example.com/base:": base,
+	})
+	defer cleanup()
+
+	// the version of the top level image isn't applied to its dependencies
+	df.labels = map[types.ACIdentifier]string{"version": "3.0", "os": "linux"}
+	manifest := testManifest("example.com/app", types.Dependency{ImageName: "example.com/base"})
+	if err := df.fetchDependencies("sha512-app", manifest); err != nil {
+		t.Fatalf("Expected no error fetching dependencies, got %v", err)
+	}
+	if df.imageManager.GetImage(imageHash(base)) == nil {
+		t.Fatalf("Expected the base image to be loaded")
+	}
+}
@@ -4,48 +4,122 @@ package image
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/remote"
 	"github.com/apcera/kurma/pkg/remote/aci"
 	"github.com/apcera/kurma/pkg/remote/docker"
 	"github.com/apcera/kurma/pkg/remote/http"
+	"github.com/apcera/kurma/pkg/remote/oci"
+	"github.com/apcera/kurma/pkg/trust"
 
 	"github.com/apcera/util/tempfile"
 
+	appcaci "github.com/appc/spec/aci"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
 )
 
+// FetchOptions configures how container images are retrieved.
+type FetchOptions struct {
+	// Labels are the labels used when discovering App Container Images.
+	Labels map[types.ACIdentifier]string
+
+	// Insecure allows images to be discovered over plain HTTP and skips
+	// verifying their signatures.
+	Insecure bool
+
+	// TrustStore holds the keys used to verify image signatures. It is required
+	// unless Insecure is set.
+	TrustStore *trust.Store
+
+	// Credentials holds the credentials used to authenticate with the hosts
+	// images are retrieved from. It may be nil.
+	Credentials *credentials.Store
+
+	// DownloadDirectory holds partial image downloads, so downloads which are
+	// interrupted are resumed when the image is next fetched. Downloads are
+	// only resumed while retrying them when it is empty.
+	DownloadDirectory string
+
+	// Progress is called as images are downloaded. It may be nil.
+	Progress remote.ProgressFunc
+
+	// images is set while fetching images to load, so the layers of Docker and
+	// OCI images which are already loaded aren't retrieved again.
+	images backend.ImageManager
+
+	// endpoints is set by a Coordinator to cache the endpoints discovered for
+	// App Container Images.
+	endpoints *aci.EndpointCache
+}
+
 // FetchAndLoad retrieves a container image and loads it for use within kurmad.
-// TODO: refactor out `labels`, `insecure` opts to a config struct. This can
-// live as a method on that struct.
+// Every layer that is returned is loaded, and any dependencies of the image
+// which are not already available are discovered and fetched as well.
 func FetchAndLoad(imageURI string, labels map[types.ACIdentifier]string, insecure bool, imageManager backend.ImageManager) (
 	string, *schema.ImageManifest, error) {
-	layers, err := Fetch(imageURI, labels, insecure)
+	opts := &FetchOptions{Labels: labels, Insecure: insecure}
+	return opts.FetchAndLoad(imageURI, imageManager)
+}
+
+// Fetch retrieves a container image. Images may be sourced from the local
+// machine, or may be retrieved from a remote server.
+func Fetch(imageURI string, labels map[types.ACIdentifier]string, insecure bool) ([]tempfile.ReadSeekCloser, error) {
+	opts := &FetchOptions{Labels: labels, Insecure: insecure}
+	return opts.Fetch(imageURI)
+}
+
+// FetchAndLoad retrieves a container image and loads it, along with all of its
+// layers and dependencies, for use within kurmad.
+func (o *FetchOptions) FetchAndLoad(imageURI string, imageManager backend.ImageManager) (string, *schema.ImageManifest, error) {
+	opts := *o
+	opts.images = imageManager
+
+	layers, err := opts.Fetch(imageURI)
 	if err != nil {
 		return "", nil, err
 	}
-	for _, l := range layers {
-		defer l.Close()
-	}
 
-	hash, manifest, err := loadFromFile(layers[0], imageManager)
+	hash, manifest, err := loadLayers(layers, imageManager)
 	if err != nil {
 		return "", nil, err
 	}
+
+	df := &dependencyFetcher{
+		labels:       o.Labels,
+		imageManager: imageManager,
+		fetch: func(imageURI string, labels map[types.ACIdentifier]string) ([]tempfile.ReadSeekCloser, error) {
+			depopts := opts
+			depopts.Labels = labels
+			return depopts.Fetch(imageURI)
+		},
+		seen: make(map[string]bool),
+	}
+	if err := df.fetchDependencies(hash, manifest); err != nil {
+		return "", nil, err
+	}
 	return hash, manifest, nil
 }
 
 // Fetch retrieves a container image. Images may be sourced from the local
-// machine, or may be retrieved from a remote server.
-func Fetch(imageURI string, labels map[types.ACIdentifier]string, insecure bool) ([]tempfile.ReadSeekCloser, error) {
+// machine, or may be retrieved from a remote server. Unless the options are
+// insecure, the image's detached signature is retrieved alongside it and
+// verified.
+func (o *FetchOptions) Fetch(imageURI string) ([]tempfile.ReadSeekCloser, error) {
 	u, err := url.Parse(imageURI)
 	if err != nil {
-		return nil, err
+		// Docker images with a digest but no registry aren't valid URLs
+		if !strings.HasPrefix(imageURI, "docker://") {
+			return nil, err
+		}
+		u = &url.URL{Scheme: "docker"}
 	}
 
 	var puller remote.Puller
@@ -65,18 +139,39 @@ func Fetch(imageURI string, labels map[types.ACIdentifier]string, insecure bool)
 		if err != nil {
 			return nil, err
 		}
+		if !o.Insecure {
+			sig, err := os.Open(filename + ".asc")
+			if err != nil {
+				t.Close()
+				return nil, fmt.Errorf("failed to open the image signature: %v", err)
+			}
+			defer sig.Close()
+			if err := o.verify(t, sig); err != nil {
+				t.Close()
+				return nil, err
+			}
+		}
 		return []tempfile.ReadSeekCloser{t}, nil
 	case "http", "https":
-		puller = http.New()
-	case "docker":
-		puller = docker.New(insecure)
+		puller = http.New(o.downloadOptions())
+	case "docker", "oci":
+		if !o.Insecure {
+			return nil, fmt.Errorf("signatures cannot be verified for %s images", u.Scheme)
+		}
+		puller = oci.New(o.Insecure, o.images, o.Credentials)
 	case "aci", "":
-		puller = aci.New(insecure, labels)
+		// signatures are discovered and verified by the puller
+		puller = aci.New(o.Insecure, o.Labels, o.TrustStore, o.downloadOptions(), o.endpoints)
 	default:
 		return nil, fmt.Errorf("%q scheme not supported", u.Scheme)
 	}
 
 	layers, err := puller.Pull(imageURI)
+	if err == oci.ErrSchema1 && u.Scheme == "docker" {
+		// images only pushed with schema 1 manifests are converted by
+		// docker2aci, which squashes their layers
+		layers, err = docker.New(o.Insecure, o.Credentials).Pull(imageURI)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -90,9 +185,88 @@ func Fetch(imageURI string, labels map[types.ACIdentifier]string, insecure bool)
 		wrappedLayers[j] = t
 	}
 
+	if !o.Insecure && (u.Scheme == "http" || u.Scheme == "https") {
+		if err := o.verifyHTTP(imageURI, wrappedLayers); err != nil {
+			for _, l := range wrappedLayers {
+				l.Close()
+			}
+			return nil, err
+		}
+	}
+
 	return wrappedLayers, nil
 }
 
+// downloadOptions returns the options images are downloaded over HTTP with.
+func (o *FetchOptions) downloadOptions() *http.Options {
+	return &http.Options{
+		Credentials: o.Credentials,
+		Directory:   o.DownloadDirectory,
+		Progress:    o.Progress,
+	}
+}
+
+// verifyHTTP retrieves the signature of an image downloaded over HTTP, which
+// is expected alongside the image with an ".asc" extension, and verifies it.
+func (o *FetchOptions) verifyHTTP(imageURI string, layers []tempfile.ReadSeekCloser) error {
+	if len(layers) != 1 {
+		return fmt.Errorf("expected 1 image, got %d", len(layers))
+	}
+	signatures, err := http.New(&http.Options{Credentials: o.Credentials}).Pull(imageURI + ".asc")
+	if err != nil {
+		return fmt.Errorf("failed to retrieve the image signature: %v", err)
+	}
+	defer signatures[0].Close()
+	return o.verify(layers[0], signatures[0])
+}
+
+// verify checks the image's signature against the keys trusted for the name
+// in the image's manifest. The image is rewound afterwards so it can be
+// loaded.
+func (o *FetchOptions) verify(image tempfile.ReadSeekCloser, signature io.Reader) error {
+	if o.TrustStore == nil {
+		return fmt.Errorf("no trust store is available to verify the image signature")
+	}
+
+	manifest, err := appcaci.ManifestFromImage(image)
+	if err != nil {
+		return fmt.Errorf("failed to read the image manifest: %v", err)
+	}
+	if _, err := image.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err := o.TrustStore.Verify(manifest.Name.String(), image, signature); err != nil {
+		return err
+	}
+	_, err = image.Seek(0, 0)
+	return err
+}
+
+// loadLayers loads all of the fetched layers and returns the hash and manifest
+// of the first, which is the image that was requested. The layers are closed
+// once they are loaded.
+func loadLayers(layers []tempfile.ReadSeekCloser, imageManager backend.ImageManager) (string, *schema.ImageManifest, error) {
+	for _, l := range layers {
+		defer l.Close()
+	}
+	if len(layers) == 0 {
+		return "", nil, fmt.Errorf("no image layers were retrieved")
+	}
+
+	// load the layers from the bottom up, so each layer's dependencies are
+	// available by the time it is loaded
+	var hash string
+	var manifest *schema.ImageManifest
+	for i := len(layers) - 1; i >= 0; i-- {
+		var err error
+		hash, manifest, err = loadFromFile(layers[i], imageManager)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return hash, manifest, nil
+}
+
 // loadFromFile loads a file as an image for use within Kurma.
 func loadFromFile(f tempfile.ReadSeekCloser, imageManager backend.ImageManager) (string, *schema.ImageManifest, error) {
 	hash, manifest, err := imageManager.CreateImage(f)
@@ -3,9 +3,15 @@
 package image
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/apcera/kurma/pkg/trust"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
 )
 
 func TestFetch_LocalFile(t *testing.T) {
@@ -17,7 +23,7 @@ func TestFetch_LocalFile(t *testing.T) {
 
 	uri := "file://" + f.Name()
 
-	readers, err := Fetch(uri, nil, false)
+	readers, err := Fetch(uri, nil, true)
 	if err != nil {
 		t.Fatalf("Expected no error retrieving %s; got %s", uri, err)
 	}
@@ -35,3 +41,66 @@ func TestFetch_UnsupportedScheme(t *testing.T) {
 		t.Fatalf("Expected error with URI %q, got none", uri)
 	}
 }
+
+func TestFetch_LocalFileSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signedACI")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "app.aci")
+	image := buildTestACI(t, testManifest("example.com/app"))
+	if err := ioutil.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("Error writing the image: %s", err)
+	}
+	uri := "file://" + imagePath
+
+	store, err := trust.New(filepath.Join(dir, "trust"))
+	if err != nil {
+		t.Fatalf("Error creating the trust store: %s", err)
+	}
+	opts := &FetchOptions{TrustStore: store}
+
+	// without a signature, the image is rejected
+	if _, err := opts.Fetch(uri); err == nil {
+		t.Fatalf("Expected an error retrieving an unsigned image, got none")
+	}
+
+	// sign the image and trust the key
+	entity, err := openpgp.NewEntity("signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatalf("Error generating a key: %s", err)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(image), nil); err != nil {
+		t.Fatalf("Error signing the image: %s", err)
+	}
+	if err := ioutil.WriteFile(imagePath+".asc", sig.Bytes(), 0644); err != nil {
+		t.Fatalf("Error writing the signature: %s", err)
+	}
+
+	// the signature isn't trusted until the key is added
+	if _, err := opts.Fetch(uri); err == nil {
+		t.Fatalf("Expected an error retrieving an image signed by an untrusted key, got none")
+	}
+
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("Error encoding the key: %s", err)
+	}
+	entity.Serialize(w)
+	w.Close()
+	if _, err := store.AddKeys("example.com", &key); err != nil {
+		t.Fatalf("Error trusting the key: %s", err)
+	}
+
+	readers, err := opts.Fetch(uri)
+	if err != nil {
+		t.Fatalf("Expected no error retrieving the signed image; got %s", err)
+	}
+	for _, r := range readers {
+		r.Close()
+	}
+}
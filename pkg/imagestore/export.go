@@ -0,0 +1,170 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/appc/spec/schema"
+)
+
+// ExportImage writes the image to the writer as an uncompressed ACI. The
+// image's dependencies are not included. The ACI is rebuilt from the image's
+// files rather than being the ACI the image was created from, so its hash
+// differs from the image's. Images which depend on the image by its ID, such as
+// the layers of converted Docker images, won't resolve to the exported image,
+// so ExportImageTree is preferred for moving images between hosts.
+func (m *Manager) ExportImage(hash string, w io.Writer) error {
+	manifest := m.GetImage(hash)
+	if manifest == nil {
+		return fmt.Errorf("unable to locate hash %q", hash)
+	}
+	return m.exportLayers(manifest, []string{hash}, w)
+}
+
+// ExportImageTree writes the image merged with all of its dependencies to the
+// writer as a single uncompressed ACI with no dependencies of its own. Files
+// in an image take precedence over those in the images it depends on.
+func (m *Manager) ExportImageTree(hash string, w io.Writer) error {
+	layers, err := m.processLayers(hash)
+	if err != nil {
+		return err
+	}
+
+	manifest := *m.GetImage(hash)
+	manifest.Dependencies = nil
+	return m.exportLayers(&manifest, layers, w)
+}
+
+// exportLayers writes an ACI with the manifest and the merged root filesystems
+// of the layers, ordered from the top.
+func (m *Manager) exportLayers(manifest *schema.ImageManifest, layers []string, w io.Writer) error {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to serialize the image manifest: %v", err)
+	}
+
+	tw := tar.NewWriter(w)
+	hdr := &tar.Header{
+		Name:     "manifest",
+		Mode:     0644,
+		Size:     int64(len(b)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(b); err != nil {
+		return err
+	}
+
+	e := &exporter{
+		tw:    tw,
+		seen:  make(map[string]bool),
+		links: make(map[uint64]string),
+	}
+	for _, layer := range layers {
+		if err := e.addTree(filepath.Join(m.Options.Directory, layer, "rootfs")); err != nil {
+			return fmt.Errorf("failed to export image %s: %v", layer, err)
+		}
+	}
+	return tw.Close()
+}
+
+// exporter writes root filesystems into an ACI, skipping any paths already
+// written by a higher layer.
+type exporter struct {
+	tw *tar.Writer
+
+	// seen maps each path written to whether it was a directory. The contents
+	// of directories are merged between layers, while any other file hides the
+	// paths beneath it in lower layers.
+	seen map[string]bool
+
+	// links maps the inode of files with multiple links to the path it was
+	// first written as, so the others are written as hard links to it.
+	links map[uint64]string
+}
+
+func (e *exporter) addTree(rootfs string) error {
+	return filepath.Walk(rootfs, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootfs, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join("rootfs", rel)
+
+		if isDir, exists := e.seen[name]; exists {
+			if fi.IsDir() && !isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		e.seen[name] = fi.IsDir()
+		return e.addFile(name, p, fi)
+	})
+}
+
+func (e *exporter) addFile(name, path string, fi os.FileInfo) error {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uname = ""
+	hdr.Gname = ""
+
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		hdr.Uid = int(stat.Uid)
+		hdr.Gid = int(stat.Gid)
+		hdr.Devmajor = int64((stat.Rdev >> 8) & 0xfff)
+		hdr.Devminor = int64((stat.Rdev & 0xff) | ((stat.Rdev >> 12) & 0xfff00))
+
+		if fi.Mode().IsRegular() && stat.Nlink > 1 {
+			if target, exists := e.links[stat.Ino]; exists {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+				return e.tw.WriteHeader(hdr)
+			}
+			e.links[stat.Ino] = name
+		}
+	}
+
+	if err := e.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(e.tw, f)
+	return err
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestExportImage(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+
+	var buf bytes.Buffer
+	tt.TestExpectSuccess(t, manager.ExportImage(app, &buf))
+	tt.TestExpectError(t, manager.ExportImage("sha512-missing", &buf))
+
+	// the exported image can be imported elsewhere, still depending on base
+	other := newTestManager(t)
+	_, manifest, err := other.CreateImage(&buf)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, manifest.Name.String(), "example.com/app")
+	tt.TestEqual(t, len(manifest.Dependencies), 1)
+}
+
+func TestExportImageTree(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	base := createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+
+	baseRootfs := filepath.Join(manager.Options.Directory, base, "rootfs")
+	appRootfs := filepath.Join(manager.Options.Directory, app, "rootfs")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(baseRootfs, "base"), []byte("base"), 0644))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(appRootfs, "blah"), []byte("app"), 0644))
+
+	// a file in the app hides a directory in the base
+	tt.TestExpectSuccess(t, os.MkdirAll(filepath.Join(baseRootfs, "etc", "conf.d"), 0755))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(appRootfs, "etc"), []byte("app"), 0644))
+
+	var buf bytes.Buffer
+	tt.TestExpectSuccess(t, manager.ExportImageTree(app, &buf))
+
+	other := newTestManager(t)
+	hash, manifest, err := other.CreateImage(&buf)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, manifest.Name.String(), "example.com/app")
+	tt.TestEqual(t, len(manifest.Dependencies), 0)
+
+	rootfs := filepath.Join(other.Options.Directory, hash, "rootfs")
+	b, err := ioutil.ReadFile(filepath.Join(rootfs, "blah"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "app")
+	b, err = ioutil.ReadFile(filepath.Join(rootfs, "base"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "base")
+	b, err = ioutil.ReadFile(filepath.Join(rootfs, "etc"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "app")
+
+	// the original image is unchanged
+	tt.TestEqual(t, len(manager.GetImage(app).Dependencies), 1)
+}
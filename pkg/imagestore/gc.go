@@ -0,0 +1,335 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/appc/spec/schema"
+)
+
+const (
+	// defaultGCInterval is how often, in seconds, the disk usage is checked
+	// when no interval is configured.
+	defaultGCInterval = 300
+
+	// defaultGCWatermarkGap is the difference between the high and low
+	// watermarks when no low watermark is configured.
+	defaultGCWatermarkGap = 10
+)
+
+// GCOptions configures the periodic garbage collection of images. When the
+// filesystem holding the images is more than HighWatermark percent full,
+// unused images are removed, least recently used first, until it is at or
+// below LowWatermark percent full. The usage is checked every Interval
+// seconds.
+type GCOptions struct {
+	Interval      int `json:"interval,omitempty"`
+	HighWatermark int `json:"highWatermark,omitempty"`
+	LowWatermark  int `json:"lowWatermark,omitempty"`
+}
+
+// Enabled returns whether periodic garbage collection is configured.
+func (o GCOptions) Enabled() bool {
+	return o.HighWatermark > 0
+}
+
+// validate ensures the watermarks are usable and applies the defaults.
+func (o *GCOptions) validate() error {
+	if o.Interval == 0 {
+		o.Interval = defaultGCInterval
+	}
+	if o.LowWatermark == 0 && o.HighWatermark > defaultGCWatermarkGap {
+		o.LowWatermark = o.HighWatermark - defaultGCWatermarkGap
+	}
+	if o.Interval < 0 {
+		return fmt.Errorf("the image garbage collection interval must be greater than zero")
+	}
+	if o.HighWatermark > 100 {
+		return fmt.Errorf("the image garbage collection highWatermark must be a percentage")
+	}
+	if o.LowWatermark <= 0 || o.LowWatermark >= o.HighWatermark {
+		return fmt.Errorf("the image garbage collection lowWatermark must be greater than zero and less than the highWatermark")
+	}
+	return nil
+}
+
+// filesystemUsage returns the percentage of the filesystem containing the path
+// that is in use. It is a variable so that it can be replaced in tests.
+var filesystemUsage = func(path string) (int, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	used := st.Blocks - st.Bfree
+	total := used + st.Bavail
+	if total == 0 {
+		return 0, nil
+	}
+	return int(used * 100 / total), nil
+}
+
+// AddReferences marks the images as in use by the owner, such as a pod, which
+// protects them and their dependencies from being deleted. Any references the
+// owner previously held are replaced. It waits for any garbage collection in
+// progress, so images which still exist once it returns are protected.
+func (m *Manager) AddReferences(owner string, hashes []string) {
+	m.gcLock.Lock()
+	defer m.gcLock.Unlock()
+
+	m.referencesLock.Lock()
+	if m.references == nil {
+		m.references = make(map[string][]string)
+	}
+	m.references[owner] = append([]string(nil), hashes...)
+	m.referencesLock.Unlock()
+
+	m.touchImages(hashes)
+}
+
+// RemoveReferences releases all of the images referenced by the owner.
+func (m *Manager) RemoveReferences(owner string) {
+	m.referencesLock.Lock()
+	hashes := m.references[owner]
+	delete(m.references, owner)
+	m.referencesLock.Unlock()
+
+	m.touchImages(hashes)
+}
+
+// touchImages updates the modification time of the images' directories, which
+// records when they were last used.
+func (m *Manager) touchImages(hashes []string) {
+	now := time.Now()
+	for _, hash := range hashes {
+		os.Chtimes(filepath.Join(m.Options.Directory, hash), now, now)
+	}
+}
+
+// owners returns the sorted list of owners referencing the image.
+func (m *Manager) owners(hash string) []string {
+	m.referencesLock.Lock()
+	defer m.referencesLock.Unlock()
+
+	var owners []string
+	for owner, hashes := range m.references {
+		for _, h := range hashes {
+			if h == hash {
+				owners = append(owners, owner)
+				break
+			}
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// dependencyGraph returns a map of each image to the images it directly
+// depends on. Dependencies that aren't available are left out.
+func (m *Manager) dependencyGraph() map[string][]string {
+	m.imagesLock.RLock()
+	images := make(map[string]*schema.ImageManifest, len(m.images))
+	for hash, manifest := range m.images {
+		images[hash] = manifest
+	}
+	m.imagesLock.RUnlock()
+
+	lp := &layerProcessor{manager: m}
+	graph := make(map[string][]string, len(images))
+	for hash, manifest := range images {
+		var deps []string
+		for _, dep := range manifest.Dependencies {
+			if dephash, depmanifest := lp.findImageDependency(dep); depmanifest != nil {
+				deps = append(deps, dephash)
+			}
+		}
+		graph[hash] = deps
+	}
+	return graph
+}
+
+// liveImages returns the set of images which are referenced, along with all of
+// their dependencies.
+func (m *Manager) liveImages(graph map[string][]string) map[string]bool {
+	m.referencesLock.Lock()
+	var pending []string
+	for _, hashes := range m.references {
+		pending = append(pending, hashes...)
+	}
+	m.referencesLock.Unlock()
+
+	live := make(map[string]bool)
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if live[hash] {
+			continue
+		}
+		live[hash] = true
+		pending = append(pending, graph[hash]...)
+	}
+	return live
+}
+
+// dependents returns the sorted list of images that directly depend on the
+// image.
+func dependents(graph map[string][]string, hash string) []string {
+	var images []string
+	for h, deps := range graph {
+		for _, dep := range deps {
+			if dep == hash {
+				images = append(images, h)
+				break
+			}
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// DeleteImage will remove the specified image hash from disk. It fails if the
+// image is referenced or another image depends on it.
+func (m *Manager) DeleteImage(hash string) error {
+	if hash == "" {
+		return nil
+	}
+
+	m.gcLock.Lock()
+	defer m.gcLock.Unlock()
+
+	if owners := m.owners(hash); len(owners) > 0 {
+		return fmt.Errorf("image %s is in use by %s", hash, strings.Join(owners, ", "))
+	}
+	if images := dependents(m.dependencyGraph(), hash); len(images) > 0 {
+		return fmt.Errorf("image %s is a dependency of %s", hash, strings.Join(images, ", "))
+	}
+	return m.removeImage(hash)
+}
+
+// GarbageCollect removes every image that isn't referenced and isn't a
+// dependency of a referenced image. It returns the hashes of the images that
+// were removed.
+func (m *Manager) GarbageCollect() ([]string, error) {
+	m.gcLock.Lock()
+	defer m.gcLock.Unlock()
+
+	graph := m.dependencyGraph()
+	live := m.liveImages(graph)
+
+	var removed []string
+	for hash := range graph {
+		if live[hash] {
+			continue
+		}
+		if err := m.removeImage(hash); err != nil {
+			return removed, fmt.Errorf("failed to remove image %s: %v", hash, err)
+		}
+		removed = append(removed, hash)
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// collectToWatermark removes unused images, least recently used first, when
+// the filesystem usage is above the high watermark, until it is at or below
+// the low watermark. An image is only removed once no remaining image depends
+// on it.
+func (m *Manager) collectToWatermark(opts GCOptions) error {
+	m.gcLock.Lock()
+	defer m.gcLock.Unlock()
+
+	usage, err := filesystemUsage(m.Options.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to check filesystem usage: %v", err)
+	}
+	if usage < opts.HighWatermark {
+		return nil
+	}
+
+	graph := m.dependencyGraph()
+	live := m.liveImages(graph)
+	candidates := make([]string, 0, len(graph))
+	lastUsed := make(map[string]time.Time, len(graph))
+	for hash := range graph {
+		if live[hash] {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(m.Options.Directory, hash)); err == nil {
+			lastUsed[hash] = fi.ModTime()
+		}
+		candidates = append(candidates, hash)
+	}
+	sort.Sort(&byLastUsed{hashes: candidates, lastUsed: lastUsed})
+
+	m.log.Infof("Image filesystem is %d%% full, removing unused images.", usage)
+	for usage > opts.LowWatermark {
+		hash := ""
+		for i, h := range candidates {
+			if len(dependents(graph, h)) == 0 {
+				hash = h
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
+		}
+		if hash == "" {
+			m.log.Warnf("Image filesystem is %d%% full, but no more images can be removed.", usage)
+			return nil
+		}
+
+		if err := m.removeImage(hash); err != nil {
+			return fmt.Errorf("failed to remove image %s: %v", hash, err)
+		}
+		delete(graph, hash)
+		m.log.Infof("Removed unused image %s.", hash)
+
+		if usage, err = filesystemUsage(m.Options.Directory); err != nil {
+			return fmt.Errorf("failed to check filesystem usage: %v", err)
+		}
+	}
+	return nil
+}
+
+// gcRoutine periodically checks the filesystem usage and removes unused images
+// when it is above the high watermark.
+func (m *Manager) gcRoutine(opts GCOptions) {
+	ticker := time.NewTicker(time.Duration(opts.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := m.collectToWatermark(opts); err != nil {
+			m.log.Errorf("Failed to garbage collect images: %v", err)
+		}
+	}
+}
+
+// byLastUsed sorts image hashes by when they were last used, oldest first.
+type byLastUsed struct {
+	hashes   []string
+	lastUsed map[string]time.Time
+}
+
+func (b *byLastUsed) Len() int      { return len(b.hashes) }
+func (b *byLastUsed) Swap(i, j int) { b.hashes[i], b.hashes[j] = b.hashes[j], b.hashes[i] }
+func (b *byLastUsed) Less(i, j int) bool {
+	return b.lastUsed[b.hashes[i]].Before(b.lastUsed[b.hashes[j]])
+}
+
+// removeImage removes the image from the manager and from disk.
+func (m *Manager) removeImage(hash string) error {
+	m.imagesLock.Lock()
+	manifest := m.images[hash]
+	delete(m.images, hash)
+	delete(m.sizes, hash)
+	delete(m.failed, hash)
+	m.imagesLock.Unlock()
+	if err := m.removeTags(hash, manifest); err != nil {
+		m.log.Warnf("Failed to remove the tags of image %s: %v", hash, err)
+	}
+	return os.RemoveAll(filepath.Join(m.Options.Directory, hash))
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+// createTestImage adds an image with the given name and dependencies to the
+// manager and returns its hash.
+func createTestImage(t *testing.T, manager *Manager, name string, deps ...string) string {
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	for _, dep := range deps {
+		manifest.Dependencies = append(manifest.Dependencies, types.Dependency{
+			ImageName: types.ACIdentifier(dep),
+		})
+	}
+
+	hash, _, err := manager.CreateImage(createImage(t, manifest))
+	tt.TestExpectSuccess(t, err)
+	return hash
+}
+
+func newTestManager(t *testing.T) *Manager {
+	m, err := New(&Options{Directory: tt.TempDir(t)})
+	tt.TestExpectSuccess(t, err)
+	return m.(*Manager)
+}
+
+func TestDeleteImageReferenced(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	base := createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+
+	manager.AddReferences("pod1", []string{app})
+
+	err := manager.DeleteImage(app)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.Contains(err.Error(), "in use by pod1"), true)
+
+	err = manager.DeleteImage(base)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.Contains(err.Error(), "is a dependency of "+app), true)
+
+	manager.RemoveReferences("pod1")
+	tt.TestExpectSuccess(t, manager.DeleteImage(app))
+	tt.TestExpectSuccess(t, manager.DeleteImage(base))
+	tt.TestEqual(t, len(manager.ListImages()), 0)
+}
+
+func TestGarbageCollect(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	base := createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+	other := createTestImage(t, manager, "example.com/other")
+
+	manager.AddReferences("pod1", []string{app})
+
+	removed, err := manager.GarbageCollect()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, removed, []string{other})
+	tt.TestNotEqual(t, manager.GetImage(app), nil)
+	tt.TestNotEqual(t, manager.GetImage(base), nil)
+
+	_, err = os.Stat(filepath.Join(manager.Options.Directory, other))
+	tt.TestEqual(t, os.IsNotExist(err), true)
+
+	manager.RemoveReferences("pod1")
+	removed, err = manager.GarbageCollect()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(removed), 2)
+	tt.TestEqual(t, len(manager.ListImages()), 0)
+}
+
+func TestCollectToWatermark(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	base := createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+	old := createTestImage(t, manager, "example.com/old")
+	recent := createTestImage(t, manager, "example.com/recent")
+	pinned := createTestImage(t, manager, "example.com/pinned")
+
+	manager.AddReferences("prefetch", []string{pinned})
+
+	// order the last use of the images, oldest first
+	now := time.Now()
+	for i, hash := range []string{old, base, app, recent, pinned} {
+		ts := now.Add(time.Duration(i-10) * time.Minute)
+		tt.TestExpectSuccess(t, os.Chtimes(filepath.Join(manager.Options.Directory, hash), ts, ts))
+	}
+
+	opts := GCOptions{HighWatermark: 90}
+	tt.TestExpectSuccess(t, opts.validate())
+	tt.TestEqual(t, opts.LowWatermark, 80)
+
+	defer func(f func(string) (int, error)) { filesystemUsage = f }(filesystemUsage)
+
+	// below the high watermark, nothing is removed
+	filesystemUsage = func(string) (int, error) { return 85, nil }
+	tt.TestExpectSuccess(t, manager.collectToWatermark(opts))
+	tt.TestEqual(t, len(manager.ListImages()), 5)
+
+	// above it, each removed image frees up 10% of the filesystem, so two images
+	// are removed. base is older than app, but is skipped since app depends on
+	// it.
+	filesystemUsage = func(string) (int, error) {
+		return 95 - 10*(5-len(manager.ListImages())), nil
+	}
+	tt.TestExpectSuccess(t, manager.collectToWatermark(opts))
+	tt.TestEqual(t, manager.GetImage(old), (*schema.ImageManifest)(nil))
+	tt.TestEqual(t, manager.GetImage(app), (*schema.ImageManifest)(nil))
+	tt.TestNotEqual(t, manager.GetImage(base), nil)
+	tt.TestNotEqual(t, manager.GetImage(recent), nil)
+	tt.TestNotEqual(t, manager.GetImage(pinned), nil)
+}
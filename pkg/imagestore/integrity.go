@@ -0,0 +1,225 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	// digestsFile is the name of the file within an image's directory which
+	// records the digests of the image's files.
+	digestsFile = "digests"
+
+	// maxReportedProblems is the number of problems listed when an image fails
+	// verification.
+	maxReportedProblems = 5
+)
+
+// IntegrityOptions configures the recording and verification of digests of
+// every file within an image, which catches images that have been corrupted
+// or tampered with on disk.
+type IntegrityOptions struct {
+	// Record enables recording the digests when an image is created. Images
+	// which were created without them have them recorded on the next rescan.
+	Record bool `json:"record,omitempty"`
+
+	// VerifyOnRescan verifies each image when the images are rescanned. Images
+	// which fail are kept on disk for the pods using them, but can't be used
+	// by new pods.
+	VerifyOnRescan bool `json:"verifyOnRescan,omitempty"`
+
+	// VerifyOnUse verifies each layer of an image when it is resolved for use
+	// by a pod.
+	VerifyOnUse bool `json:"verifyOnUse,omitempty"`
+}
+
+// validate ensures the digests are recorded if they are to be verified.
+func (o IntegrityOptions) validate() error {
+	if (o.VerifyOnRescan || o.VerifyOnUse) && !o.Record {
+		return fmt.Errorf("image digests must be recorded in order to verify them")
+	}
+	return nil
+}
+
+// fileDigest describes a file within an image. Regular files record the
+// digest of their contents and symlinks record their target.
+type fileDigest struct {
+	Mode   os.FileMode `json:"mode"`
+	UID    uint32      `json:"uid"`
+	GID    uint32      `json:"gid"`
+	Size   int64       `json:"size,omitempty"`
+	SHA256 string      `json:"sha256,omitempty"`
+	Link   string      `json:"link,omitempty"`
+}
+
+// VerifyImage checks that every file within the image still matches the
+// digests recorded when it was created. An image which fails is kept, so pods
+// already using it aren't disrupted, but can't be used by new pods until it
+// passes verification again or is deleted.
+func (m *Manager) VerifyImage(hash string) error {
+	err := m.verifyDigests(hash)
+
+	m.imagesLock.Lock()
+	defer m.imagesLock.Unlock()
+	if _, exists := m.images[hash]; exists {
+		if err != nil {
+			m.failed[hash] = err
+		} else {
+			delete(m.failed, hash)
+		}
+	}
+	return err
+}
+
+// verificationFailure returns the error the image last failed verification
+// with, or nil if it hasn't failed.
+func (m *Manager) verificationFailure(hash string) error {
+	m.imagesLock.RLock()
+	defer m.imagesLock.RUnlock()
+	return m.failed[hash]
+}
+
+// verifyDigests compares the image's files to their recorded digests.
+func (m *Manager) verifyDigests(hash string) error {
+	path := filepath.Join(m.Options.Directory, hash)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to locate image path: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(path, digestsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("image %s has no recorded digests", hash)
+		}
+		return fmt.Errorf("failed to read the digests of image %s: %v", hash, err)
+	}
+	var recorded map[string]*fileDigest
+	if err := json.Unmarshal(b, &recorded); err != nil {
+		return fmt.Errorf("failed to parse the digests of image %s: %v", hash, err)
+	}
+
+	current, err := computeDigests(path)
+	if err != nil {
+		return fmt.Errorf("failed to calculate the digests of image %s: %v", hash, err)
+	}
+
+	var problems []string
+	for name, digest := range recorded {
+		cur, exists := current[name]
+		switch {
+		case !exists:
+			problems = append(problems, "missing "+name)
+		case *cur != *digest:
+			problems = append(problems, "modified "+name)
+		}
+	}
+	for name := range current {
+		if _, exists := recorded[name]; !exists {
+			problems = append(problems, "unexpected "+name)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+	if len(problems) > maxReportedProblems {
+		more := len(problems) - maxReportedProblems
+		problems = append(problems[:maxReportedProblems], fmt.Sprintf("and %d more", more))
+	}
+	return fmt.Errorf("image %s failed verification: %s", hash, strings.Join(problems, ", "))
+}
+
+// hasDigests returns whether digests have been recorded for the image.
+func (m *Manager) hasDigests(hash string) bool {
+	_, err := os.Stat(filepath.Join(m.Options.Directory, hash, digestsFile))
+	return err == nil
+}
+
+// recordDigests calculates and persists the digests of the image's files.
+func (m *Manager) recordDigests(hash string) error {
+	path := filepath.Join(m.Options.Directory, hash)
+	digests, err := computeDigests(path)
+	if err != nil {
+		return fmt.Errorf("failed to calculate the digests of image %s: %v", hash, err)
+	}
+
+	b, err := json.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, digestsFile), b, os.FileMode(0644)); err != nil {
+		return fmt.Errorf("failed to write the digests of image %s: %v", hash, err)
+	}
+	return nil
+}
+
+// computeDigests walks the image's directory and returns the digest of each
+// file, keyed by its path relative to the directory. The files the image
+// store keeps alongside the manifest are skipped.
+func computeDigests(dir string) (map[string]*fileDigest, error) {
+	digests := make(map[string]*fileDigest)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if name == "." || name == digestsFile || name == imageSizeFile {
+			return nil
+		}
+
+		digest := &fileDigest{Mode: fi.Mode()}
+		if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+			digest.UID = stat.Uid
+			digest.GID = stat.Gid
+		}
+
+		switch {
+		case fi.Mode().IsRegular():
+			digest.Size = fi.Size()
+			if digest.SHA256, err = fileSHA256(p); err != nil {
+				return err
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			if digest.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		digests[name] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// fileSHA256 returns the hex encoded SHA256 digest of the file's contents.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
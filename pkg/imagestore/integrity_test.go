@@ -0,0 +1,103 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func newIntegrityManager(t *testing.T, dir string, integrity IntegrityOptions) *Manager {
+	m, err := New(&Options{Directory: dir, Integrity: integrity})
+	tt.TestExpectSuccess(t, err)
+	return m.(*Manager)
+}
+
+func TestVerifyImage(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newIntegrityManager(t, tt.TempDir(t), IntegrityOptions{Record: true})
+	hash := createTestImage(t, manager, "example.com/app")
+	tt.TestExpectSuccess(t, manager.VerifyImage(hash))
+
+	rootfs := filepath.Join(manager.Options.Directory, hash, "rootfs")
+
+	// modified contents
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(rootfs, "blah"), []byte("evil"), 0644))
+	err := manager.VerifyImage(hash)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.HasSuffix(err.Error(), "failed verification: modified rootfs/blah"), true)
+
+	// modified permissions
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(rootfs, "blah"), []byte("blah"), 0644))
+	tt.TestExpectSuccess(t, os.Chmod(filepath.Join(rootfs, "blah"), 0777))
+	err = manager.VerifyImage(hash)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.HasSuffix(err.Error(), "modified rootfs/blah"), true)
+
+	// missing and unexpected files
+	tt.TestExpectSuccess(t, os.Rename(filepath.Join(rootfs, "blah"), filepath.Join(rootfs, "other")))
+	err = manager.VerifyImage(hash)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.HasSuffix(err.Error(), "missing rootfs/blah, unexpected rootfs/other"), true)
+}
+
+func TestVerifyImageWithoutDigests(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	dir := tt.TempDir(t)
+	manager := newIntegrityManager(t, dir, IntegrityOptions{})
+	hash := createTestImage(t, manager, "example.com/app")
+
+	err := manager.VerifyImage(hash)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, strings.Contains(err.Error(), "no recorded digests"), true)
+
+	// enabling recording records the digests of the existing image
+	manager = newIntegrityManager(t, dir, IntegrityOptions{Record: true})
+	tt.TestExpectSuccess(t, manager.VerifyImage(hash))
+}
+
+func TestVerifyOnRescanAndUse(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	_, err := New(&Options{Directory: tt.TempDir(t), Integrity: IntegrityOptions{VerifyOnUse: true}})
+	tt.TestExpectError(t, err)
+
+	integrity := IntegrityOptions{Record: true, VerifyOnRescan: true, VerifyOnUse: true}
+	manager := newIntegrityManager(t, tt.TempDir(t), integrity)
+	base := createTestImage(t, manager, "example.com/base")
+	app := createTestImage(t, manager, "example.com/app", "example.com/base")
+
+	_, err = manager.ResolveTree(app)
+	tt.TestExpectSuccess(t, err)
+
+	// tampering with a dependency prevents the image from being used
+	baseFile := filepath.Join(manager.Options.Directory, base, "rootfs", "blah")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(baseFile, []byte("evil"), 0644))
+	_, err = manager.ResolveTree(app)
+	tt.TestExpectError(t, err)
+
+	// the tampered image is kept on rescan for the pods using it, but can't
+	// be used by new pods
+	manager = newIntegrityManager(t, manager.Options.Directory, IntegrityOptions{Record: true, VerifyOnRescan: true})
+	tt.TestEqual(t, manager.GetImage(base) != nil, true)
+	_, err = os.Stat(filepath.Join(manager.Options.Directory, base))
+	tt.TestExpectSuccess(t, err)
+	_, err = manager.ResolveTree(app)
+	tt.TestExpectError(t, err)
+
+	// until it passes verification again
+	tt.TestExpectSuccess(t, ioutil.WriteFile(baseFile, []byte("blah"), 0644))
+	tt.TestExpectSuccess(t, manager.VerifyImage(base))
+	_, err = manager.ResolveTree(app)
+	tt.TestExpectSuccess(t, err)
+}
@@ -25,6 +25,14 @@ import (
 type Options struct {
 	Directory string
 	Log       *logray.Logger
+
+	// GC configures the periodic removal of unused images when disk space runs
+	// low.
+	GC GCOptions
+
+	// Integrity configures the recording and verification of the digests of
+	// the files within images.
+	Integrity IntegrityOptions
 }
 
 // Manager handles the management of the containers running and available on the
@@ -35,25 +43,55 @@ type Manager struct {
 	Options *Options
 
 	images     map[string]*schema.ImageManifest
+	sizes      map[string]*imageSize
 	imagesLock sync.RWMutex
+
+	// failed maps the hashes of images which failed verification to the
+	// error they failed with. It is guarded by the images lock.
+	failed map[string]error
+
+	// references maps the owner of image references, such as a pod's UUID, to
+	// the hashes of the images it uses.
+	references     map[string][]string
+	referencesLock sync.Mutex
+
+	// tags maps image names to their tags, and the hashes of the images they
+	// refer to. It is nil until the tags are loaded.
+	tags     map[string]map[string]string
+	tagsLock sync.Mutex
+
+	// gcLock serializes the removal of images.
+	gcLock sync.Mutex
 }
 
 // New will create and return a new Manager for managing images.
 func New(options *Options) (backend.ImageManager, error) {
 	m := &Manager{
-		log:     options.Log,
-		Options: options,
+		log:        options.Log,
+		Options:    options,
+		references: make(map[string][]string),
 	}
 
 	if m.log == nil {
 		m.log = logray.New()
 	}
 
+	if err := options.Integrity.validate(); err != nil {
+		return nil, err
+	}
+
 	// load the list of existing image manifests
 	if err := m.Rescan(); err != nil {
 		return nil, err
 	}
 
+	if options.GC.Enabled() {
+		if err := options.GC.validate(); err != nil {
+			return nil, err
+		}
+		go m.gcRoutine(options.GC)
+	}
+
 	return m, nil
 }
 
@@ -61,7 +99,12 @@ func New(options *Options) (backend.ImageManager, error) {
 func (m *Manager) Rescan() error {
 	m.imagesLock.Lock()
 	m.images = make(map[string]*schema.ImageManifest)
+	m.sizes = make(map[string]*imageSize)
+	m.failed = make(map[string]error)
 	m.imagesLock.Unlock()
+	m.tagsLock.Lock()
+	m.tags = nil
+	m.tagsLock.Unlock()
 
 	contents, err := ioutil.ReadDir(m.Options.Directory)
 	if err != nil {
@@ -75,9 +118,29 @@ func (m *Manager) Rescan() error {
 		if _, err := m.loadFile(fi); err != nil {
 			m.log.Warnf("Failed to load existing manifest at %s: %v", fi.Name(), err)
 			os.RemoveAll(filepath.Join(m.Options.Directory, fi.Name()))
+			continue
+		}
+		if err := m.checkIntegrity(fi.Name()); err != nil {
+			m.log.Errorf("Failed to check the integrity of image %s: %v", fi.Name(), err)
 		}
 	}
 
+	return m.loadTags()
+}
+
+// checkIntegrity records the digests of an image loaded from disk if they are
+// missing, or verifies them if the manager is configured to on rescan.
+func (m *Manager) checkIntegrity(hash string) error {
+	if !m.Options.Integrity.Record {
+		return nil
+	}
+	if !m.hasDigests(hash) {
+		m.log.Infof("Recording the digests of existing image %s.", hash)
+		return m.recordDigests(hash)
+	}
+	if m.Options.Integrity.VerifyOnRescan {
+		return m.VerifyImage(hash)
+	}
 	return nil
 }
 
@@ -97,7 +160,11 @@ func (m *Manager) CreateImage(reader io.Reader) (string, *schema.ImageManifest,
 	// double check we don't already have it
 	m.imagesLock.RLock()
 	manifest, exists := m.images[hash]
+	failure := m.failed[hash]
 	m.imagesLock.RUnlock()
+	if failure != nil {
+		return "", nil, fmt.Errorf("the existing copy of image %s must be deleted before it is loaded again: %v", hash, failure)
+	}
 	if exists {
 		return hash, manifest, nil
 	}
@@ -129,11 +196,28 @@ func (m *Manager) CreateImage(reader io.Reader) (string, *schema.ImageManifest,
 		return "", nil, fmt.Errorf("failed to extract image filesystem: %v", err)
 	}
 
+	if m.Options.Integrity.Record {
+		if err := m.recordDigests(hash); err != nil {
+			return "", nil, err
+		}
+	}
+
 	// load the manifest and return it
 	manifest, err = m.loadFile(fi)
 	if err != nil {
 		return "", nil, err
 	}
+	if _, err := m.recordSize(hash, hr.Length()); err != nil {
+		m.imagesLock.Lock()
+		delete(m.images, hash)
+		m.imagesLock.Unlock()
+		return "", nil, err
+	}
+
+	if err := m.updateLatest(hash, manifest); err != nil {
+		m.log.Warnf("Failed to update the latest tag of %s: %v", manifest.Name, err)
+	}
+
 	successful = true
 	return hash, manifest, nil
 }
@@ -154,45 +238,35 @@ func (m *Manager) GetImage(hash string) *schema.ImageManifest {
 }
 
 // FindImage will find the image manifest and hash for the specified name and
-// version label.
+// version label. When the version is empty, the image with the greatest
+// version is returned. Tags are not consulted, since they may alias images
+// with other names.
 func (m *Manager) FindImage(name, version string) (string, *schema.ImageManifest) {
 	m.imagesLock.RLock()
 	defer m.imagesLock.RUnlock()
 
+	if version == "" {
+		if latest := m.findLatest(name); latest != "" {
+			return latest, m.images[latest]
+		}
+		return "", nil
+	}
+
+	// the match with the lowest hash is returned, so the result is consistent
+	// when several images have the same version
+	var found string
 	for hash, manifest := range m.images {
-		if manifest.Name.String() != name {
+		if manifest.Name.String() != name || imageVersion(manifest) != version {
 			continue
 		}
-
-		v, _ := manifest.Labels.Get("version")
-		if v == version || version == "" {
-			return hash, manifest
+		if found == "" || hash < found {
+			found = hash
 		}
 	}
-
-	return "", nil
-}
-
-// GetImageSize will return the on disk size of the image.
-func (m *Manager) GetImageSize(hash string) (int64, error) {
-	path := filepath.Join(m.Options.Directory, hash)
-	if _, err := os.Stat(path); err != nil {
-		return 0, fmt.Errorf("failed to locate image path: %v", err)
+	if found == "" {
+		return "", nil
 	}
-
-	// FIXME need a real way to do this
-	return 0, nil
-}
-
-// DeleteImage will remove the specified image hash from disk.
-func (m *Manager) DeleteImage(hash string) error {
-	if hash == "" {
-		return nil
-	}
-	m.imagesLock.Lock()
-	delete(m.images, hash)
-	m.imagesLock.Unlock()
-	return os.RemoveAll(filepath.Join(m.Options.Directory, hash))
+	return found, m.images[found]
 }
 
 // ResolveTree will resolve the dependency tree for the specified image. It
@@ -206,6 +280,16 @@ func (m *Manager) ResolveTree(hash string) (*backend.ResolutionTree, error) {
 		return nil, err
 	}
 
+	for _, layer := range layers {
+		if m.Options.Integrity.VerifyOnUse {
+			if err := m.VerifyImage(layer); err != nil {
+				return nil, err
+			}
+		} else if err := m.verificationFailure(layer); err != nil {
+			return nil, err
+		}
+	}
+
 	// convert the list of hashes into a list of directories and get the manifests
 	paths := make(map[string]string, len(layers))
 	manifests := make(map[string]*schema.ImageManifest, len(layers))
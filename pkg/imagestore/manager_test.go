@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -180,3 +182,48 @@ func writeFile(t *testing.T, archive *tar.Writer, name, contents string) {
 	tt.TestExpectSuccess(t, err)
 	tt.TestExpectSuccess(t, archive.Flush())
 }
+
+func TestGetImageSize(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	base := createTestImage(t, manager, "example.com/base")
+
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier("example.com/app")
+	manifest.Dependencies = types.Dependencies{{ImageName: types.ACIdentifier("example.com/base")}}
+	image := createImage(t, manifest).(*bytes.Buffer)
+	compressed := int64(image.Len())
+	app, _, err := manager.CreateImage(image)
+	tt.TestExpectSuccess(t, err)
+
+	basesize, err := manager.GetImageSize(base)
+	tt.TestExpectSuccess(t, err)
+	tt.TestNotEqual(t, basesize.Extracted, int64(0))
+	tt.TestEqual(t, basesize.Total, basesize.Extracted)
+
+	appsize, err := manager.GetImageSize(app)
+	tt.TestExpectSuccess(t, err)
+	tt.TestNotEqual(t, appsize.Extracted, int64(0))
+	tt.TestEqual(t, appsize.Compressed, compressed)
+	tt.TestEqual(t, appsize.Total, appsize.Extracted+basesize.Extracted)
+
+	// the sizes are persisted across a rescan
+	tt.TestExpectSuccess(t, manager.Rescan())
+	size, err := manager.GetImageSize(app)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, size, appsize)
+
+	// and recalculated if the size file is missing, though the compressed size
+	// is lost
+	tt.TestExpectSuccess(t, os.Remove(filepath.Join(manager.Options.Directory, app, imageSizeFile)))
+	tt.TestExpectSuccess(t, manager.Rescan())
+	size, err = manager.GetImageSize(app)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, size.Extracted, appsize.Extracted)
+	tt.TestEqual(t, size.Compressed, int64(0))
+
+	_, err = manager.GetImageSize("sha512-missing")
+	tt.TestExpectError(t, err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/misc"
+)
+
+// imageSizeFile is the name of the file within an image's directory which
+// records the image's sizes.
+const imageSizeFile = "size"
+
+// imageSize is the size information persisted alongside an image's manifest.
+type imageSize struct {
+	Extracted  int64 `json:"extracted"`
+	Compressed int64 `json:"compressed,omitempty"`
+}
+
+// GetImageSize will return the on disk size of the image, the size of the
+// image as it was uploaded, and the on disk size of the image along with all
+// of its dependencies.
+func (m *Manager) GetImageSize(hash string) (*backend.ImageSize, error) {
+	path := filepath.Join(m.Options.Directory, hash)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to locate image path: %v", err)
+	}
+
+	size, err := m.imageSize(hash)
+	if err != nil {
+		return nil, err
+	}
+	result := &backend.ImageSize{
+		Extracted:  size.Extracted,
+		Compressed: size.Compressed,
+		Total:      size.Extracted,
+	}
+
+	// If the dependencies can't be resolved, the total is left as the size of
+	// the image itself.
+	layers, err := m.processLayers(hash)
+	if err != nil {
+		m.log.Debugf("Failed to resolve the dependencies of image %s: %v", hash, err)
+		return result, nil
+	}
+	for _, layer := range layers[1:] {
+		depsize, err := m.imageSize(layer)
+		if err != nil {
+			return nil, err
+		}
+		result.Total += depsize.Extracted
+	}
+	return result, nil
+}
+
+// imageSize returns the cached size of the image. If it isn't cached, it is
+// loaded from the image's size file, or if that is missing, calculated from
+// the extracted image and persisted.
+func (m *Manager) imageSize(hash string) (*imageSize, error) {
+	m.imagesLock.RLock()
+	size := m.sizes[hash]
+	m.imagesLock.RUnlock()
+	if size != nil {
+		return size, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(m.Options.Directory, hash, imageSizeFile))
+	if err == nil {
+		size = &imageSize{}
+		if err := json.Unmarshal(b, size); err != nil {
+			m.log.Warnf("Failed to parse the size of image %s, recalculating: %v", hash, err)
+			size = nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the size of image %s: %v", hash, err)
+	}
+
+	if size == nil {
+		// the compressed size is only known when the image is created
+		return m.recordSize(hash, 0)
+	}
+
+	m.imagesLock.Lock()
+	m.sizes[hash] = size
+	m.imagesLock.Unlock()
+	return size, nil
+}
+
+// recordSize calculates the extracted size of the image, then persists and
+// caches it along with the compressed size.
+func (m *Manager) recordSize(hash string, compressed int64) (*imageSize, error) {
+	path := filepath.Join(m.Options.Directory, hash)
+	extracted, err := misc.DiskUsage(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate the size of image %s: %v", hash, err)
+	}
+	size := &imageSize{Extracted: extracted, Compressed: compressed}
+
+	b, err := json.Marshal(size)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, imageSizeFile), b, os.FileMode(0644)); err != nil {
+		return nil, fmt.Errorf("failed to write the size of image %s: %v", hash, err)
+	}
+
+	m.imagesLock.Lock()
+	m.sizes[hash] = size
+	m.imagesLock.Unlock()
+	return size, nil
+}
@@ -0,0 +1,319 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/coreos/go-semver/semver"
+)
+
+const (
+	// LatestTag is the tag which refers to the image with the greatest
+	// version of each name. It is updated as images are created.
+	LatestTag = "latest"
+
+	// tagsFile is the file within the images directory holding the tag index.
+	tagsFile = "tags.json"
+)
+
+// tagPattern matches valid tags.
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// ParseReference splits an image reference in the form "name[:tag]" into the
+// name and tag. The tag is LatestTag when it isn't given.
+func ParseReference(ref string) (string, string) {
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, LatestTag
+}
+
+// TagImage tags the image with the name and tag, replacing the image the tag
+// previously referred to. The name needn't match the name in the image's
+// manifest, so tags may be used as aliases.
+func (m *Manager) TagImage(hash, name, tag string) error {
+	if _, err := types.NewACIdentifier(name); err != nil {
+		return fmt.Errorf("invalid image name %q: %v", name, err)
+	}
+	if !tagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+	if m.GetImage(hash) == nil {
+		return fmt.Errorf("image %s not found", hash)
+	}
+
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+	m.setTag(name, tag, hash)
+	return m.saveTags()
+}
+
+// UntagImage removes the name and tag from the image it refers to.
+func (m *Manager) UntagImage(name, tag string) error {
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+
+	if _, exists := m.tags[name][tag]; !exists {
+		return fmt.Errorf("tag %s:%s not found", name, tag)
+	}
+	delete(m.tags[name], tag)
+	if len(m.tags[name]) == 0 {
+		delete(m.tags, name)
+	}
+	return m.saveTags()
+}
+
+// ResolveImage returns the hash and manifest of the image the name and tag
+// refer to. Tags which haven't been set refer to the image with the name and a
+// matching version label. The hash is empty if no image matches. Tags are only
+// used to resolve references given through the API, since they may alias
+// images with other names; dependencies are found with FindImage.
+func (m *Manager) ResolveImage(name, tag string) (string, *schema.ImageManifest) {
+	if tag == "" {
+		tag = LatestTag
+	}
+
+	m.tagsLock.Lock()
+	hash := m.tags[name][tag]
+	m.tagsLock.Unlock()
+	if hash != "" {
+		if manifest := m.GetImage(hash); manifest != nil {
+			return hash, manifest
+		}
+	}
+
+	if tag == LatestTag {
+		return m.FindImage(name, "")
+	}
+	return m.FindImage(name, tag)
+}
+
+// ImageTags returns the references, in the form "name:tag", which refer to
+// the image.
+func (m *Manager) ImageTags(hash string) []string {
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+
+	var refs []string
+	for name, tags := range m.tags {
+		for tag, h := range tags {
+			if h == hash {
+				refs = append(refs, name+":"+tag)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// findLatest returns the hash of the image with the name and the greatest
+// version. The images lock must be held.
+func (m *Manager) findLatest(name string) string {
+	var latest string
+	for hash, manifest := range m.images {
+		if manifest.Name.String() != name {
+			continue
+		}
+		if latest == "" || compareImages(hash, manifest, latest, m.images[latest]) > 0 {
+			latest = hash
+		}
+	}
+	return latest
+}
+
+// updateLatest points the latest tag of the image's name at the image, if its
+// version is at least as great as the image the tag refers to.
+func (m *Manager) updateLatest(hash string, manifest *schema.ImageManifest) error {
+	name := manifest.Name.String()
+
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+
+	current := m.tags[name][LatestTag]
+	if current == hash {
+		return nil
+	}
+	if currentManifest := m.GetImage(current); currentManifest != nil &&
+		compareVersions(imageVersion(manifest), imageVersion(currentManifest)) < 0 {
+		return nil
+	}
+	m.setTag(name, LatestTag, hash)
+	return m.saveTags()
+}
+
+// removeTags removes the tags referring to an image which was removed. The
+// latest tag of its name is pointed at the remaining image with the greatest
+// version.
+func (m *Manager) removeTags(hash string, manifest *schema.ImageManifest) error {
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+
+	// images removed while rescanning are dropped when the index is loaded
+	if m.tags == nil {
+		return nil
+	}
+
+	changed := false
+	for name, tags := range m.tags {
+		for tag, h := range tags {
+			if h == hash {
+				delete(tags, tag)
+				changed = true
+			}
+		}
+		if len(tags) == 0 {
+			delete(m.tags, name)
+		}
+	}
+	if manifest != nil {
+		name := manifest.Name.String()
+		if _, exists := m.tags[name][LatestTag]; !exists {
+			m.imagesLock.RLock()
+			latest := m.findLatest(name)
+			m.imagesLock.RUnlock()
+			if latest != "" {
+				m.setTag(name, LatestTag, latest)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.saveTags()
+}
+
+// loadTags reads the tag index from disk, dropping the tags of images which no
+// longer exist. Names without a latest tag are given one.
+func (m *Manager) loadTags() error {
+	m.tagsLock.Lock()
+	defer m.tagsLock.Unlock()
+
+	m.tags = make(map[string]map[string]string)
+	b, err := ioutil.ReadFile(filepath.Join(m.Options.Directory, tagsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the image tags: %v", err)
+	}
+	if err == nil {
+		var tags map[string]map[string]string
+		if err := json.Unmarshal(b, &tags); err != nil {
+			m.log.Warnf("Failed to parse the image tags, they will be rebuilt: %v", err)
+		}
+		for name, nameTags := range tags {
+			for tag, hash := range nameTags {
+				if m.GetImage(hash) != nil {
+					m.setTag(name, tag, hash)
+				}
+			}
+		}
+	}
+
+	m.imagesLock.RLock()
+	for _, manifest := range m.images {
+		name := manifest.Name.String()
+		if _, exists := m.tags[name][LatestTag]; !exists {
+			m.setTag(name, LatestTag, m.findLatest(name))
+		}
+	}
+	m.imagesLock.RUnlock()
+
+	return m.saveTags()
+}
+
+// setTag updates the tag in memory. The tags lock must be held.
+func (m *Manager) setTag(name, tag, hash string) {
+	if m.tags[name] == nil {
+		m.tags[name] = make(map[string]string)
+	}
+	m.tags[name][tag] = hash
+}
+
+// saveTags writes the tag index to disk. The tags lock must be held.
+func (m *Manager) saveTags() error {
+	b, err := json.Marshal(m.tags)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(m.Options.Directory, ".tags")
+	if err != nil {
+		return fmt.Errorf("failed to save the image tags: %v", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to save the image tags: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to save the image tags: %v", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(m.Options.Directory, tagsFile)); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to save the image tags: %v", err)
+	}
+	return nil
+}
+
+// imageVersion returns the image's version label.
+func imageVersion(manifest *schema.ImageManifest) string {
+	version, _ := manifest.Labels.Get("version")
+	return version
+}
+
+// compareImages orders images by their versions, and then by their hashes so
+// the order is deterministic.
+func compareImages(hashA string, a *schema.ImageManifest, hashB string, b *schema.ImageManifest) int {
+	if c := compareVersions(imageVersion(a), imageVersion(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(hashA, hashB)
+}
+
+// compareVersions orders version labels by semantic versioning. Versions
+// missing a minor or patch number are treated as zero, and versions which
+// aren't semantic versions are ordered before those that are.
+func compareVersions(a, b string) int {
+	va, vb := parseVersion(a), parseVersion(b)
+	switch {
+	case va == nil && vb == nil:
+		return strings.Compare(a, b)
+	case va == nil:
+		return -1
+	case vb == nil:
+		return 1
+	case va.LessThan(*vb):
+		return -1
+	case vb.LessThan(*va):
+		return 1
+	}
+	return 0
+}
+
+// parseVersion parses the version label as a semantic version, or returns nil
+// if it isn't one.
+func parseVersion(version string) *semver.Version {
+	version = strings.TrimPrefix(version, "v")
+	core, suffix := version, ""
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		core, suffix = version[:i], version[i:]
+	}
+	for n := strings.Count(core, "."); n < 2; n++ {
+		core += ".0"
+	}
+	v, err := semver.NewVersion(core + suffix)
+	if err != nil {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package imagestore
+
+import (
+	"testing"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+// createVersionedImage adds an image with the given name and version label to
+// the manager and returns its hash.
+func createVersionedImage(t *testing.T, manager *Manager, name, version string) string {
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	manifest.Labels = types.Labels{{Name: "version", Value: version}}
+
+	hash, _, err := manager.CreateImage(createImage(t, manifest))
+	tt.TestExpectSuccess(t, err)
+	return hash
+}
+
+func TestLatestTag(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	v1 := createVersionedImage(t, manager, "example.com/app", "1.9.0")
+	v2 := createVersionedImage(t, manager, "example.com/app", "1.10")
+	createVersionedImage(t, manager, "example.com/app", "1.2.0")
+
+	// latest follows the greatest version, rather than the last created
+	hash, _ := manager.FindImage("example.com/app", "")
+	tt.TestEqual(t, hash, v2)
+	hash, _ = manager.ResolveImage("example.com/app", "")
+	tt.TestEqual(t, hash, v2)
+
+	// unset tags resolve by version label
+	hash, _ = manager.ResolveImage("example.com/app", "1.9.0")
+	tt.TestEqual(t, hash, v1)
+	hash, _ = manager.ResolveImage("example.com/app", "2.0.0")
+	tt.TestEqual(t, hash, "")
+
+	// removing the latest image moves the tag to the next greatest version
+	tt.TestExpectSuccess(t, manager.DeleteImage(v2))
+	hash, _ = manager.ResolveImage("example.com/app", LatestTag)
+	tt.TestEqual(t, hash, v1)
+}
+
+func TestTagImage(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := newTestManager(t)
+	v1 := createVersionedImage(t, manager, "example.com/app", "1.0.0")
+	v2 := createVersionedImage(t, manager, "example.com/app", "2.0.0")
+
+	tt.TestExpectSuccess(t, manager.TagImage(v1, "example.com/app", "stable"))
+	tt.TestExpectSuccess(t, manager.TagImage(v1, "example.com/alias", "1.0"))
+	tt.TestExpectError(t, manager.TagImage(v1, "Invalid Name", "stable"))
+	tt.TestExpectError(t, manager.TagImage(v1, "example.com/app", "bad:tag"))
+	tt.TestExpectError(t, manager.TagImage("sha512-missing", "example.com/app", "stable"))
+
+	hash, _ := manager.ResolveImage("example.com/app", "stable")
+	tt.TestEqual(t, hash, v1)
+	hash, _ = manager.ResolveImage("example.com/alias", "1.0")
+	tt.TestEqual(t, hash, v1)
+	tt.TestEqual(t, manager.ImageTags(v1), []string{"example.com/alias:1.0", "example.com/app:stable"})
+	tt.TestEqual(t, manager.ImageTags(v2), []string{"example.com/app:latest"})
+
+	// tags don't change how dependencies are found
+	tt.TestExpectSuccess(t, manager.TagImage(v1, "example.com/app", LatestTag))
+	hash, _ = manager.ResolveImage("example.com/app", LatestTag)
+	tt.TestEqual(t, hash, v1)
+	hash, _ = manager.FindImage("example.com/app", "")
+	tt.TestEqual(t, hash, v2)
+	hash, _ = manager.FindImage("example.com/alias", "")
+	tt.TestEqual(t, hash, "")
+	tt.TestExpectSuccess(t, manager.TagImage(v2, "example.com/app", LatestTag))
+
+	// the tags are kept across restarts
+	tt.TestExpectSuccess(t, manager.Rescan())
+	hash, _ = manager.ResolveImage("example.com/app", "stable")
+	tt.TestEqual(t, hash, v1)
+
+	tt.TestExpectSuccess(t, manager.UntagImage("example.com/app", "stable"))
+	tt.TestExpectError(t, manager.UntagImage("example.com/app", "stable"))
+	hash, _ = manager.ResolveImage("example.com/app", "stable")
+	tt.TestEqual(t, hash, "")
+}
+
+func TestParseReference(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	tests := map[string][2]string{
+		"example.com/app":        {"example.com/app", LatestTag},
+		"example.com/app:1.0":    {"example.com/app", "1.0"},
+		"example.com:80/app":     {"example.com:80/app", LatestTag},
+		"example.com:80/app:1.0": {"example.com:80/app", "1.0"},
+	}
+	for ref, expected := range tests {
+		name, tag := ParseReference(ref)
+		tt.TestEqual(t, [2]string{name, tag}, expected)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	tt.TestEqual(t, compareVersions("1.10.0", "1.9.0"), 1)
+	tt.TestEqual(t, compareVersions("1.0", "1.0.0"), 0)
+	tt.TestEqual(t, compareVersions("v2", "1.5.0"), 1)
+	tt.TestEqual(t, compareVersions("1.0.0-beta", "1.0.0"), -1)
+	tt.TestEqual(t, compareVersions("nightly", "0.0.1"), -1)
+}
@@ -0,0 +1,290 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+// Package logdriver forwards application output to remote log collectors. Each
+// line of output is sent as an individual record tagged with the pod and app it
+// came from.
+package logdriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+var (
+	// dialTimeout is how long to wait when connecting to a collector.
+	dialTimeout = time.Second * 5
+
+	// writeTimeout is how long a single record may take to be written before
+	// the connection is considered broken.
+	writeTimeout = time.Second * 5
+
+	// redialInterval is the minimum time between attempts to connect to a
+	// collector after a failure. Records are dropped in the meantime.
+	redialInterval = time.Second * 10
+
+	// maxLineLength is the longest line that is buffered while waiting for a
+	// newline. Longer lines are sent in pieces.
+	maxLineLength = 16 * 1024
+
+	// queueLength is the number of records which may be waiting to be sent
+	// before further records are dropped.
+	queueLength = 1024
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+
+	// syslog facility and severities, per RFC 3164
+	syslogFacilityUser = 1
+	syslogSeverityErr  = 3
+	syslogSeverityInfo = 6
+)
+
+// Tags identify the source of the output sent through a driver.
+type Tags struct {
+	PodUUID string
+	PodName string
+	AppName string
+	Stream  string
+}
+
+// New returns a writer which forwards output to the collector configured by
+// the log driver isolator. A nil writer is returned for the file driver, since
+// output is only written to the local log files.
+func New(config *kschema.LogDriver, tags Tags) (io.WriteCloser, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	network, address, err := config.Endpoint()
+	switch config.Driver {
+	case kschema.LogDriverFile:
+		return nil, nil
+	case kschema.LogDriverSyslog:
+		if err != nil {
+			return nil, err
+		}
+		return newWriter(network, address, tags, formatSyslog), nil
+	case kschema.LogDriverJSON:
+		if err != nil {
+			return nil, err
+		}
+		return newWriter(network, address, tags, formatJSON), nil
+	default:
+		return nil, fmt.Errorf("unrecognized log driver %q", config.Driver)
+	}
+}
+
+// formatter turns a single line of output into a record to send.
+type formatter func(tags Tags, t time.Time, line []byte) []byte
+
+// writer splits the output written to it into lines and queues each line to be
+// sent to the collector as a record. Writes never fail or block on the
+// collector, so an unavailable or slow collector does not stall the
+// application. Instead, records are dropped when the queue is full or the
+// collector can't be reached, and the number dropped is reported to the
+// collector once records can be sent again.
+type writer struct {
+	// dropped counts the records dropped since they were last reported. It is
+	// first so it is aligned for atomic operations.
+	dropped uint64
+
+	network string
+	address string
+	tags    Tags
+	format  formatter
+
+	// records holds the records waiting to be sent.
+	records chan []byte
+
+	buf    []byte
+	closed bool
+	mutex  sync.Mutex
+
+	// conn and nextDial are only used by the routine sending the records.
+	conn     net.Conn
+	nextDial time.Time
+}
+
+func newWriter(network, address string, tags Tags, format formatter) *writer {
+	w := &writer{
+		network: network,
+		address: address,
+		tags:    tags,
+		format:  format,
+		records: make(chan []byte, queueLength),
+	}
+	go w.sendRoutine()
+	return w
+}
+
+// Write buffers the output and queues any complete lines.
+func (w *writer) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return len(p), nil
+	}
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			if len(w.buf) < maxLineLength {
+				break
+			}
+			i = maxLineLength
+		}
+		w.queue(w.buf[:i])
+		if i < len(w.buf) && w.buf[i] == '\n' {
+			i++
+		}
+		w.buf = w.buf[i:]
+	}
+
+	// reclaim the buffer's space once it has been drained
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close queues any partial line that remains. The connection is closed once
+// the queued records have been sent.
+func (w *writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	if len(w.buf) > 0 {
+		w.queue(w.buf)
+		w.buf = nil
+	}
+	w.closed = true
+	close(w.records)
+	return nil
+}
+
+// queue formats the line as a record and queues it to be sent, or drops it if
+// the queue is full.
+func (w *writer) queue(line []byte) {
+	record := w.format(w.tags, time.Now(), line)
+	select {
+	case w.records <- record:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+// sendRoutine sends the queued records until the writer is closed.
+func (w *writer) sendRoutine() {
+	for record := range w.records {
+		w.send(record)
+	}
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// send writes a single record, connecting first if needed and reporting any
+// records which were dropped before it. The record is dropped if the collector
+// can't be reached.
+func (w *writer) send(record []byte) {
+	if !w.connect() {
+		atomic.AddUint64(&w.dropped, 1)
+		return
+	}
+
+	if dropped := atomic.SwapUint64(&w.dropped, 0); dropped > 0 {
+		notice := w.format(w.tags, time.Now(), []byte(fmt.Sprintf("%d log records were dropped", dropped)))
+		if !w.write(notice) {
+			atomic.AddUint64(&w.dropped, dropped+1)
+			return
+		}
+	}
+
+	if !w.write(record) {
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+// connect ensures there is a connection to the collector. Connections aren't
+// attempted again until the redial interval has passed after a failure.
+func (w *writer) connect() bool {
+	if w.conn != nil {
+		return true
+	}
+	now := time.Now()
+	if now.Before(w.nextDial) {
+		return false
+	}
+	conn, err := net.DialTimeout(w.network, w.address, dialTimeout)
+	if err != nil {
+		w.nextDial = now.Add(redialInterval)
+		return false
+	}
+	w.conn = conn
+	return true
+}
+
+// write writes the record to the connection, closing it if the write fails.
+func (w *writer) write(record []byte) bool {
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := w.conn.Write(record); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.nextDial = time.Now().Add(redialInterval)
+		return false
+	}
+	return true
+}
+
+// formatSyslog formats the line as an RFC 3164 syslog message. The pod name is
+// used as the hostname and the app name as the tag, with the pod's UUID leading
+// the message.
+func formatSyslog(tags Tags, t time.Time, line []byte) []byte {
+	severity := syslogSeverityInfo
+	if tags.Stream == StreamStderr {
+		severity = syslogSeverityErr
+	}
+	priority := syslogFacilityUser*8 + severity
+
+	return []byte(fmt.Sprintf("<%d>%s %s %s: pod_uuid=%s %s\n",
+		priority, t.Format(time.Stamp), tags.PodName, tags.AppName, tags.PodUUID, line))
+}
+
+// jsonRecord is the structure of each record sent by the json driver.
+type jsonRecord struct {
+	Time    time.Time `json:"time"`
+	PodUUID string    `json:"pod_uuid"`
+	PodName string    `json:"pod_name"`
+	AppName string    `json:"app"`
+	Stream  string    `json:"stream"`
+	Message string    `json:"message"`
+}
+
+// formatJSON formats the line as a single JSON object followed by a newline.
+func formatJSON(tags Tags, t time.Time, line []byte) []byte {
+	b, _ := json.Marshal(&jsonRecord{
+		Time:    t.UTC(),
+		PodUUID: tags.PodUUID,
+		PodName: tags.PodName,
+		AppName: tags.AppName,
+		Stream:  tags.Stream,
+		Message: string(line),
+	})
+	return append(b, '\n')
+}
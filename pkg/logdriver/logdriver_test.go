@@ -0,0 +1,168 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package logdriver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	kschema "github.com/apcera/kurma/schema"
+	tt "github.com/apcera/util/testtool"
+)
+
+var testTags = Tags{
+	PodUUID: "1234-5678",
+	PodName: "example",
+	AppName: "web",
+	Stream:  StreamStderr,
+}
+
+func TestSyslogDriver(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	// start a local syslog listener
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tt.TestExpectSuccess(t, err)
+	defer l.Close()
+
+	w, err := New(&kschema.LogDriver{Driver: kschema.LogDriverSyslog, Address: "udp://" + l.LocalAddr().String()}, testTags)
+	tt.TestExpectSuccess(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("first line\nsecond "))
+	tt.TestExpectSuccess(t, err)
+	_, err = w.Write([]byte("line\n"))
+	tt.TestExpectSuccess(t, err)
+
+	var messages []string
+	buf := make([]byte, 1024)
+	for i := 0; i < 2; i++ {
+		l.SetReadDeadline(time.Now().Add(time.Second * 5))
+		n, _, err := l.ReadFrom(buf)
+		tt.TestExpectSuccess(t, err)
+		messages = append(messages, string(buf[:n]))
+	}
+
+	tt.TestEqual(t, strings.HasPrefix(messages[0], "<11>"), true)
+	tt.TestEqual(t, strings.HasSuffix(messages[0], " example web: pod_uuid=1234-5678 first line\n"), true)
+	tt.TestEqual(t, strings.HasSuffix(messages[1], " example web: pod_uuid=1234-5678 second line\n"), true)
+}
+
+func TestJSONDriver(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tt.TestExpectSuccess(t, err)
+	defer l.Close()
+
+	records := make(chan *jsonRecord, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var r *jsonRecord
+			if err := json.Unmarshal(scanner.Bytes(), &r); err == nil {
+				records <- r
+			}
+		}
+	}()
+
+	w, err := New(&kschema.LogDriver{Driver: kschema.LogDriverJSON, Address: "tcp://" + l.Addr().String()}, testTags)
+	tt.TestExpectSuccess(t, err)
+
+	_, err = w.Write([]byte("hello\nunterminated"))
+	tt.TestExpectSuccess(t, err)
+	// closing flushes the partial line
+	tt.TestExpectSuccess(t, w.Close())
+
+	for _, message := range []string{"hello", "unterminated"} {
+		select {
+		case r := <-records:
+			tt.TestEqual(t, r.Message, message)
+			tt.TestEqual(t, r.PodUUID, "1234-5678")
+			tt.TestEqual(t, r.PodName, "example")
+			tt.TestEqual(t, r.AppName, "web")
+			tt.TestEqual(t, r.Stream, StreamStderr)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("timed out waiting for record %q", message)
+		}
+	}
+}
+
+func TestUnavailableCollector(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	// reserve a port, then close it so nothing is listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tt.TestExpectSuccess(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	w, err := New(&kschema.LogDriver{Driver: kschema.LogDriverJSON, Address: "tcp://" + address}, testTags)
+	tt.TestExpectSuccess(t, err)
+	defer w.Close()
+
+	// writes should still succeed, with the output dropped
+	n, err := w.Write([]byte("dropped\n"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, n, 8)
+}
+
+func TestFileDriver(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	w, err := New(&kschema.LogDriver{Driver: kschema.LogDriverFile}, testTags)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, w, nil)
+}
+
+func TestDroppedRecords(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	tt.TestExpectSuccess(t, err)
+	defer l.Close()
+
+	// records beyond what the queue holds are dropped rather than blocking
+	w := &writer{
+		network: "tcp",
+		address: l.Addr().String(),
+		tags:    testTags,
+		format:  formatJSON,
+		records: make(chan []byte, 2),
+	}
+	n, err := w.Write([]byte("one\ntwo\nthree\nfour\n"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, n, 19)
+	tt.TestEqual(t, w.dropped, uint64(2))
+
+	// the number dropped is reported before the next record is sent
+	go w.sendRoutine()
+	tt.TestExpectSuccess(t, w.Close())
+
+	conn, err := l.Accept()
+	tt.TestExpectSuccess(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	scanner := bufio.NewScanner(conn)
+	var messages []string
+	for scanner.Scan() {
+		var r *jsonRecord
+		tt.TestExpectSuccess(t, json.Unmarshal(scanner.Bytes(), &r))
+		messages = append(messages, r.Message)
+	}
+	tt.TestEqual(t, messages, []string{"2 log records were dropped", "one", "two"})
+}
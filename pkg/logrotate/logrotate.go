@@ -0,0 +1,197 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+// Package logrotate provides size based rotation for log files. It can either
+// be used as a writer that rotates the file it writes to, or to rotate a file
+// that is held open by another process.
+package logrotate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Options defines how a log file is rotated. A MaxSize of zero disables
+// rotation. MaxFiles is the number of rotated files that are kept alongside the
+// active one, named with a numbered suffix such as "app.1". When MaxFiles is
+// zero, the log is simply truncated once it exceeds MaxSize.
+type Options struct {
+	MaxSize  int64 `json:"maxSize,omitempty"`
+	MaxFiles int   `json:"maxFiles,omitempty"`
+}
+
+// Enabled returns whether the options will result in logs being rotated.
+func (o Options) Enabled() bool {
+	return o.MaxSize > 0
+}
+
+// Writer is an io.WriteCloser that appends to a log file and rotates it before
+// a write would take it past the configured maximum size.
+type Writer struct {
+	path    string
+	options Options
+
+	file  *os.File
+	size  int64
+	mutex sync.Mutex
+}
+
+// NewWriter opens the log file at the specified path for appending, creating it
+// if it does not already exist.
+func NewWriter(path string, options Options) (*Writer, error) {
+	w := &Writer{
+		path:    path,
+		options: options,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes the provided bytes to the log, rotating it first if necessary.
+// A single write is never split across files.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return 0, fmt.Errorf("log writer is closed")
+	}
+
+	if w.options.Enabled() && w.size > 0 && w.size+int64(len(p)) > w.options.MaxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying log file.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// open opens the log file and records its current size.
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.FileMode(0666))
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+	w.file = f
+	w.size = fi.Size()
+	return nil
+}
+
+// rotate closes the current log file, moves it aside, and opens a new one.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %v", err)
+	}
+	w.file = nil
+
+	if w.options.MaxFiles > 0 {
+		if err := shiftFiles(w.path, w.options.MaxFiles); err != nil {
+			return err
+		}
+		if err := os.Rename(w.path, rotatedName(w.path, 1)); err != nil {
+			return fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	} else if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove log file: %v", err)
+	}
+
+	return w.open()
+}
+
+// CopyTruncate rotates the log at the specified path if it has grown past the
+// maximum size. It is intended for logs that are held open by another process
+// with O_APPEND, so rather than moving the file it copies its contents aside
+// and truncates it in place. Output written between the copy and the truncate
+// is lost. It returns whether the log was rotated.
+func CopyTruncate(path string, options Options) (bool, error) {
+	if !options.Enabled() {
+		return false, nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat log file: %v", err)
+	}
+	if fi.Size() <= options.MaxSize {
+		return false, nil
+	}
+
+	if options.MaxFiles > 0 {
+		if err := shiftFiles(path, options.MaxFiles); err != nil {
+			return false, err
+		}
+		if err := copyFile(path, rotatedName(path, 1)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		return false, fmt.Errorf("failed to truncate log file: %v", err)
+	}
+	return true, nil
+}
+
+// rotatedName returns the name of the nth rotated file for the log.
+func rotatedName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// shiftFiles makes room for a new rotated file by removing the oldest one and
+// renaming the rest to the next number up.
+func shiftFiles(path string, maxFiles int) error {
+	if err := os.Remove(rotatedName(path, maxFiles)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old log file: %v", err)
+	}
+	for i := maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotatedName(path, i), rotatedName(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate old log file: %v", err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the contents of the src file to a newly created dst file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0666))
+	if err != nil {
+		return fmt.Errorf("failed to create rotated log file: %v", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to copy log file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package logrotate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	tt.TestExpectSuccess(t, err)
+	return string(b)
+}
+
+func TestWriterRotates(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	path := filepath.Join(tt.TempDir(t), "app")
+	w, err := NewWriter(path, Options{MaxSize: 10, MaxFiles: 2})
+	tt.TestExpectSuccess(t, err)
+	defer w.Close()
+
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		_, err := w.Write([]byte(s))
+		tt.TestExpectSuccess(t, err)
+	}
+
+	tt.TestEqual(t, readFile(t, path), "dddddd\n")
+	tt.TestEqual(t, readFile(t, path+".1"), "cccccc\n")
+	tt.TestEqual(t, readFile(t, path+".2"), "bbbbbb\n")
+	_, err = os.Stat(path + ".3")
+	tt.TestEqual(t, os.IsNotExist(err), true)
+}
+
+func TestWriterTruncatesWithoutMaxFiles(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	path := filepath.Join(tt.TempDir(t), "app")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(path, []byte("existing\n"), os.FileMode(0644)))
+
+	w, err := NewWriter(path, Options{MaxSize: 10})
+	tt.TestExpectSuccess(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("new\n"))
+	tt.TestExpectSuccess(t, err)
+
+	tt.TestEqual(t, readFile(t, path), "new\n")
+	_, err = os.Stat(path + ".1")
+	tt.TestEqual(t, os.IsNotExist(err), true)
+}
+
+func TestWriterDisabled(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	path := filepath.Join(tt.TempDir(t), "app")
+	w, err := NewWriter(path, Options{})
+	tt.TestExpectSuccess(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := w.Write([]byte("aaaaaaaaaa\n"))
+		tt.TestExpectSuccess(t, err)
+	}
+	tt.TestExpectSuccess(t, w.Close())
+
+	tt.TestEqual(t, len(readFile(t, path)), 110)
+	_, err = w.Write([]byte("closed"))
+	tt.TestExpectError(t, err)
+}
+
+func TestCopyTruncate(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	path := filepath.Join(tt.TempDir(t), "stager.log")
+
+	// a log under the limit is left alone
+	tt.TestExpectSuccess(t, ioutil.WriteFile(path, []byte("small\n"), os.FileMode(0644)))
+	rotated, err := CopyTruncate(path, Options{MaxSize: 10, MaxFiles: 1})
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, rotated, false)
+
+	// keep the file open for appending, like the process writing to it would
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, os.FileMode(0644))
+	tt.TestExpectSuccess(t, err)
+	defer f.Close()
+	f.WriteString("more output\n")
+
+	rotated, err = CopyTruncate(path, Options{MaxSize: 10, MaxFiles: 1})
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, rotated, true)
+	tt.TestEqual(t, readFile(t, path), "")
+	tt.TestEqual(t, readFile(t, path+".1"), "small\nmore output\n")
+
+	// writes through the existing descriptor land at the start of the file
+	f.WriteString("after\n")
+	tt.TestEqual(t, readFile(t, path), "after\n")
+}
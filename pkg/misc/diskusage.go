@@ -0,0 +1,46 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package misc
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DiskUsage returns the number of bytes allocated on disk to the files within
+// the path. Files with multiple hard links within the path are only counted
+// once.
+func DiskUsage(path string) (int64, error) {
+	type inode struct {
+		dev uint64
+		ino uint64
+	}
+	seen := make(map[inode]bool)
+
+	var size int64
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			size += fi.Size()
+			return nil
+		}
+		if stat.Nlink > 1 {
+			key := inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		// Blocks are always counted in 512 byte units.
+		size += int64(stat.Blocks) * 512
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package misc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestDiskUsage(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	dir := tt.TempDir(t)
+	empty, err := DiskUsage(dir)
+	tt.TestExpectSuccess(t, err)
+
+	data := make([]byte, 64*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	file := filepath.Join(dir, "file")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(file, data, os.FileMode(0644)))
+	size, err := DiskUsage(dir)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, size-empty >= int64(len(data)), true)
+
+	// hard links aren't counted twice
+	tt.TestExpectSuccess(t, os.Link(file, filepath.Join(dir, "link")))
+	linked, err := DiskUsage(dir)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, linked, size)
+
+	_, err = DiskUsage(filepath.Join(dir, "missing"))
+	tt.TestExpectError(t, err)
+}
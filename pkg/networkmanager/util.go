@@ -39,7 +39,8 @@ func (m *Manager) defaultNetworkPod() (*schema.PodManifest, *backend.PodOptions,
 				Flags:       syscall.MS_BIND,
 			},
 		},
-		ContainerIO: make(map[string]*backend.IOs),
+		ContainerIO:   make(map[string]*backend.IOs),
+		RestartPolicy: &kschema.RestartPolicy{Policy: kschema.RestartAlways},
 	}
 
 	return pod, options, nil
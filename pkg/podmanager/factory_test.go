@@ -3,6 +3,7 @@
 package podmanager
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/opencontainers/runc/libcontainer"
@@ -29,7 +30,11 @@ func (mf *mockFactory) Create(id string, config *configs.Config) (libcontainer.C
 }
 
 func (mf *mockFactory) Load(id string) (libcontainer.Container, error) {
-	return mf.containers[id], nil
+	mc, exists := mf.containers[id]
+	if !exists {
+		return nil, fmt.Errorf("container %q does not exist", id)
+	}
+	return mc, nil
 }
 
 func (mf *mockFactory) StartInitialization() error {
@@ -41,8 +46,10 @@ func (mf *mockFactory) Type() string {
 }
 
 type mockContainer struct {
-	id     string
-	config *configs.Config
+	id        string
+	config    *configs.Config
+	stopped   bool
+	destroyed bool
 }
 
 func (mc *mockContainer) ID() string {
@@ -50,6 +57,12 @@ func (mc *mockContainer) ID() string {
 }
 
 func (mc *mockContainer) Status() (libcontainer.Status, error) {
+	if mc.destroyed {
+		return libcontainer.Destroyed, nil
+	}
+	if mc.stopped {
+		return libcontainer.Created, nil
+	}
 	return libcontainer.Running, nil
 }
 
@@ -79,6 +92,7 @@ func (mc *mockContainer) Start(process *libcontainer.Process) error {
 }
 
 func (mc *mockContainer) Destroy() error {
+	mc.destroyed = true
 	return nil
 }
 
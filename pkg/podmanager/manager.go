@@ -10,11 +10,16 @@ import (
 
 	"github.com/apcera/kurma/pkg/apiclient"
 	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/capabilities"
+	"github.com/apcera/kurma/pkg/logrotate"
+	"github.com/apcera/kurma/pkg/resources"
+	"github.com/apcera/kurma/pkg/seccomp"
 	"github.com/apcera/logray"
 	"github.com/apcera/util/uuid"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
 
 	kschema "github.com/apcera/kurma/schema"
 )
@@ -31,6 +36,17 @@ type Options struct {
 	Log                   *logray.Logger
 	FactoryFunc           func(root string) (libcontainer.Factory, error)
 	Debug                 bool
+
+	// LogRotation configures how the stager and app logs for pods are rotated.
+	LogRotation logrotate.Options
+
+	// AllowedHostVolumes is the list of host paths that host volumes may be
+	// bound from. Host volumes are rejected if it is empty.
+	AllowedHostVolumes []string
+
+	// UserNamespaces configures the host IDs that pods are mapped to when they
+	// run in a user namespace. User namespaces are not used when it is nil.
+	UserNamespaces *UserNamespaceOptions
 }
 
 func defaultFactory(root string) (libcontainer.Factory, error) {
@@ -54,6 +70,11 @@ type Manager struct {
 	podNames map[string]string
 	podsLock sync.RWMutex
 
+	// userNamespaces maps the blocks of user namespace IDs that are in use to
+	// the UUID of the pod using them.
+	userNamespaces     map[int]string
+	userNamespacesLock sync.Mutex
+
 	HostSocketFile string
 }
 
@@ -69,6 +90,12 @@ func NewManager(imageManager backend.ImageManager, networkManager backend.Networ
 		opts.FactoryFunc = defaultFactory
 	}
 
+	if opts.UserNamespaces.Enabled() {
+		if err := opts.UserNamespaces.validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	// create the libcontainer factory
 	factory, err := opts.FactoryFunc(opts.LibcontainerDirectory)
 	if err != nil {
@@ -83,6 +110,12 @@ func NewManager(imageManager backend.ImageManager, networkManager backend.Networ
 		networkManager: networkManager,
 		pods:           make(map[string]backend.Pod),
 		podNames:       make(map[string]string),
+		userNamespaces: make(map[int]string),
+	}
+
+	// reattach to any pods left running by a previous instance
+	if err := m.recoverPods(); err != nil {
+		return nil, err
 	}
 
 	return m, nil
@@ -108,6 +141,13 @@ func (manager *Manager) validate(manifest *schema.PodManifest) error {
 		return fmt.Errorf("the manifest must specify an App")
 	}
 
+	// Validate the pod's resource limits, which the apps' limits must fit in
+	podResources := &configs.Resources{}
+	if err := resources.Apply(manifest.Isolators, podResources); err != nil {
+		return fmt.Errorf("the pod has %v", err)
+	}
+	appResources := make([]*configs.Resources, 0, len(manifest.Apps))
+
 	// Validate each application
 	for _, runtimeApp := range manifest.Apps {
 		// Ensure we have the image already
@@ -117,11 +157,41 @@ func (manager *Manager) validate(manifest *schema.PodManifest) error {
 		}
 
 		// See if the runtimeApp specifies an app, or the image manifest
-		if runtimeApp.App != nil || imageManifest.App != nil {
-			continue
+		app := runtimeApp.App
+		if app == nil {
+			app = imageManifest.App
+		}
+		if app == nil {
+			return fmt.Errorf("no App sets in the pod or image manifest for app %q", runtimeApp.Name)
 		}
 
-		return fmt.Errorf("no App sets in the pod or image manifest for app %q", runtimeApp.Name)
+		// Ensure any resource limits can be applied
+		r := &configs.Resources{}
+		if err := resources.Apply(app.Isolators, r); err != nil {
+			return fmt.Errorf("app %q has %v", runtimeApp.Name, err)
+		}
+		if err := resources.CheckNested(podResources, r); err != nil {
+			return fmt.Errorf("app %q %v", runtimeApp.Name, err)
+		}
+		appResources = append(appResources, r)
+
+		// Ensure any capabilities the app sets are usable
+		if err := validateCapabilities(app); err != nil {
+			return fmt.Errorf("app %q has %v", runtimeApp.Name, err)
+		}
+
+		// Ensure the app's seccomp isolators can be combined
+		if _, err := seccomp.Profile(app.Isolators, false); err != nil {
+			return fmt.Errorf("app %q has an invalid seccomp profile: %v", runtimeApp.Name, err)
+		}
+	}
+	if err := resources.CheckRequests(podResources, appResources); err != nil {
+		return err
+	}
+
+	// Ensure the pod's volumes are permitted
+	if err := manager.validateVolumes(manifest); err != nil {
+		return err
 	}
 
 	// If the namespaces isolator is specified, validate a minimum set of namespaces
@@ -146,6 +216,12 @@ func (manager *Manager) validate(manifest *schema.PodManifest) error {
 					return fmt.Errorf("the manifest %s isolator must require the %s namespace", kschema.LinuxNamespacesName, ns)
 				}
 			}
+
+			// A pod that explicitly asks for its own user namespace can't be run
+			// without ID ranges to map it into.
+			if val, ok := niso.Get("user"); ok && val != kschema.LinuxNamespaceHost && !manager.Options.UserNamespaces.Enabled() {
+				return fmt.Errorf("the manifest requests a user namespace, but user namespaces are not configured")
+			}
 		}
 	}
 
@@ -155,26 +231,53 @@ func (manager *Manager) validate(manifest *schema.PodManifest) error {
 // Create begins launching a pod with the provided image manifest and
 // reader as the source of the ACI.
 func (manager *Manager) Create(name string, manifest *schema.PodManifest, options *backend.PodOptions) (backend.Pod, error) {
+	if options == nil {
+		options = &backend.PodOptions{}
+	}
+
+	if options.StagerHash == "" {
+		options.StagerHash = manager.Options.DefaultStagerHash
+	}
+
+	// protect the pod's images from removal while it exists. The references are
+	// taken before the images are validated, so images which are found can't
+	// be removed before the pod is launched.
+	podUUID := uuid.Variant4().String()
+	manager.imageManager.AddReferences(podUUID, podImages(manifest, options.StagerHash))
+	successful := false
+	defer func() {
+		if !successful {
+			manager.imageManager.RemoveReferences(podUUID)
+		}
+	}()
+
 	// revalidate the image
 	if err := manager.validate(manifest); err != nil {
 		return nil, err
 	}
 
-	if options == nil {
-		options = &backend.PodOptions{}
+	if err := options.RestartPolicy.AssertValid(); err != nil {
+		return nil, err
 	}
 
-	if options.StagerHash == "" {
-		options.StagerHash = manager.Options.DefaultStagerHash
+	spec, err := newPodSpec(manifest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stagerConfig, err := manager.stagerConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	// populate the pod
 	pod := &Pod{
 		manager:        manager,
 		log:            manager.log.Clone(),
-		uuid:           uuid.Variant4().String(),
+		uuid:           podUUID,
 		name:           name,
 		options:        options,
+		spec:           spec,
 		shuttingDownCh: make(chan struct{}),
 		waitch:         make(chan bool),
 		layerPaths:     make(map[string]string),
@@ -184,9 +287,11 @@ func (manager *Manager) Create(name string, manifest *schema.PodManifest, option
 			Pod:           manifest,
 			Images:        make(map[string]*schema.ImageManifest),
 			AppImageOrder: make(map[string][]string),
-			StagerConfig:  []byte(`{}`),
+			StagerConfig:  stagerConfig,
+			RestartPolicy: options.RestartPolicy,
 		},
 	}
+	pod.manifest.UUID = pod.uuid
 	pod.log.SetField("pod", pod.uuid)
 
 	// add it to the manager's map
@@ -202,9 +307,11 @@ func (manager *Manager) Create(name string, manifest *schema.PodManifest, option
 	manager.pods[pod.uuid] = pod
 	manager.podNames[pod.name] = pod.uuid
 	manager.podsLock.Unlock()
+	successful = true
 
 	// begin the startup sequence
 	pod.log.Debugf("Launching pod %q", pod.name)
+	pod.logRotationRoutine()
 	pod.start()
 
 	return pod, nil
@@ -249,6 +356,23 @@ func (manager *Manager) remove(pod *Pod) {
 	delete(manager.podNames, pod.name)
 	pod.mutex.Unlock()
 	manager.podsLock.Unlock()
+
+	manager.releaseUserNamespace(pod.uuid)
+	manager.imageManager.RemoveReferences(pod.uuid)
+}
+
+// podImages returns the hashes of the images used directly by the pod, which
+// are its apps' images and its stager. Their dependencies are protected along
+// with them.
+func podImages(manifest *schema.PodManifest, stagerHash string) []string {
+	hashes := make([]string, 0, len(manifest.Apps)+1)
+	for _, app := range manifest.Apps {
+		hashes = append(hashes, app.Image.ID.String())
+	}
+	if stagerHash != "" {
+		hashes = append(hashes, stagerHash)
+	}
+	return hashes
 }
 
 // Pods returns a slice of the current pods on the host.
@@ -287,3 +411,26 @@ func (manager *Manager) getVolumePath(name string) (string, error) {
 	}
 	return volumePath, nil
 }
+
+// validateCapabilities ensures the app's capabilities isolators only list
+// capabilities the host supports, and that it doesn't specify both a retain
+// and remove set, since it is ambiguous which should take effect.
+func validateCapabilities(app *types.App) error {
+	retain := app.Isolators.GetByName(types.LinuxCapabilitiesRetainSetName)
+	remove := app.Isolators.GetByName(types.LinuxCapabilitiesRevokeSetName)
+	if retain != nil && remove != nil {
+		return fmt.Errorf("both the %q and %q isolators", types.LinuxCapabilitiesRetainSetName, types.LinuxCapabilitiesRevokeSetName)
+	}
+
+	for _, iso := range []*types.Isolator{retain, remove} {
+		if iso == nil {
+			continue
+		}
+		if set, ok := iso.Value().(types.LinuxCapabilitiesSet); ok {
+			if _, err := capabilities.FromSet(set); err != nil {
+				return fmt.Errorf("invalid %q isolator: %v", iso.Name, err)
+			}
+		}
+	}
+	return nil
+}
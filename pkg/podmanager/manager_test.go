@@ -3,14 +3,21 @@
 package podmanager
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/apcera/kurma/pkg/backend"
 	"github.com/apcera/kurma/pkg/backend/mocks"
+	"github.com/apcera/kurma/pkg/logrotate"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
 	"github.com/opencontainers/runc/libcontainer"
 
+	kschema "github.com/apcera/kurma/schema"
 	tt "github.com/apcera/util/testtool"
 )
 
@@ -85,11 +92,19 @@ func TestCreatePodDuplicateName(t *testing.T) {
 
 	manager := createManager(t)
 
-	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+	imageManager := manager.imageManager.(*mocks.ImageManager)
+	imageManager.GetImageFunc = func(hash string) *schema.ImageManifest {
 		return &schema.ImageManifest{
 			App: &types.App{},
 		}
 	}
+	references := make(map[string][]string)
+	imageManager.AddReferencesFunc = func(owner string, hashes []string) {
+		references[owner] = hashes
+	}
+	imageManager.RemoveReferencesFunc = func(owner string) {
+		delete(references, owner)
+	}
 
 	manifest := schema.BlankPodManifest()
 	manifest.Apps = []schema.RuntimeApp{
@@ -121,4 +136,344 @@ func TestCreatePodDuplicateName(t *testing.T) {
 
 	pods = manager.Pods()
 	tt.TestEqual(t, len(pods), 1)
+
+	// only the pod which was created keeps its image references
+	tt.TestEqual(t, references, map[string][]string{pod.UUID(): {types.NewHashSHA512(nil).String()}})
+}
+
+func TestCreatePodInvalidResources(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	var isolators types.Isolators
+	err := json.Unmarshal([]byte(`[{"name":"resource/memory","value":{"request":"1Gi","limit":"512Mi"}}]`), &isolators)
+	tt.TestExpectSuccess(t, err)
+
+	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+		return &schema.ImageManifest{
+			App: &types.App{Isolators: isolators},
+		}
+	}
+
+	manifest := schema.BlankPodManifest()
+	manifest.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{
+			Name: types.ACName("sample"),
+			Image: schema.RuntimeImage{
+				ID: *types.NewHashSHA512(nil),
+			},
+		},
+	}
+
+	_, err = manager.Create("example", manifest, nil)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `app "sample" has invalid "resource/memory" isolator: request must not be greater than the limit`)
+	tt.TestEqual(t, len(manager.Pods()), 0)
+
+	// an app's limits must also fit within the pod's limits
+	err = json.Unmarshal([]byte(`[{"name":"resource/memory","value":{"limit":"1Gi"}}]`), &isolators)
+	tt.TestExpectSuccess(t, err)
+	err = json.Unmarshal([]byte(`[{"name":"resource/memory","value":{"limit":"512Mi"}}]`), &manifest.Isolators)
+	tt.TestExpectSuccess(t, err)
+
+	_, err = manager.Create("example", manifest, nil)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `app "sample" memory limit of 1073741824 bytes exceeds the pod's limit of 536870912 bytes`)
+	tt.TestEqual(t, len(manager.Pods()), 0)
+}
+
+func TestCreatePodInvalidCapabilities(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	var isolators types.Isolators
+	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+		return &schema.ImageManifest{
+			App: &types.App{Isolators: isolators},
+		}
+	}
+
+	manifest := schema.BlankPodManifest()
+	manifest.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{
+			Name: types.ACName("sample"),
+			Image: schema.RuntimeImage{
+				ID: *types.NewHashSHA512(nil),
+			},
+		},
+	}
+
+	err := json.Unmarshal([]byte(`[{"name":"os/linux/capabilities-remove-set","value":{"set":["CAP_BOGUS"]}}]`), &isolators)
+	tt.TestExpectSuccess(t, err)
+	_, err = manager.Create("example", manifest, nil)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `app "sample" has invalid "os/linux/capabilities-remove-set" isolator: unrecognized capability "CAP_BOGUS"`)
+
+	err = json.Unmarshal([]byte(`[
+		{"name":"os/linux/capabilities-retain-set","value":{"set":["CAP_NET_ADMIN"]}},
+		{"name":"os/linux/capabilities-remove-set","value":{"set":["CAP_NET_RAW"]}}
+	]`), &isolators)
+	tt.TestExpectSuccess(t, err)
+	_, err = manager.Create("example", manifest, nil)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `app "sample" has both the "os/linux/capabilities-retain-set" and "os/linux/capabilities-remove-set" isolators`)
+	tt.TestEqual(t, len(manager.Pods()), 0)
+}
+
+func TestCreatePodInvalidSeccomp(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	var isolators types.Isolators
+	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+		return &schema.ImageManifest{
+			App: &types.App{Isolators: isolators},
+		}
+	}
+
+	manifest := schema.BlankPodManifest()
+	manifest.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{
+			Name: types.ACName("sample"),
+			Image: schema.RuntimeImage{
+				ID: *types.NewHashSHA512(nil),
+			},
+		},
+	}
+
+	err := json.Unmarshal([]byte(`[
+		{"name":"os/linux/seccomp-retain-set","value":{"set":["read"]}},
+		{"name":"os/linux/seccomp-remove-set","value":{"set":["mount"]}}
+	]`), &isolators)
+	tt.TestExpectSuccess(t, err)
+	_, err = manager.Create("example", manifest, nil)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `app "sample" has an invalid seccomp profile: the "os/linux/seccomp-retain-set" and "os/linux/seccomp-remove-set" isolators cannot be combined`)
+	tt.TestEqual(t, len(manager.Pods()), 0)
+}
+
+func TestPodRestartPolicy(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+		return &schema.ImageManifest{
+			App: &types.App{},
+		}
+	}
+
+	manifest := schema.BlankPodManifest()
+	manifest.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{
+			Name: types.ACName("sample"),
+			Image: schema.RuntimeImage{
+				ID: *types.NewHashSHA512(nil),
+			},
+		},
+	}
+
+	origPodStartup := podStartup
+	podStartup = nil
+	defer func() { podStartup = origPodStartup }()
+
+	// An invalid policy should be rejected.
+	_, err := manager.Create("example", manifest, &backend.PodOptions{
+		RestartPolicy: &kschema.RestartPolicy{Policy: "sometimes"},
+	})
+	tt.TestExpectError(t, err)
+
+	bpod, err := manager.Create("example", manifest, &backend.PodOptions{
+		RestartPolicy: &kschema.RestartPolicy{
+			Policy:     kschema.RestartOnFailure,
+			MaxRetries: 1,
+			Backoff:    "1ms",
+		},
+	})
+	tt.TestExpectSuccess(t, err)
+	pod := bpod.(*Pod)
+
+	// Simulate the startup functions modifying the manifest and options, which
+	// should be reverted when the pod is restarted.
+	pod.manifest.Pod = schema.BlankPodManifest()
+	pod.options.RawVolumes = []types.Volume{types.Volume{Name: types.ACName("extra")}}
+
+	pod.stagerExited(1)
+	tt.TestEqual(t, pod.State(), backend.RUNNING)
+	tt.TestEqual(t, pod.restarts, 1)
+	tt.TestEqual(t, len(pod.PodManifest().Apps), 1)
+	tt.TestEqual(t, len(pod.options.RawVolumes), 0)
+	tt.TestEqual(t, manager.Pod(pod.UUID()), pod)
+
+	// The retries have been exhausted, so the pod should be stopped.
+	pod.stagerExited(1)
+	tt.TestEqual(t, pod.State(), backend.STOPPED)
+	tt.TestEqual(t, len(manager.Pods()), 0)
+}
+
+func TestPodRestartKeepsLogs(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	manager.imageManager.(*mocks.ImageManager).GetImageFunc = func(hash string) *schema.ImageManifest {
+		return &schema.ImageManifest{
+			App: &types.App{},
+		}
+	}
+
+	manifest := schema.BlankPodManifest()
+	manifest.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{
+			Name: types.ACName("sample"),
+			Image: schema.RuntimeImage{
+				ID: *types.NewHashSHA512(nil),
+			},
+		},
+	}
+
+	origPodStartup := podStartup
+	podStartup = []func(*Pod) error{(*Pod).startingBaseDirectories}
+	defer func() { podStartup = origPodStartup }()
+
+	bpod, err := manager.Create("example", manifest, &backend.PodOptions{
+		RestartPolicy: &kschema.RestartPolicy{
+			Policy:  kschema.RestartAlways,
+			Backoff: "1ms",
+		},
+	})
+	tt.TestExpectSuccess(t, err)
+	pod := bpod.(*Pod)
+	defer pod.Stop()
+
+	// Simulate what the previous run of the pod left behind.
+	logDir := filepath.Join(pod.stagerRootPath(), "logs")
+	tt.TestExpectSuccess(t, os.Mkdir(logDir, os.FileMode(0755)))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(logDir, "sample"), []byte("crashed\n"), os.FileMode(0644)))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(pod.stagerLogPath(), []byte("stager\n"), os.FileMode(0644)))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(pod.recordPath(), []byte("{}"), os.FileMode(0600)))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(pod.stagerRootPath(), "manifest"), []byte("{}"), os.FileMode(0644)))
+
+	pod.stagerExited(1)
+	tt.TestEqual(t, pod.State(), backend.RUNNING)
+	tt.TestEqual(t, pod.restarts, 1)
+
+	// The logs and record should survive the restart, while the stager's
+	// filesystem is recreated.
+	b, err := ioutil.ReadFile(filepath.Join(logDir, "sample"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "crashed\n")
+	b, err = ioutil.ReadFile(pod.stagerLogPath())
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "stager\n")
+	_, err = os.Stat(pod.recordPath())
+	tt.TestExpectSuccess(t, err)
+	_, err = os.Stat(filepath.Join(pod.stagerRootPath(), "manifest"))
+	tt.TestEqual(t, os.IsNotExist(err), true)
+	_, err = os.Stat(filepath.Join(pod.stagerRootPath(), "tmp"))
+	tt.TestExpectSuccess(t, err)
+}
+
+func TestRecoverPods(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	podDirectory := tt.TempDir(t)
+	factory := newMockFactory()
+
+	// write out records for a running pod, a pod whose stager has exited, and a
+	// pod that is running but cannot be recovered
+	writeRecord := func(record *podRecord, stopped bool) {
+		factory.containers[record.ContainerID] = &mockContainer{id: record.ContainerID, stopped: stopped}
+		directory := filepath.Join(podDirectory, record.ContainerID)
+		tt.TestExpectSuccess(t, os.Mkdir(directory, os.FileMode(0755)))
+		b, err := json.Marshal(record)
+		tt.TestExpectSuccess(t, err)
+		tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(directory, podRecordFile), b, os.FileMode(0600)))
+	}
+	manifest := &backend.StagerManifest{Pod: schema.BlankPodManifest()}
+	writeRecord(&podRecord{UUID: "11111111-aaaa", Name: "running", ContainerID: "11111111", Manifest: manifest, Recoverable: true}, false)
+	writeRecord(&podRecord{UUID: "22222222-bbbb", Name: "exited", ContainerID: "22222222", Manifest: manifest, Recoverable: true}, true)
+	writeRecord(&podRecord{UUID: "33333333-cccc", Name: "piped", ContainerID: "33333333", Manifest: manifest}, true)
+
+	// a pod whose stager exited but can be restarted, such as one that was
+	// waiting to be restarted when kurmad stopped
+	spec, err := newPodSpec(manifest.Pod, &backend.PodOptions{})
+	tt.TestExpectSuccess(t, err)
+	writeRecord(&podRecord{
+		UUID:        "44444444-dddd",
+		Name:        "restarting",
+		ContainerID: "44444444",
+		Manifest:    manifest,
+		Options:     &backend.PodOptions{RestartPolicy: &kschema.RestartPolicy{Policy: kschema.RestartAlways, Backoff: "1ms"}},
+		Spec:        spec,
+		Recoverable: true,
+	}, true)
+	stagerLog := filepath.Join(podDirectory, "44444444", "stager.log")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(stagerLog, []byte("stager\n"), os.FileMode(0644)))
+
+	origPodStartup := podStartup
+	podStartup = []func(*Pod) error{(*Pod).startingBaseDirectories}
+	defer func() { podStartup = origPodStartup }()
+
+	opts := &Options{
+		ParentCgroupName: "kurma-test",
+		PodDirectory:     podDirectory,
+		FactoryFunc:      func(root string) (libcontainer.Factory, error) { return factory, nil },
+	}
+	m, err := NewManager(&mocks.ImageManager{}, nil, opts)
+	tt.TestExpectSuccess(t, err)
+	manager := m.(*Manager)
+
+	tt.TestEqual(t, len(manager.Pods()), 2)
+	running := manager.Pod("11111111-aaaa")
+	tt.TestNotEqual(t, running, nil)
+	tt.TestEqual(t, running.Name(), "running")
+	tt.TestEqual(t, running.State(), backend.RUNNING)
+
+	// the restartable pod should be restarted, keeping its logs
+	restarting := manager.Pod("44444444-dddd").(*Pod)
+	tt.TestExpectSuccess(t, restarting.WaitForState(time.Second*5, backend.RUNNING))
+	defer restarting.Stop()
+	tt.TestEqual(t, restarting.restarts, 1)
+	tt.TestEqual(t, factory.containers["44444444"].destroyed, true)
+	b, err := ioutil.ReadFile(stagerLog)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "stager\n")
+
+	// the pods that couldn't be recovered should have been reaped
+	tt.TestEqual(t, factory.containers["22222222"].destroyed, true)
+	tt.TestEqual(t, factory.containers["33333333"].destroyed, true)
+	_, err = os.Stat(filepath.Join(podDirectory, "22222222"))
+	tt.TestEqual(t, os.IsNotExist(err), true)
+	_, err = os.Stat(filepath.Join(podDirectory, "33333333"))
+	tt.TestEqual(t, os.IsNotExist(err), true)
+
+	// a recovered pod's name should still be reserved
+	_, err = manager.Create("running", manifest.Pod, nil)
+	tt.TestExpectError(t, err)
+}
+
+func TestStagerConfig(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	config, err := manager.stagerConfig()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(config), `{}`)
+
+	manager.Options.LogRotation = logrotate.Options{MaxSize: 1024, MaxFiles: 2}
+	config, err = manager.stagerConfig()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(config), `{"logRotation":{"maxSize":1024,"maxFiles":2}}`)
 }
@@ -3,6 +3,8 @@
 package podmanager
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -184,3 +186,124 @@ func TestLaunchStager(t *testing.T) {
 	tt.TestExpectError(t, err)
 	tt.TestEqual(t, err.Error(), "failed to retrieve the pid of the stager process: invalid process")
 }
+
+func TestStartingWriteRecord(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	pod := createPod(t, manager)
+	pod.manifest = &backend.StagerManifest{
+		Pod: schema.BlankPodManifest(),
+	}
+	pod.netNsPath = "/tmp/netns"
+
+	tt.TestExpectSuccess(t, pod.startingBaseDirectories())
+	tt.TestExpectSuccess(t, pod.startingWriteRecord())
+
+	record, err := readPodRecord(pod.recordPath())
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, record.UUID, pod.uuid)
+	tt.TestEqual(t, record.Name, pod.name)
+	tt.TestEqual(t, record.ContainerID, pod.ShortName())
+	tt.TestEqual(t, record.NetNsPath, "/tmp/netns")
+	tt.TestEqual(t, record.Recoverable, true)
+
+	// pods with process specific IO are not recoverable
+	pod.options.ContainerIO = map[string]*backend.IOs{"app": &backend.IOs{}}
+	tt.TestExpectSuccess(t, pod.startingWriteRecord())
+	record, err = readPodRecord(pod.recordPath())
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, record.Recoverable, false)
+}
+
+func TestPodStatus(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	pod := createPod(t, manager)
+	pod.manifest = &backend.StagerManifest{
+		Pod: schema.BlankPodManifest(),
+	}
+	pod.manifest.Pod.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{Name: types.ACName("web")},
+		schema.RuntimeApp{Name: types.ACName("worker")},
+	}
+	tt.TestExpectSuccess(t, pod.startingBaseDirectories())
+
+	// before the stager writes its state, the apps should still be listed
+	status, err := pod.Status()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, status.StagerState, "")
+	tt.TestEqual(t, len(status.Apps), 2)
+	tt.TestEqual(t, status.Apps[0].Name, "web")
+
+	state := `{"state":"running","apps":{"web":{"pid":10,"exited":false},"worker":{"exited":true,"exitCode":3,"restarts":2}}}`
+	tt.TestExpectSuccess(t, ioutil.WriteFile(pod.stagerStatePath(), []byte(state), os.FileMode(0600)))
+
+	status, err = pod.Status()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, status.StagerState, "running")
+	tt.TestEqual(t, len(status.Apps), 2)
+	tt.TestEqual(t, status.Apps[0], &backend.AppStatus{Name: "web", Pid: 10})
+	tt.TestEqual(t, status.Apps[1], &backend.AppStatus{Name: "worker", Exited: true, ExitCode: 3, Restarts: 2})
+}
+
+func TestPodLogs(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	pod := createPod(t, manager)
+	pod.shuttingDownCh = make(chan struct{})
+	pod.manifest = &backend.StagerManifest{
+		Pod: schema.BlankPodManifest(),
+	}
+	pod.manifest.Pod.Apps = []schema.RuntimeApp{
+		schema.RuntimeApp{Name: types.ACName("web")},
+	}
+	tt.TestExpectSuccess(t, pod.startingBaseDirectories())
+
+	logDir := filepath.Join(pod.stagerRootPath(), "logs")
+	tt.TestExpectSuccess(t, os.MkdirAll(logDir, os.FileMode(0755)))
+	logFile := filepath.Join(logDir, "web")
+	tt.TestExpectSuccess(t, ioutil.WriteFile(logFile, []byte("one\ntwo\nthree\n"), os.FileMode(0644)))
+
+	var buf bytes.Buffer
+	tt.TestExpectSuccess(t, pod.Logs("web", 0, false, &buf, nil))
+	tt.TestEqual(t, buf.String(), "one\ntwo\nthree\n")
+
+	buf.Reset()
+	tt.TestExpectSuccess(t, pod.Logs("web", 2, false, &buf, nil))
+	tt.TestEqual(t, buf.String(), "two\nthree\n")
+
+	buf.Reset()
+	tt.TestExpectSuccess(t, pod.Logs("web", 10, false, &buf, nil))
+	tt.TestEqual(t, buf.String(), "one\ntwo\nthree\n")
+
+	tt.TestExpectError(t, pod.Logs("missing", 0, false, &buf, nil))
+
+	// following should pick up output appended after the initial read
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pod.Logs("web", 1, true, w, done)
+		w.Close()
+	}()
+	b := make([]byte, 6)
+	_, err := io.ReadFull(r, b)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "three\n")
+
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_APPEND, os.FileMode(0644))
+	tt.TestExpectSuccess(t, err)
+	f.WriteString("four\n")
+	f.Close()
+
+	b = make([]byte, 5)
+	_, err = io.ReadFull(r, b)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "four\n")
+	close(done)
+}
@@ -43,6 +43,11 @@ type Pod struct {
 
 	options *backend.PodOptions
 
+	// spec is the serialized podSpec the pod was created with, and restarts is
+	// the number of times it has been restarted due to its restart policy.
+	spec     json.RawMessage
+	restarts int
+
 	// skipNetworking is used when a container is not creating its own network
 	// namespace. This happens when it is sharing the host's namespace or the
 	// namespace of another container.
@@ -116,6 +121,7 @@ func (pod *Pod) start() {
 func (pod *Pod) Stop() error {
 	pod.mutex.Lock()
 	if pod.shuttingDown {
+		pod.mutex.Unlock()
 		return nil
 	}
 	pod.shuttingDown = true
@@ -19,16 +19,7 @@ import (
 // used and primarily checks if the stager should get the host's network
 // namespace.
 func (pod *Pod) setupLinuxNamespaceIsolator() error {
-	var nsiso *kschema.LinuxNamespaces
-
-	for _, iso := range pod.manifest.Pod.Isolators {
-		if iso.Name.String() == kschema.LinuxNamespacesName {
-			if niso, ok := iso.Value().(*kschema.LinuxNamespaces); ok {
-				nsiso = niso
-				break
-			}
-		}
-	}
+	nsiso := getNamespaceIsolator(pod.manifest.Pod.Isolators)
 
 	// Return ifit wasn't referenced at all.
 	if nsiso == nil {
@@ -45,6 +36,19 @@ func (pod *Pod) setupLinuxNamespaceIsolator() error {
 	return nil
 }
 
+// getNamespaceIsolator returns the namespaces isolator from the list of
+// isolators, or nil if there isn't one.
+func getNamespaceIsolator(isolators types.Isolators) *kschema.LinuxNamespaces {
+	for _, iso := range isolators {
+		if iso.Name.String() == kschema.LinuxNamespacesName {
+			if niso, ok := iso.Value().(*kschema.LinuxNamespaces); ok {
+				return niso
+			}
+		}
+	}
+	return nil
+}
+
 func (pod *Pod) setupHostPrivilegeIsolator(runtimeApp *schema.RuntimeApp) {
 	app := runtimeApp.App
 	if app == nil {
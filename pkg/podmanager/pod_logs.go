@@ -0,0 +1,234 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apcera/kurma/pkg/logrotate"
+	"github.com/appc/spec/schema/types"
+)
+
+var (
+	// logFollowInterval is how often a followed log is checked for new output
+	// once the end of the file has been reached.
+	logFollowInterval = time.Millisecond * 250
+
+	// logRotateInterval is how often the stager's log is checked to see if it
+	// needs to be rotated.
+	logRotateInterval = time.Second * 30
+
+	// logTailChunkSize is the size of the blocks read backwards from the end of
+	// a log while locating where to begin tailing it.
+	logTailChunkSize = int64(4096)
+)
+
+// Logs writes the output of the specified app to the provided writer. If the
+// app name is empty, then the stager's own output is written. When tail is
+// greater than zero, only the last tail lines are written. When follow is set,
+// new output continues to be written until the done channel is closed or the
+// pod is shut down.
+func (pod *Pod) Logs(appName string, tail int, follow bool, w io.Writer, done <-chan struct{}) error {
+	path, err := pod.logPath(appName)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log: %v", err)
+	}
+	defer func() { f.Close() }()
+
+	if tail > 0 {
+		offset, err := tailOffset(f, tail)
+		if err != nil {
+			return fmt.Errorf("failed to locate the log tail: %v", err)
+		}
+		if _, err := f.Seek(offset, os.SEEK_SET); err != nil {
+			return fmt.Errorf("failed to seek in log: %v", err)
+		}
+	}
+
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		if !follow {
+			return nil
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-pod.shuttingDownCh:
+			// Copy out anything written while the pod was shutting down.
+			_, err := io.Copy(w, f)
+			return err
+		case <-time.After(logFollowInterval):
+		}
+
+		// If the log was truncated when rotated in place, start again from the
+		// beginning.
+		if truncated, err := logTruncated(f); err == nil && truncated {
+			if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+				return fmt.Errorf("failed to seek in log: %v", err)
+			}
+			continue
+		}
+
+		// If the log has been replaced, such as when the pod is restarted or
+		// the log is rotated, switch over to the new file once the old one has
+		// been drained.
+		if replaced, err := logReplaced(f, path); err == nil && replaced {
+			if _, err := io.Copy(w, f); err != nil {
+				return err
+			}
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f = nf
+		}
+	}
+}
+
+// logRotationRoutine periodically rotates the stager's log until the pod is
+// shut down. The stager holds its log open directly rather than through a pipe
+// from kurmad, so that it survives kurmad restarting, which means the log has
+// to be rotated in place.
+func (pod *Pod) logRotationRoutine() {
+	options := pod.manager.Options.LogRotation
+	if !options.Enabled() {
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case <-pod.shuttingDownCh:
+				return
+			case <-time.After(logRotateInterval):
+			}
+
+			pod.mutex.Lock()
+			directory := pod.directory
+			pod.mutex.Unlock()
+			if directory == "" {
+				continue
+			}
+
+			if _, err := logrotate.CopyTruncate(pod.stagerLogPath(), options); err != nil {
+				pod.log.Warnf("Failed to rotate stager log: %v", err)
+			}
+		}
+	}()
+}
+
+// stagerConfig returns the configuration passed to the stager in its manifest.
+// Only the settings managed by kurma are included so the stager's own defaults
+// are kept for everything else.
+func (manager *Manager) stagerConfig() (json.RawMessage, error) {
+	config := map[string]interface{}{}
+	if manager.Options.LogRotation.Enabled() {
+		config["logRotation"] = manager.Options.LogRotation
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stager configuration: %v", err)
+	}
+	return json.RawMessage(b), nil
+}
+
+// logPath returns the path on the host for the specified app's log, or the
+// stager's log if no app name is given.
+func (pod *Pod) logPath(appName string) (string, error) {
+	pod.mutex.Lock()
+	manifest := pod.manifest
+	directory := pod.directory
+	pod.mutex.Unlock()
+
+	if directory == "" {
+		return "", fmt.Errorf("pod has not been set up yet")
+	}
+	if appName == "" {
+		return pod.stagerLogPath(), nil
+	}
+	if manifest == nil || manifest.Pod == nil || manifest.Pod.Apps.Get(types.ACName(appName)) == nil {
+		return "", fmt.Errorf("app %q was not found in the pod", appName)
+	}
+	return filepath.Join(pod.stagerRootPath(), "logs", appName), nil
+}
+
+// logReplaced returns whether the file at path is no longer the same file as
+// the one that is open.
+func logReplaced(f *os.File, path string) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	pfi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(fi, pfi), nil
+}
+
+// logTruncated returns whether the open file is now shorter than the current
+// read offset.
+func logTruncated(f *os.File) (bool, error) {
+	offset, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return false, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() < offset, nil
+}
+
+// tailOffset returns the offset within the file where its last n lines begin.
+// A trailing newline at the end of the file does not count as a line.
+func tailOffset(f *os.File, n int) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, logTailChunkSize)
+	end := size
+	lines := 0
+	for end > 0 {
+		start := end - logTailChunkSize
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			lines++
+			if lines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
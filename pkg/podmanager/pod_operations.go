@@ -23,18 +23,9 @@ import (
 
 var (
 	// These are the functions that will be called in order to handle pod spin up.
-	podStartup = []func(*Pod) error{
-		(*Pod).startingGetStager,
-		(*Pod).startingDependencySet,
-		(*Pod).startingBaseDirectories,
-		(*Pod).startingApplyIsolators,
-		(*Pod).startingNetwork,
-		(*Pod).startingResolvConf,
-		(*Pod).startingInitializeContainer,
-		(*Pod).startingWriteManifest,
-		(*Pod).launchStager,
-		(*Pod).waitForReady,
-	}
+	// It is populated in init since restarting a pod runs it again, which would
+	// otherwise be an initialization cycle.
+	podStartup []func(*Pod) error
 
 	// These are the functions that will be called in order to handle pod
 	// teardown.
@@ -46,8 +37,35 @@ var (
 		(*Pod).stoppingDirectories,
 		(*Pod).stoppingrRemoveFromParent,
 	}
+
+	// These are the functions that will be called in order to clean up after a
+	// stager that has exited before the pod is restarted.
+	podRestarting = []func(*Pod) error{
+		(*Pod).stoppingReadyPipe,
+		(*Pod).stoppingNetwork,
+		(*Pod).stoppingStager,
+		(*Pod).restartingDirectories,
+	}
 )
 
+func init() {
+	podStartup = []func(*Pod) error{
+		(*Pod).startingGetStager,
+		(*Pod).startingDependencySet,
+		(*Pod).startingBaseDirectories,
+		(*Pod).startingVolumes,
+		(*Pod).startingApplyIsolators,
+		(*Pod).startingUserNamespace,
+		(*Pod).startingNetwork,
+		(*Pod).startingResolvConf,
+		(*Pod).startingInitializeContainer,
+		(*Pod).startingWriteManifest,
+		(*Pod).launchStager,
+		(*Pod).startingWriteRecord,
+		(*Pod).waitForReady,
+	}
+}
+
 // startingGetStager locates the image manifest for the stager and validates
 // that it can be used.
 func (pod *Pod) startingGetStager() error {
@@ -103,8 +121,9 @@ func (pod *Pod) startingBaseDirectories() error {
 
 	// Make the directories.
 	mode := os.FileMode(0755)
+	// A restarted pod keeps its directory, along with its record and logs.
 	dirs := []string{pod.directory, pod.stagerRootPath(), filepath.Join(pod.stagerRootPath(), "tmp")}
-	if err := mkdirs(dirs, mode, false); err != nil {
+	if err := mkdirs(dirs, mode, pod.restarts > 0); err != nil {
 		return fmt.Errorf("failed to create base directories: %v", err)
 	}
 
@@ -308,7 +327,8 @@ func (pod *Pod) launchStager() error {
 		}(scanner, pod)
 	} else {
 		// Open a log file that all output from the container will be written to
-		flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE | os.O_EXCL | os.O_TRUNC
+		// The log is appended to, since it is kept when the pod is restarted.
+		flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
 		stagerlog, err := os.OpenFile(pod.stagerLogPath(), flags, os.FileMode(0666))
 		if err != nil {
 			return fmt.Errorf("failed to open stager log path: %v", err)
@@ -391,13 +411,23 @@ func (pod *Pod) stoppingReadyPipe() error {
 func (pod *Pod) stoppingSignal() error {
 	pod.mutex.Lock()
 	process := pod.stagerProcess
+	container := pod.stagerContainer
 	pod.mutex.Unlock()
-	if process == nil {
+
+	// Pods recovered after a restart don't have a handle on the stager process,
+	// so signal it through its container instead.
+	var signal func(os.Signal) error
+	switch {
+	case process != nil:
+		signal = process.Signal
+	case container != nil && pod.stagerWaitCh != nil:
+		signal = container.Signal
+	default:
 		return nil
 	}
 
 	pod.log.Trace("Sending shutdown signal to the stager process")
-	if err := process.Signal(os.Signal(syscall.SIGTERM)); err != nil {
+	if err := signal(os.Signal(syscall.SIGTERM)); err != nil {
 		return fmt.Errorf("failed to send TERM signal to stager: %v", err)
 	}
 
@@ -406,7 +436,7 @@ func (pod *Pod) stoppingSignal() error {
 		pod.log.Trace("Stager has exited")
 	case <-time.After(time.Second * 60):
 		pod.log.Error("Stager failed to shutdown within 60 seconds.")
-		if err := process.Signal(os.Signal(syscall.SIGKILL)); err != nil {
+		if err := signal(os.Signal(syscall.SIGKILL)); err != nil {
 			return fmt.Errorf("failed to send KILL signal to stager: %v", err)
 		}
 	}
@@ -476,6 +506,46 @@ func (pod *Pod) stoppingDirectories() error {
 	return nil
 }
 
+// restartingDirectories unmounts the pod's directories and removes the stager's
+// filesystem so they can be recreated when the pod is restarted. The pod's
+// record and the stager and app logs are kept, so the reason the pod exited can
+// still be seen and the pod can be recovered if kurmad restarts in the meantime.
+func (pod *Pod) restartingDirectories() error {
+	if pod.directory == "" {
+		return nil
+	}
+
+	pod.log.Trace("Cleaning up container directories for restart.")
+	if err := unmountDirectories(pod.directory); err != nil {
+		pod.log.Warnf("failed to unmount container directories: %s", err)
+		return err
+	}
+
+	// Layers copied in for a user namespace are copied again on startup.
+	if err := os.RemoveAll(filepath.Join(pod.directory, "layers")); err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(pod.stagerRootPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range fis {
+		if fi.Name() == "logs" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(pod.stagerRootPath(), fi.Name())); err != nil {
+			return err
+		}
+	}
+
+	pod.log.Trace("Done cleaning up container directories.")
+	return nil
+}
+
 // stoppingrRemoveFromParent removes the container object itself from the Pod
 // Manager.
 func (pod *Pod) stoppingrRemoveFromParent() error {
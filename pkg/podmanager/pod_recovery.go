@@ -0,0 +1,331 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/opencontainers/runc/libcontainer"
+
+	ntypes "github.com/apcera/kurma/pkg/networkmanager/types"
+)
+
+const (
+	// podRecordFile is the name of the file within a pod's directory that holds
+	// its durable record.
+	podRecordFile = "pod.json"
+)
+
+var (
+	// recoveredPollInterval is how often a recovered pod's stager container is
+	// checked to see if it is still running. Recovered pods are not the parent
+	// of their stager process, so they cannot wait on it directly.
+	recoveredPollInterval = time.Second * 5
+
+	// reapTimeout is how long to wait for a killed stager to exit while
+	// reaping a pod that cannot be recovered.
+	reapTimeout = time.Second * 10
+)
+
+// podRecord is the durable representation of a pod that is written to the
+// pod's directory once the stager has been launched. It contains everything
+// needed for the Pod Manager to reattach to the pod after kurmad restarts.
+type podRecord struct {
+	UUID           string                  `json:"uuid"`
+	Name           string                  `json:"name"`
+	Manifest       *backend.StagerManifest `json:"manifest"`
+	Options        *backend.PodOptions     `json:"options"`
+	NetNsPath      string                  `json:"netNsPath,omitempty"`
+	NetworkResults []*ntypes.IPResult      `json:"networkResults,omitempty"`
+	SkipNetworking bool                    `json:"skipNetworking,omitempty"`
+	ContainerID    string                  `json:"containerId"`
+	Spec           json.RawMessage         `json:"spec,omitempty"`
+	Restarts       int                     `json:"restarts,omitempty"`
+
+	// Recoverable is false when the pod was created with state that only lives
+	// within the kurmad process, such as ContainerIO pipes. These pods are
+	// reaped rather than reattached.
+	Recoverable bool `json:"recoverable"`
+}
+
+// startingWriteRecord persists the pod's record to its directory so that it
+// can be recovered if kurmad is restarted.
+func (pod *Pod) startingWriteRecord() error {
+	pod.mutex.Lock()
+	record := &podRecord{
+		UUID:           pod.uuid,
+		Name:           pod.name,
+		Manifest:       pod.manifest,
+		Options:        pod.options,
+		NetNsPath:      pod.netNsPath,
+		NetworkResults: pod.networkResults,
+		SkipNetworking: pod.skipNetworking,
+		ContainerID:    pod.ShortName(),
+		Spec:           pod.spec,
+		Restarts:       pod.restarts,
+		Recoverable:    len(pod.options.ContainerIO) == 0,
+	}
+	pod.mutex.Unlock()
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod record: %v", err)
+	}
+
+	// Write to a temporary file and rename it into place so a partially
+	// written record is never read back in.
+	tmpPath := pod.recordPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, os.FileMode(0600)); err != nil {
+		return fmt.Errorf("failed to write pod record: %v", err)
+	}
+	if err := os.Rename(tmpPath, pod.recordPath()); err != nil {
+		return fmt.Errorf("failed to write pod record: %v", err)
+	}
+	return nil
+}
+
+// recoverPods scans the pod directory for records left by a previous run of
+// kurmad. Pods whose stager is still running are reattached to the manager,
+// pods with an exited stager are handed to their restart policy, and the rest
+// are torn down.
+func (manager *Manager) recoverPods() error {
+	if manager.Options.PodDirectory == "" {
+		return nil
+	}
+
+	fis, err := ioutil.ReadDir(manager.Options.PodDirectory)
+	if err != nil {
+		return fmt.Errorf("failed to read the pods directory: %v", err)
+	}
+
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		directory := filepath.Join(manager.Options.PodDirectory, fi.Name())
+		if directory == manager.Options.LibcontainerDirectory {
+			continue
+		}
+
+		record, err := readPodRecord(filepath.Join(directory, podRecordFile))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				manager.log.Warnf("Failed to read pod record in %s: %v", directory, err)
+			}
+			continue
+		}
+
+		if err := manager.recoverPod(record, directory); err != nil {
+			manager.log.Warnf("Unable to recover pod %s, reaping it: %v", record.UUID, err)
+			manager.reapPod(record, directory)
+		}
+	}
+	return nil
+}
+
+// recoverPod reattaches to the stager container for the provided record and
+// adds the pod to the manager. It returns an error if the pod is unable to be
+// recovered.
+func (manager *Manager) recoverPod(record *podRecord, directory string) error {
+	if !record.Recoverable {
+		return fmt.Errorf("pod was created with process specific options")
+	}
+	if record.Manifest == nil || record.Manifest.Pod == nil {
+		return fmt.Errorf("pod record is missing its manifest")
+	}
+
+	// A pod whose stager is no longer running can still be recovered if it can
+	// be restarted, such as when kurmad was restarted while the pod was waiting
+	// to be restarted itself.
+	container, err := manager.loadStager(record.ContainerID)
+	if err != nil && record.Spec == nil {
+		return err
+	}
+	exited := err != nil
+
+	if record.Options == nil {
+		record.Options = &backend.PodOptions{}
+	}
+
+	pod := &Pod{
+		manager:         manager,
+		log:             manager.log.Clone(),
+		uuid:            record.UUID,
+		name:            record.Name,
+		options:         record.Options,
+		manifest:        record.Manifest,
+		netNsPath:       record.NetNsPath,
+		networkResults:  record.NetworkResults,
+		skipNetworking:  record.SkipNetworking,
+		spec:            record.Spec,
+		restarts:        record.Restarts,
+		directory:       directory,
+		stagerContainer: container,
+		shuttingDownCh:  make(chan struct{}),
+		waitch:          make(chan bool),
+		layerPaths:      make(map[string]string),
+		state:           backend.RUNNING,
+	}
+	if exited {
+		pod.state = backend.STARTING
+	}
+	pod.log.SetField("pod", pod.uuid)
+
+	if record.Manifest.UserNamespace != nil {
+		if err := manager.reserveUserNamespace(pod.uuid, record.Manifest.UserNamespace); err != nil {
+			return err
+		}
+	}
+
+	manager.podsLock.Lock()
+	if _, exists := manager.podNames[pod.name]; exists {
+		manager.podsLock.Unlock()
+		manager.releaseUserNamespace(pod.uuid)
+		return fmt.Errorf("a pod with the name %q already exists", pod.name)
+	}
+	manager.pods[pod.uuid] = pod
+	manager.podNames[pod.name] = pod.uuid
+	manager.podsLock.Unlock()
+
+	manager.imageManager.AddReferences(pod.uuid, podImages(record.Manifest.Pod, record.Options.StagerHash))
+
+	pod.logRotationRoutine()
+	if exited {
+		pod.log.Infof("Recovered pod %q, its stager is no longer running", pod.name)
+		go pod.stagerExited(-1)
+		return nil
+	}
+	pod.monitorRoutine()
+	pod.log.Infof("Recovered pod %q", pod.name)
+	return nil
+}
+
+// loadStager loads the stager container with the given ID and ensures it is
+// still running. The container is returned along with any error so that a
+// stopped stager can still be cleaned up.
+func (manager *Manager) loadStager(id string) (libcontainer.Container, error) {
+	container, err := manager.factory.Load(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stager container: %v", err)
+	}
+	if container == nil {
+		return nil, fmt.Errorf("stager container %q was not found", id)
+	}
+	status, err := container.Status()
+	if err != nil {
+		return container, fmt.Errorf("failed to check stager container status: %v", err)
+	}
+	if status != libcontainer.Running {
+		return container, fmt.Errorf("stager container is %s", status)
+	}
+	return container, nil
+}
+
+// reapPod tears down the remnants of a pod that could not be recovered. It
+// kills the stager if it is still running, destroys its container, and removes
+// the pod's directory.
+func (manager *Manager) reapPod(record *podRecord, directory string) {
+	if record.ContainerID != "" {
+		if container, err := manager.factory.Load(record.ContainerID); err == nil && container != nil {
+			if status, err := container.Status(); err == nil && status == libcontainer.Running {
+				container.Signal(os.Signal(syscall.SIGKILL))
+				for end := time.Now().Add(reapTimeout); time.Now().Before(end); time.Sleep(time.Millisecond * 100) {
+					if status, err := container.Status(); err != nil || status != libcontainer.Running {
+						break
+					}
+				}
+			}
+			if err := container.Destroy(); err != nil {
+				manager.log.Warnf("Failed to destroy stager container for pod %s: %v", record.UUID, err)
+			}
+		}
+	}
+
+	if record.NetNsPath != "" {
+		if err := syscall.Unmount(record.NetNsPath, 0); err == nil {
+			os.Remove(record.NetNsPath)
+		}
+	}
+
+	if err := unmountDirectories(directory); err != nil {
+		manager.log.Warnf("Failed to unmount directories for pod %s: %v", record.UUID, err)
+		return
+	}
+	if err := os.RemoveAll(directory); err != nil {
+		manager.log.Warnf("Failed to remove directory for pod %s: %v", record.UUID, err)
+	}
+}
+
+// readPodRecord loads a pod record from the specified path.
+func readPodRecord(path string) (*podRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var record *podRecord
+	if err := json.NewDecoder(f).Decode(&record); err != nil {
+		return nil, err
+	}
+	if record == nil || record.UUID == "" {
+		return nil, fmt.Errorf("pod record is empty")
+	}
+	return record, nil
+}
+
+// monitorRoutine is the equivalent of waitRoutine for recovered pods. Since
+// kurmad is no longer the parent of the stager process, it polls the stager
+// container and restarts or tears down the pod according to its restart policy
+// once it is no longer running.
+func (pod *Pod) monitorRoutine() {
+	ch := make(chan struct{})
+	pod.stagerWaitCh = ch
+
+	go func() {
+		defer close(ch)
+
+		for {
+			// Poll more frequently once the pod is shutting down, since the stopping
+			// functions are waiting for the stager to exit.
+			if pod.isShuttingDown() {
+				time.Sleep(time.Millisecond * 100)
+			} else {
+				select {
+				case <-pod.shuttingDownCh:
+				case <-time.After(recoveredPollInterval):
+				}
+			}
+
+			pod.mutex.Lock()
+			container := pod.stagerContainer
+			pod.mutex.Unlock()
+			if container == nil {
+				return
+			}
+
+			status, err := container.Status()
+			if err == nil && status == libcontainer.Running {
+				continue
+			}
+			pod.log.Warnf("Stager container is no longer running: %s", status)
+
+			// If we're in the process of shutting down, just return
+			if pod.isShuttingDown() {
+				return
+			}
+
+			// The stager's exit code can't be retrieved since kurmad isn't its
+			// parent, so it is handled as though the stager failed.
+			go pod.stagerExited(-1)
+			return
+		}
+	}()
+}
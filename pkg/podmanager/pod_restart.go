@@ -0,0 +1,121 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// podSpec is the definition of the pod as it was originally requested, before
+// the startup functions apply isolators to its manifest and options. It is
+// retained so that the pod can be restarted from a clean slate.
+type podSpec struct {
+	Pod          *schema.PodManifest `json:"pod"`
+	RawVolumes   []types.Volume      `json:"rawVolumes,omitempty"`
+	StagerMounts []*configs.Mount    `json:"stagerMounts,omitempty"`
+}
+
+// newPodSpec captures a serialized copy of the pod's original definition.
+func newPodSpec(manifest *schema.PodManifest, options *backend.PodOptions) (json.RawMessage, error) {
+	b, err := json.Marshal(&podSpec{
+		Pod:          manifest,
+		RawVolumes:   options.RawVolumes,
+		StagerMounts: options.StagerMounts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pod specification: %v", err)
+	}
+	return json.RawMessage(b), nil
+}
+
+// stagerExitCode returns the exit code from the stager's process state, or -1
+// if it is unknown.
+func stagerExitCode(ps *os.ProcessState) int {
+	if ps == nil {
+		return -1
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok {
+		return ws.ExitStatus()
+	}
+	return -1
+}
+
+// stagerExited is called when the stager exits without the pod being shut
+// down. The pod is restarted if its restart policy allows it, otherwise it is
+// stopped.
+func (pod *Pod) stagerExited(exitCode int) {
+	pod.mutex.Lock()
+	policy := pod.options.RestartPolicy
+	restarts := pod.restarts
+	restartable := pod.spec != nil
+	pod.mutex.Unlock()
+
+	if !restartable || !policy.ShouldRestart(exitCode, restarts) {
+		pod.Stop()
+		return
+	}
+
+	delay := policy.Delay(restarts)
+	pod.log.Warnf("Stager exited with code %d, restarting pod in %v", exitCode, delay)
+
+	pod.mutex.Lock()
+	pod.state = backend.STARTING
+	pod.mutex.Unlock()
+
+	// Tear down what remains of the previous run of the pod.
+	for _, f := range podRestarting {
+		if err := f(pod); err != nil {
+			pod.log.Errorf("Failed to tear down pod for restart: %v", err)
+			pod.Stop()
+			return
+		}
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-pod.shuttingDownCh:
+		return
+	}
+
+	if err := pod.resetForRestart(); err != nil {
+		pod.log.Errorf("Failed to reset pod for restart: %v", err)
+		pod.Stop()
+		return
+	}
+	pod.start()
+}
+
+// resetForRestart restores the pod's manifest and options to their original
+// definition and clears the state from its previous run so the startup
+// functions can be run again.
+func (pod *Pod) resetForRestart() error {
+	pod.mutex.Lock()
+	defer pod.mutex.Unlock()
+
+	var spec *podSpec
+	if err := json.Unmarshal(pod.spec, &spec); err != nil {
+		return fmt.Errorf("failed to unmarshal pod specification: %v", err)
+	}
+
+	pod.restarts++
+	pod.manifest.Pod = spec.Pod
+	pod.manifest.Images = make(map[string]*schema.ImageManifest)
+	pod.manifest.AppImageOrder = make(map[string][]string)
+	pod.options.RawVolumes = spec.RawVolumes
+	pod.options.StagerMounts = spec.StagerMounts
+	pod.layerPaths = make(map[string]string)
+	pod.stagerProcess = nil
+	pod.stagerWaitCh = nil
+	pod.netNsPath = ""
+	pod.networkResults = nil
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/stager/container/common"
+)
+
+// Status returns the runtime status of the pod and its apps, as last written
+// by the stager to its state file. Apps the stager has not reported on yet are
+// still included so every app in the manifest is represented.
+func (pod *Pod) Status() (*backend.PodStatus, error) {
+	pod.mutex.Lock()
+	directory := pod.directory
+	manifest := pod.manifest
+	pod.mutex.Unlock()
+
+	var state *common.StagerState
+	if directory != "" {
+		var err error
+		state, err = pod.readStagerState()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	status := &backend.PodStatus{}
+	if state != nil {
+		status.StagerState = string(state.State)
+	}
+	if manifest == nil || manifest.Pod == nil {
+		return status, nil
+	}
+
+	status.Apps = make([]*backend.AppStatus, 0, len(manifest.Pod.Apps))
+	for _, app := range manifest.Pod.Apps {
+		appStatus := &backend.AppStatus{Name: app.Name.String()}
+		if state != nil {
+			if s := state.Apps[appStatus.Name]; s != nil {
+				appStatus.Pid = s.Pid
+				appStatus.Exited = s.Exited
+				appStatus.ExitCode = s.ExitCode
+				appStatus.ExitReason = s.ExitReason
+				appStatus.Restarts = s.Restarts
+			}
+		}
+		status.Apps = append(status.Apps, appStatus)
+	}
+	return status, nil
+}
+
+// readStagerState reads the state file written by the stager within its root
+// filesystem.
+func (pod *Pod) readStagerState() (*common.StagerState, error) {
+	f, err := os.Open(pod.stagerStatePath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var state *common.StagerState
+	if err := json.NewDecoder(f).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse stager state: %v", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/apcera/kurma/pkg/backend"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+const (
+	// defaultUserNamespacePodSize is the number of IDs mapped into each pod
+	// when it isn't configured, which covers the full range of 16 bit IDs.
+	defaultUserNamespacePodSize = 65536
+)
+
+// UserNamespaceOptions configures the ranges of host user and group IDs that
+// pods running in user namespaces are mapped into. The range is divided into
+// blocks of PodSize IDs, and each pod is given its own block so that no two
+// pods share IDs on the host.
+type UserNamespaceOptions struct {
+	UIDStart int `json:"uidStart"`
+	GIDStart int `json:"gidStart"`
+	Size     int `json:"size"`
+	PodSize  int `json:"podSize,omitempty"`
+}
+
+// Enabled returns whether user namespaces have been configured.
+func (o *UserNamespaceOptions) Enabled() bool {
+	return o != nil && o.Size > 0
+}
+
+// validate ensures the ranges are usable and applies the default pod size.
+func (o *UserNamespaceOptions) validate() error {
+	if o.PodSize == 0 {
+		o.PodSize = defaultUserNamespacePodSize
+	}
+	if o.UIDStart <= 0 || o.GIDStart <= 0 {
+		return fmt.Errorf("the user namespace uidStart and gidStart must be greater than zero")
+	}
+	if o.PodSize < 0 || o.PodSize > o.Size {
+		return fmt.Errorf("the user namespace podSize must be between 1 and the size of the range")
+	}
+	return nil
+}
+
+// slots returns the number of pods that can be given their own block of IDs.
+func (o *UserNamespaceOptions) slots() int {
+	return o.Size / o.PodSize
+}
+
+// allocateUserNamespace reserves a block of host IDs for the pod.
+func (manager *Manager) allocateUserNamespace(uuid string) (*backend.UserNamespace, error) {
+	opts := manager.Options.UserNamespaces
+
+	manager.userNamespacesLock.Lock()
+	defer manager.userNamespacesLock.Unlock()
+
+	for slot := 0; slot < opts.slots(); slot++ {
+		if _, used := manager.userNamespaces[slot]; used {
+			continue
+		}
+		manager.userNamespaces[slot] = uuid
+		return &backend.UserNamespace{
+			HostUID: opts.UIDStart + slot*opts.PodSize,
+			HostGID: opts.GIDStart + slot*opts.PodSize,
+			Size:    opts.PodSize,
+		}, nil
+	}
+	return nil, fmt.Errorf("all %d user namespace ID ranges are in use", opts.slots())
+}
+
+// reserveUserNamespace marks the block of IDs used by a recovered pod as in
+// use.
+func (manager *Manager) reserveUserNamespace(uuid string, userns *backend.UserNamespace) error {
+	opts := manager.Options.UserNamespaces
+	if !opts.Enabled() {
+		return fmt.Errorf("pod uses a user namespace, but none are configured")
+	}
+
+	offset := userns.HostUID - opts.UIDStart
+	slot := offset / opts.PodSize
+	if offset < 0 || offset%opts.PodSize != 0 || slot >= opts.slots() || userns.Size != opts.PodSize {
+		return fmt.Errorf("pod's user namespace IDs are outside the configured range")
+	}
+
+	manager.userNamespacesLock.Lock()
+	defer manager.userNamespacesLock.Unlock()
+
+	if owner, used := manager.userNamespaces[slot]; used && owner != uuid {
+		return fmt.Errorf("pod's user namespace IDs are already in use by pod %s", owner)
+	}
+	manager.userNamespaces[slot] = uuid
+	return nil
+}
+
+// releaseUserNamespace frees any block of IDs held by the pod.
+func (manager *Manager) releaseUserNamespace(uuid string) {
+	manager.userNamespacesLock.Lock()
+	defer manager.userNamespacesLock.Unlock()
+
+	for slot, owner := range manager.userNamespaces {
+		if owner == uuid {
+			delete(manager.userNamespaces, slot)
+		}
+	}
+}
+
+// wantsUserNamespace returns whether the pod should be run within a user
+// namespace. Pods run in one whenever user namespaces are configured, unless
+// they request the host's user namespace or contain a host privileged app.
+func (pod *Pod) wantsUserNamespace() bool {
+	if !pod.manager.Options.UserNamespaces.Enabled() {
+		return false
+	}
+
+	if nsiso := getNamespaceIsolator(pod.manifest.Pod.Isolators); nsiso != nil {
+		if nsiso.User() == kschema.LinuxNamespaceHost {
+			return false
+		}
+	}
+
+	for _, runtimeApp := range pod.manifest.Pod.Apps {
+		app := runtimeApp.App
+		if app == nil {
+			app = pod.manifest.Images[runtimeApp.Image.ID.String()].App
+		}
+		if iso := app.Isolators.GetByName(kschema.HostPrivilegedName); iso != nil {
+			if piso, ok := iso.Value().(*kschema.HostPrivileged); ok && bool(*piso) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// startingUserNamespace assigns the pod its user namespace ID mapping and
+// shifts the ownership of its image layers and volumes into the mapped range,
+// so that root within the pod owns them. The layers are shared with other pods,
+// so the pod is given its own copy of each.
+func (pod *Pod) startingUserNamespace() error {
+	if !pod.wantsUserNamespace() {
+		return nil
+	}
+
+	// Named volumes outlive the pod and may be shared with other pods, so their
+	// ownership can't be shifted into the range of a single pod.
+	viso := getVolumesIsolator(pod.manifest.Pod.Isolators)
+	for _, volume := range pod.manifest.Pod.Volumes {
+		if opts := viso.Get(volume.Name.String()); opts != nil && opts.Kind == kschema.VolumeKindNamed {
+			return fmt.Errorf("named volume %q cannot be used by a pod in a user namespace", volume.Name)
+		}
+	}
+
+	// A pod being restarted keeps the mapping it was already assigned.
+	if pod.manifest.UserNamespace == nil {
+		userns, err := pod.manager.allocateUserNamespace(pod.uuid)
+		if err != nil {
+			return err
+		}
+		pod.mutex.Lock()
+		pod.manifest.UserNamespace = userns
+		pod.mutex.Unlock()
+	}
+	userns := pod.manifest.UserNamespace
+
+	pod.log.Debug("Shifting layer and volume ownership for the user namespace.")
+
+	layersPath := filepath.Join(pod.directory, "layers")
+	if err := mkdirs([]string{layersPath}, os.FileMode(0755), true); err != nil {
+		return fmt.Errorf("failed to create layers directory: %v", err)
+	}
+	for layer, layerPath := range pod.layerPaths {
+		dst := filepath.Join(layersPath, layer)
+		if err := mkdirs([]string{dst}, os.FileMode(0755), false); err != nil {
+			return fmt.Errorf("failed to create directory for layer %q: %v", layer, err)
+		}
+		if err := copypath(layerPath, dst); err != nil {
+			return fmt.Errorf("failed to copy layer %q: %v", layer, err)
+		}
+		if err := shiftOwnership(dst, userns); err != nil {
+			return fmt.Errorf("failed to shift ownership of layer %q: %v", layer, err)
+		}
+		pod.layerPaths[layer] = dst
+	}
+
+	// Host volumes are left as they are, since they're shared with the host,
+	// and tmpfs volumes are given the mapped owner when they're mounted. Only
+	// empty volumes, which are removed along with the pod, remain.
+	for _, volume := range pod.manifest.Pod.Volumes {
+		if volume.Kind == volumeKindHost {
+			continue
+		}
+		hostPath, err := pod.volumeHostPath(volume)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve volume for %q: %v", volume.Name, err)
+		}
+		if hostPath == "" {
+			continue
+		}
+		if err := shiftOwnership(hostPath, userns); err != nil {
+			return fmt.Errorf("failed to shift ownership of volume %q: %v", volume.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// shiftOwnership walks the path and moves the ownership of each file into the
+// user namespace's range. Only IDs that fall within the size of the mapping
+// are shifted, which leaves anything that was already shifted, such as a
+// volume reused by the same pod, unchanged.
+func shiftOwnership(path string, userns *backend.UserNamespace) error {
+	return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+
+		uid, gid := int(stat.Uid), int(stat.Gid)
+		if uid < userns.Size {
+			uid += userns.HostUID
+		}
+		if gid < userns.Size {
+			gid += userns.HostGID
+		}
+		if uid == int(stat.Uid) && gid == int(stat.Gid) {
+			return nil
+		}
+
+		if err := os.Lchown(p, uid, gid); err != nil {
+			return err
+		}
+
+		// Changing the owner clears the setuid and setgid bits, so restore them.
+		if fi.Mode()&os.ModeSymlink == 0 && fi.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+			if err := os.Chmod(p, fi.Mode()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
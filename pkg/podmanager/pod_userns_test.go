@@ -0,0 +1,122 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/apcera/kurma/pkg/backend"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestUserNamespaceAllocation(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	manager.Options.UserNamespaces = &UserNamespaceOptions{
+		UIDStart: 100000,
+		GIDStart: 200000,
+		Size:     2 * 65536,
+	}
+	tt.TestExpectSuccess(t, manager.Options.UserNamespaces.validate())
+
+	first, err := manager.allocateUserNamespace("pod1")
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, first, &backend.UserNamespace{HostUID: 100000, HostGID: 200000, Size: 65536})
+
+	second, err := manager.allocateUserNamespace("pod2")
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, second, &backend.UserNamespace{HostUID: 165536, HostGID: 265536, Size: 65536})
+
+	_, err = manager.allocateUserNamespace("pod3")
+	tt.TestExpectError(t, err)
+
+	// releasing a range allows it to be reused
+	manager.releaseUserNamespace("pod1")
+	third, err := manager.allocateUserNamespace("pod3")
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, third, first)
+
+	// a recovered pod can't claim a range that is in use
+	tt.TestExpectError(t, manager.reserveUserNamespace("pod4", first))
+	tt.TestExpectSuccess(t, manager.reserveUserNamespace("pod3", first))
+	manager.releaseUserNamespace("pod3")
+	tt.TestExpectSuccess(t, manager.reserveUserNamespace("pod4", first))
+
+	// or one that doesn't line up with the configured ranges
+	tt.TestExpectError(t, manager.reserveUserNamespace("pod5", &backend.UserNamespace{HostUID: 100001, HostGID: 200001, Size: 65536}))
+}
+
+func TestShiftOwnership(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	if os.Getuid() != 0 {
+		t.Skip("changing file ownership requires root")
+	}
+
+	dir := tt.TempDir(t)
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("data"), os.FileMode(0755)))
+	tt.TestExpectSuccess(t, os.Lchown(filepath.Join(dir, "file"), 1000, 1000))
+	tt.TestExpectSuccess(t, os.Chmod(filepath.Join(dir, "file"), os.FileMode(0755)|os.ModeSetuid))
+	tt.TestExpectSuccess(t, os.Symlink("file", filepath.Join(dir, "link")))
+
+	userns := &backend.UserNamespace{HostUID: 100000, HostGID: 200000, Size: 65536}
+	tt.TestExpectSuccess(t, shiftOwnership(dir, userns))
+
+	owner := func(name string) (int, int, os.FileMode) {
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		tt.TestExpectSuccess(t, err)
+		stat := fi.Sys().(*syscall.Stat_t)
+		return int(stat.Uid), int(stat.Gid), fi.Mode()
+	}
+
+	uid, gid, _ := owner("")
+	tt.TestEqual(t, uid, 100000)
+	tt.TestEqual(t, gid, 200000)
+	uid, gid, mode := owner("file")
+	tt.TestEqual(t, uid, 101000)
+	tt.TestEqual(t, gid, 201000)
+	tt.TestEqual(t, mode&os.ModeSetuid != 0, true)
+	uid, gid, _ = owner("link")
+	tt.TestEqual(t, uid, 100000)
+	tt.TestEqual(t, gid, 200000)
+
+	// shifting again leaves everything as it is
+	tt.TestExpectSuccess(t, shiftOwnership(dir, userns))
+	uid, gid, _ = owner("file")
+	tt.TestEqual(t, uid, 101000)
+	tt.TestEqual(t, gid, 201000)
+}
+
+func TestUserNamespaceNamedVolumes(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	manager.Options.VolumeDirectory = tt.TempDir(t)
+	manager.Options.UserNamespaces = &UserNamespaceOptions{UIDStart: 100000, GIDStart: 200000, Size: 65536}
+	tt.TestExpectSuccess(t, manager.Options.UserNamespaces.validate())
+
+	pod := createPod(t, manager)
+	pod.manifest = &backend.StagerManifest{
+		Pod: parsePodManifest(t, `{
+			"acKind": "PodManifest",
+			"acVersion": "0.7.4",
+			"volumes": [{"name": "cache", "kind": "empty"}],
+			"isolators": [{"name": "kurma/volumes", "value": {"cache": {"kind": "named"}}}]
+		}`),
+	}
+
+	// named volumes are shared beyond the pod, so they can't be shifted for it
+	err := pod.startingUserNamespace()
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `named volume "cache" cannot be used by a pod in a user namespace`)
+	tt.TestEqual(t, pod.manifest.UserNamespace, (*backend.UserNamespace)(nil))
+}
@@ -0,0 +1,231 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+const (
+	volumeKindEmpty = "empty"
+	volumeKindHost  = "host"
+)
+
+// getVolumesIsolator returns the volumes isolator from the list of isolators,
+// or nil if there isn't one.
+func getVolumesIsolator(isolators types.Isolators) *kschema.Volumes {
+	for _, iso := range isolators {
+		if iso.Name.String() == kschema.VolumesName {
+			if viso, ok := iso.Value().(*kschema.Volumes); ok {
+				return viso
+			}
+		}
+	}
+	return nil
+}
+
+// validateVolumes ensures that any host volumes in the manifest are within the
+// paths allowed by the configuration, and that the volumes isolator only
+// references empty volumes declared in the manifest.
+func (manager *Manager) validateVolumes(manifest *schema.PodManifest) error {
+	viso := getVolumesIsolator(manifest.Isolators)
+
+	declared := make(map[string]bool, len(manifest.Volumes))
+	for _, volume := range manifest.Volumes {
+		name := volume.Name.String()
+		declared[name] = true
+
+		opts := viso.Get(name)
+		switch volume.Kind {
+		case volumeKindHost:
+			if opts != nil {
+				return fmt.Errorf("volume %q must be an %s volume to be given a kind by the %q isolator", name, volumeKindEmpty, kschema.VolumesName)
+			}
+			if !manager.hostVolumeAllowed(volume.Source) {
+				return fmt.Errorf("host volume %q source %q is not within an allowed host path", name, volume.Source)
+			}
+		case volumeKindEmpty:
+			if opts != nil && opts.Kind == kschema.VolumeKindNamed && manager.Options.VolumeDirectory == "" {
+				return fmt.Errorf("volume %q is a named volume, but no volume directory is configured", name)
+			}
+		}
+	}
+
+	if viso != nil {
+		for name := range *viso {
+			if !declared[name] {
+				return fmt.Errorf("the %q isolator references volume %q, which is not in the manifest", kschema.VolumesName, name)
+			}
+		}
+	}
+	return nil
+}
+
+// hostVolumeAllowed returns whether the source of a host volume is one of the
+// allowed host paths or is contained within one of them.
+func (manager *Manager) hostVolumeAllowed(source string) bool {
+	source = filepath.Clean(source)
+	for _, allowed := range manager.Options.AllowedHostVolumes {
+		allowed = filepath.Clean(allowed)
+		if source == allowed || allowed == "/" || strings.HasPrefix(source, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// emptyVolumePath returns the path to an empty volume's directory. It is within
+// the pod's directory, so it is removed along with the pod.
+func (pod *Pod) emptyVolumePath(name string) string {
+	return filepath.Join(pod.directory, "volumes", name)
+}
+
+// volumeHostPath returns the path on the host that backs the volume. An empty
+// path is returned for tmpfs volumes, which aren't backed by the host's
+// filesystem.
+func (pod *Pod) volumeHostPath(volume types.Volume) (string, error) {
+	name := volume.Name.String()
+
+	if volume.Kind == volumeKindHost {
+		// Resolve any symlinks so a link within an allowed path can't be used to
+		// reach outside of it.
+		source, err := filepath.EvalSymlinks(volume.Source)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve host volume source: %v", err)
+		}
+		if !pod.manager.hostVolumeAllowed(source) {
+			return "", fmt.Errorf("host volume source %q is not within an allowed host path", source)
+		}
+		return source, nil
+	}
+
+	opts := getVolumesIsolator(pod.manifest.Pod.Isolators).Get(name)
+	switch {
+	case opts == nil:
+		return pod.emptyVolumePath(name), nil
+	case opts.Kind == kschema.VolumeKindNamed:
+		return pod.manager.getVolumePath(name)
+	case opts.Kind == kschema.VolumeKindTmpfs:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unrecognized volume kind %q", opts.Kind)
+	}
+}
+
+// startingVolumes creates the directories for the pod's empty volumes with the
+// mode and ownership requested in the manifest.
+func (pod *Pod) startingVolumes() error {
+	viso := getVolumesIsolator(pod.manifest.Pod.Isolators)
+
+	for _, volume := range pod.manifest.Pod.Volumes {
+		name := volume.Name.String()
+		if volume.Kind != volumeKindEmpty || viso.Get(name) != nil {
+			continue
+		}
+
+		mode, err := volumeMode(volume)
+		if err != nil {
+			return err
+		}
+		path := pod.emptyVolumePath(name)
+		if err := mkdirs([]string{filepath.Dir(path), path}, os.FileMode(0755), true); err != nil {
+			return fmt.Errorf("failed to create volume %q: %v", name, err)
+		}
+		if err := syscall.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to set mode on volume %q: %v", name, err)
+		}
+		if volume.UID != nil && volume.GID != nil {
+			if err := os.Chown(path, *volume.UID, *volume.GID); err != nil {
+				return fmt.Errorf("failed to set owner on volume %q: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// volumeMount returns the mount which places the volume within the stager's
+// volumes directory.
+func (pod *Pod) volumeMount(volume types.Volume) (*configs.Mount, error) {
+	name := volume.Name.String()
+	dst := filepath.Join("/volumes", name)
+
+	hostPath, err := pod.volumeHostPath(volume)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *configs.Mount
+	if hostPath == "" {
+		data, err := pod.tmpfsOptions(volume)
+		if err != nil {
+			return nil, err
+		}
+		m = &configs.Mount{
+			Source:      "tmpfs",
+			Destination: dst,
+			Device:      "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NODEV,
+			Data:        data,
+		}
+	} else {
+		m = &configs.Mount{
+			Source:      hostPath,
+			Destination: dst,
+			Device:      "bind",
+			Flags:       syscall.MS_BIND,
+		}
+	}
+
+	if volume.ReadOnly != nil && *volume.ReadOnly {
+		m.Flags |= syscall.MS_RDONLY
+	}
+	return m, nil
+}
+
+// tmpfsOptions returns the mount options for a tmpfs volume, which limit its
+// size and set the mode and ownership of its root. The owner is mapped into
+// the pod's user namespace, if it has one.
+func (pod *Pod) tmpfsOptions(volume types.Volume) (string, error) {
+	opts := getVolumesIsolator(pod.manifest.Pod.Isolators).Get(volume.Name.String())
+	size, err := opts.SizeBytes()
+	if err != nil {
+		return "", fmt.Errorf("volume %q %v", volume.Name, err)
+	}
+	mode, err := volumeMode(volume)
+	if err != nil {
+		return "", err
+	}
+
+	uid, gid := 0, 0
+	if volume.UID != nil && volume.GID != nil {
+		uid, gid = *volume.UID, *volume.GID
+	}
+	if userns := pod.manifest.UserNamespace; userns != nil {
+		uid += userns.HostUID
+		gid += userns.HostGID
+	}
+	return fmt.Sprintf("size=%d,mode=%04o,uid=%d,gid=%d", size, mode, uid, gid), nil
+}
+
+// volumeMode parses the octal mode of an empty volume, defaulting to 0755.
+func volumeMode(volume types.Volume) (uint32, error) {
+	if volume.Mode == nil {
+		return 0755, nil
+	}
+	mode, err := strconv.ParseUint(*volume.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("volume %q has invalid mode %q", volume.Name, *volume.Mode)
+	}
+	return uint32(mode), nil
+}
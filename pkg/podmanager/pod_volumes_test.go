@@ -0,0 +1,140 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/appc/spec/schema"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func parsePodManifest(t *testing.T, s string) *schema.PodManifest {
+	manifest := schema.BlankPodManifest()
+	tt.TestExpectSuccess(t, json.Unmarshal([]byte(s), &manifest))
+	return manifest
+}
+
+func TestValidateVolumes(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+	manager.Options.AllowedHostVolumes = []string{"/srv/data"}
+
+	manifest := parsePodManifest(t, `{
+		"acKind": "PodManifest",
+		"acVersion": "0.7.4",
+		"volumes": [
+			{"name": "data", "kind": "host", "source": "/srv/data/app"},
+			{"name": "scratch", "kind": "empty"}
+		],
+		"isolators": [
+			{"name": "kurma/volumes", "value": {"scratch": {"kind": "tmpfs", "size": "64MiB"}}}
+		]
+	}`)
+	tt.TestExpectSuccess(t, manager.validateVolumes(manifest))
+
+	// host volumes outside the allowed paths are rejected
+	manifest.Volumes[0].Source = "/srv/database"
+	err := manager.validateVolumes(manifest)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `host volume "data" source "/srv/database" is not within an allowed host path`)
+
+	// named volumes require a volume directory
+	manifest = parsePodManifest(t, `{
+		"acKind": "PodManifest",
+		"acVersion": "0.7.4",
+		"volumes": [{"name": "cache", "kind": "empty"}],
+		"isolators": [{"name": "kurma/volumes", "value": {"cache": {"kind": "named"}}}]
+	}`)
+	tt.TestExpectError(t, manager.validateVolumes(manifest))
+	manager.Options.VolumeDirectory = tt.TempDir(t)
+	tt.TestExpectSuccess(t, manager.validateVolumes(manifest))
+
+	// the isolator may only reference volumes in the manifest
+	manifest.Volumes = nil
+	err = manager.validateVolumes(manifest)
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `the "kurma/volumes" isolator references volume "cache", which is not in the manifest`)
+
+	// tmpfs volumes must be given a size
+	err = json.Unmarshal([]byte(`[{"name": "kurma/volumes", "value": {"cache": {"kind": "tmpfs"}}}]`), &manifest.Isolators)
+	tt.TestExpectError(t, err)
+}
+
+func TestVolumeMounts(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	hostDir := tt.TempDir(t)
+	manager := createManager(t)
+	manager.Options.VolumeDirectory = tt.TempDir(t)
+	manager.Options.AllowedHostVolumes = []string{hostDir}
+
+	pod := createPod(t, manager)
+	pod.manifest = &backend.StagerManifest{
+		Pod: parsePodManifest(t, `{
+			"acKind": "PodManifest",
+			"acVersion": "0.7.4",
+			"volumes": [
+				{"name": "empty", "kind": "empty", "mode": "1777"},
+				{"name": "host", "kind": "host", "source": "`+hostDir+`", "readOnly": true},
+				{"name": "named", "kind": "empty"},
+				{"name": "scratch", "kind": "empty", "mode": "0700", "uid": 10, "gid": 20}
+			],
+			"isolators": [
+				{"name": "kurma/volumes", "value": {
+					"named": {"kind": "named"},
+					"scratch": {"kind": "tmpfs", "size": "64MiB"}
+				}}
+			]
+		}`),
+		UserNamespace: &backend.UserNamespace{HostUID: 100000, HostGID: 200000, Size: 65536},
+	}
+	if os.Getuid() != 0 {
+		uid, gid := os.Getuid(), os.Getgid()
+		pod.manifest.Pod.Volumes[0].UID = &uid
+		pod.manifest.Pod.Volumes[0].GID = &gid
+	}
+
+	tt.TestExpectSuccess(t, pod.startingBaseDirectories())
+	tt.TestExpectSuccess(t, pod.startingVolumes())
+
+	// empty volumes are created within the pod's directory
+	fi, err := os.Stat(pod.emptyVolumePath("empty"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, fi.Mode()&os.ModePerm, os.FileMode(0777))
+	tt.TestEqual(t, fi.Mode()&os.ModeSticky, os.ModeSticky)
+
+	mounts := make(map[string]string)
+	for _, volume := range pod.manifest.Pod.Volumes {
+		m, err := pod.volumeMount(volume)
+		tt.TestExpectSuccess(t, err)
+		mounts[volume.Name.String()] = m.Source
+		switch volume.Name.String() {
+		case "host":
+			tt.TestEqual(t, m.Flags, syscall.MS_BIND|syscall.MS_RDONLY)
+		case "scratch":
+			tt.TestEqual(t, m.Device, "tmpfs")
+			tt.TestEqual(t, m.Data, "size=67108864,mode=0700,uid=100010,gid=200020")
+		}
+	}
+	tt.TestEqual(t, mounts, map[string]string{
+		"empty":   pod.emptyVolumePath("empty"),
+		"host":    hostDir,
+		"named":   filepath.Join(manager.Options.VolumeDirectory, "named"),
+		"scratch": "tmpfs",
+	})
+
+	// host volumes are checked again when mounted
+	manager.Options.AllowedHostVolumes = nil
+	_, err = pod.volumeMount(pod.manifest.Pod.Volumes[1])
+	tt.TestExpectError(t, err)
+}
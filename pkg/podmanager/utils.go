@@ -12,6 +12,7 @@ import (
 	"syscall"
 
 	"github.com/apcera/kurma/pkg/capabilities"
+	"github.com/apcera/kurma/pkg/resources"
 	"github.com/apcera/util/proc"
 	"github.com/apcera/util/tarhelper"
 	"github.com/appc/spec/schema/types"
@@ -29,10 +30,18 @@ func (pod *Pod) stagerLogPath() string {
 	return filepath.Join(pod.directory, "stager.log")
 }
 
+func (pod *Pod) recordPath() string {
+	return filepath.Join(pod.directory, podRecordFile)
+}
+
 func (pod *Pod) stagerRootPath() string {
 	return filepath.Join(pod.directory, "stager")
 }
 
+func (pod *Pod) stagerStatePath() string {
+	return filepath.Join(pod.stagerRootPath(), "state.json")
+}
+
 func (pod *Pod) generateContainerConfig() (*configs.Config, error) {
 	root := pod.stagerRootPath()
 
@@ -79,6 +88,12 @@ func (pod *Pod) generateContainerConfig() (*configs.Config, error) {
 		},
 	}
 
+	// Apply the pod's resource limits to the stager's cgroup, which contains
+	// the init and app containers as well as any enter sessions.
+	if err := resources.Apply(pod.manifest.Pod.Isolators, config.Cgroups.Resources); err != nil {
+		return nil, err
+	}
+
 	// Add the layer mounts
 	for layer, layerPath := range pod.layerPaths {
 		dst := filepath.Join("/layers", layer)
@@ -93,23 +108,10 @@ func (pod *Pod) generateContainerConfig() (*configs.Config, error) {
 
 	// Add in the volume mounts
 	for _, volume := range pod.manifest.Pod.Volumes {
-		hostPath, err := pod.manager.getVolumePath(volume.Name.String())
+		m, err := pod.volumeMount(volume)
 		if err != nil {
 			return nil, fmt.Errorf("failed to retrieve volume for %q: %v", volume.Name, err)
 		}
-		dst := filepath.Join("/volumes", volume.Name.String())
-
-		m := &configs.Mount{
-			Source:      hostPath,
-			Destination: dst,
-			Device:      "bind",
-			Flags:       syscall.MS_BIND,
-		}
-
-		if volume.ReadOnly != nil && *volume.ReadOnly {
-			m.Flags |= syscall.MS_RDONLY
-		}
-
 		config.Mounts = append(config.Mounts, m)
 	}
 
@@ -237,8 +239,8 @@ func convertACIdentifierToACName(name types.ACIdentifier) (*types.ACName, error)
 	return types.NewACName(n)
 }
 
-// waitRoutine is used to track when the stager exits and to respond by tearing
-// down the pod.
+// waitRoutine is used to track when the stager exits and to respond by either
+// restarting or tearing down the pod.
 func (pod *Pod) waitRoutine() {
 	proc := pod.stagerProcess
 	if proc == nil {
@@ -253,13 +255,13 @@ func (pod *Pod) waitRoutine() {
 
 		// Wait for the stager process to exit
 		ps, _ := proc.Wait()
-		pod.log.Warnf("Stager process has exited: %v", ps.String())
+		pod.log.Warnf("Stager process has exited: %v", ps)
 
 		// If we're in the process of shutting down, just return
 		if pod.isShuttingDown() {
 			return
 		}
-		go pod.Stop()
+		go pod.stagerExited(stagerExitCode(ps))
 	}()
 }
 
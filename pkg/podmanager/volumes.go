@@ -0,0 +1,172 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/backend"
+	"github.com/apcera/kurma/pkg/misc"
+	"github.com/appc/spec/schema/types"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+// Volumes returns the named volumes stored on the host.
+func (manager *Manager) Volumes() ([]*backend.Volume, error) {
+	if manager.Options.VolumeDirectory == "" {
+		return nil, nil
+	}
+
+	manager.volumeLock.Lock()
+	defer manager.volumeLock.Unlock()
+
+	fis, err := ioutil.ReadDir(manager.Options.VolumeDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume directory: %v", err)
+	}
+
+	users := manager.volumeUsers()
+	volumes := make([]*backend.Volume, 0, len(fis))
+	for _, fi := range fis {
+		if !fi.IsDir() || !types.ValidACName.MatchString(fi.Name()) {
+			continue
+		}
+		volume, err := manager.describeVolume(fi.Name(), users)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// Volume returns the named volume, or an error if it does not exist.
+func (manager *Manager) Volume(name string) (*backend.Volume, error) {
+	if err := manager.checkVolumeName(name); err != nil {
+		return nil, err
+	}
+
+	manager.volumeLock.Lock()
+	defer manager.volumeLock.Unlock()
+
+	if _, err := os.Stat(filepath.Join(manager.Options.VolumeDirectory, name)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("volume %q does not exist", name)
+		}
+		return nil, err
+	}
+	return manager.describeVolume(name, manager.volumeUsers())
+}
+
+// CreateVolume creates a new, empty named volume.
+func (manager *Manager) CreateVolume(name string) (*backend.Volume, error) {
+	if err := manager.checkVolumeName(name); err != nil {
+		return nil, err
+	}
+
+	manager.volumeLock.Lock()
+	defer manager.volumeLock.Unlock()
+
+	if err := os.Mkdir(filepath.Join(manager.Options.VolumeDirectory, name), os.FileMode(0755)); err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("volume %q already exists", name)
+		}
+		return nil, fmt.Errorf("failed to create volume %q: %v", name, err)
+	}
+	return &backend.Volume{Name: name}, nil
+}
+
+// DeleteVolume removes the named volume and its contents. It fails if the
+// volume is in use by any pods.
+func (manager *Manager) DeleteVolume(name string) error {
+	if err := manager.checkVolumeName(name); err != nil {
+		return err
+	}
+
+	// The volume lock is held until the volume is removed so that a pod can't
+	// begin using it in the meantime.
+	manager.volumeLock.Lock()
+	defer manager.volumeLock.Unlock()
+
+	volumePath := filepath.Join(manager.Options.VolumeDirectory, name)
+	if _, err := os.Stat(volumePath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("volume %q does not exist", name)
+		}
+		return err
+	}
+
+	if pods := manager.volumeUsers()[name]; len(pods) > 0 {
+		return fmt.Errorf("volume %q is in use by pods %s", name, strings.Join(pods, ", "))
+	}
+
+	if err := os.RemoveAll(volumePath); err != nil {
+		return fmt.Errorf("failed to remove volume %q: %v", name, err)
+	}
+	return nil
+}
+
+// checkVolumeName ensures named volumes are configured and that the name is
+// valid, so it can't be used to reference paths outside the volume directory.
+func (manager *Manager) checkVolumeName(name string) error {
+	if manager.Options.VolumeDirectory == "" {
+		return fmt.Errorf("named volumes are not configured")
+	}
+	if !types.ValidACName.MatchString(name) {
+		return fmt.Errorf("invalid characters present in volume name")
+	}
+	return nil
+}
+
+// describeVolume returns the volume's details. It must be called with the
+// volume lock held.
+func (manager *Manager) describeVolume(name string, users map[string][]string) (*backend.Volume, error) {
+	size, err := misc.DiskUsage(filepath.Join(manager.Options.VolumeDirectory, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate size of volume %q: %v", name, err)
+	}
+	return &backend.Volume{
+		Name: name,
+		Size: size,
+		Pods: users[name],
+	}, nil
+}
+
+// volumeUsers returns a map of the name of each named volume in use to the
+// sorted UUIDs of the pods using it.
+func (manager *Manager) volumeUsers() map[string][]string {
+	manager.podsLock.RLock()
+	pods := make([]*Pod, 0, len(manager.pods))
+	for _, p := range manager.pods {
+		if pod, ok := p.(*Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+	manager.podsLock.RUnlock()
+
+	users := make(map[string][]string)
+	for _, pod := range pods {
+		pod.mutex.Lock()
+		if pod.manifest != nil && pod.manifest.Pod != nil {
+			if viso := getVolumesIsolator(pod.manifest.Pod.Isolators); viso != nil {
+				for name, opts := range *viso {
+					if opts != nil && opts.Kind == kschema.VolumeKindNamed {
+						users[name] = append(users[name], pod.uuid)
+					}
+				}
+			}
+		}
+		pod.mutex.Unlock()
+	}
+
+	for _, uuids := range users {
+		sort.Strings(uuids)
+	}
+	return users
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package podmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apcera/kurma/pkg/backend"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func TestNamedVolumes(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manager := createManager(t)
+
+	// named volumes must be configured
+	_, err := manager.CreateVolume("data")
+	tt.TestExpectError(t, err)
+	volumes, err := manager.Volumes()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(volumes), 0)
+
+	manager.Options.VolumeDirectory = tt.TempDir(t)
+
+	volume, err := manager.CreateVolume("data")
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, volume.Name, "data")
+	_, err = manager.CreateVolume("data")
+	tt.TestExpectError(t, err)
+	_, err = manager.CreateVolume("../data")
+	tt.TestExpectError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(manager.Options.VolumeDirectory, "data", "file"), make([]byte, 8192), os.FileMode(0644))
+	tt.TestExpectSuccess(t, err)
+
+	// a pod referencing the volume marks it in use
+	pod := createPod(t, manager)
+	pod.manifest = &backend.StagerManifest{
+		Pod: parsePodManifest(t, `{
+			"acKind": "PodManifest",
+			"acVersion": "0.7.4",
+			"volumes": [{"name": "data", "kind": "empty"}],
+			"isolators": [{"name": "kurma/volumes", "value": {"data": {"kind": "named"}}}]
+		}`),
+	}
+	manager.pods[pod.uuid] = pod
+
+	volume, err = manager.Volume("data")
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, volume.Size >= 8192, true)
+	tt.TestEqual(t, volume.Pods, []string{pod.uuid})
+
+	volumes, err = manager.Volumes()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(volumes), 1)
+	tt.TestEqual(t, volumes[0], volume)
+
+	err = manager.DeleteVolume("data")
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), `volume "data" is in use by pods `+pod.uuid)
+
+	// once the pod is gone, it can be deleted
+	delete(manager.pods, pod.uuid)
+	tt.TestExpectSuccess(t, manager.DeleteVolume("data"))
+	_, err = manager.Volume("data")
+	tt.TestExpectError(t, err)
+	tt.TestExpectError(t, manager.DeleteVolume("data"))
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package aci
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/appc/spec/discovery"
+)
+
+const (
+	// DefaultDiscoveryTTL is how long discovered endpoints are cached for.
+	DefaultDiscoveryTTL = 5 * time.Minute
+)
+
+// An EndpointCache holds the endpoints discovered for images, so images which
+// are retrieved repeatedly aren't discovered each time. A nil EndpointCache
+// caches nothing.
+type EndpointCache struct {
+	ttl     time.Duration
+	entries map[string]*cachedEndpoints
+	lock    sync.Mutex
+
+	// now returns the current time, and is replaced by tests.
+	now func() time.Time
+}
+
+type cachedEndpoints struct {
+	endpoints discovery.ACIEndpoints
+	expires   time.Time
+}
+
+// NewEndpointCache creates an EndpointCache which keeps discovered endpoints
+// for the ttl.
+func NewEndpointCache(ttl time.Duration) *EndpointCache {
+	return &EndpointCache{
+		ttl:     ttl,
+		entries: make(map[string]*cachedEndpoints),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached endpoints for the image, or nil if there are none or
+// they have expired.
+func (c *EndpointCache) get(key string) discovery.ACIEndpoints {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return entry.endpoints
+}
+
+// set caches the endpoints discovered for the image.
+func (c *EndpointCache) set(key string, endpoints discovery.ACIEndpoints) {
+	if c == nil || len(endpoints) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = &cachedEndpoints{
+		endpoints: endpoints,
+		expires:   c.now().Add(c.ttl),
+	}
+}
+
+// remove drops the cached endpoints for the image, so it is discovered again
+// when it is next retrieved.
+func (c *EndpointCache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, key)
+}
+
+// endpointKey returns the key the endpoints discovered for the app are cached
+// under. The labels are sorted so the key is stable, and images discovered
+// insecurely are kept apart from those discovered over HTTPS.
+func endpointKey(app *discovery.App, insecure bool) string {
+	labels := make([]string, 0, len(app.Labels))
+	for name, value := range app.Labels {
+		labels = append(labels, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(labels)
+	return fmt.Sprintf("%s,%v,%v", app.Name, labels, insecure)
+}
@@ -8,9 +8,12 @@ import (
 	"net/http"
 
 	"github.com/apcera/kurma/pkg/remote"
+	"github.com/apcera/kurma/pkg/trust"
+	"github.com/apcera/util/tempfile"
 
 	remotehttp "github.com/apcera/kurma/pkg/remote/http"
 
+	appcaci "github.com/appc/spec/aci"
 	"github.com/appc/spec/discovery"
 	"github.com/appc/spec/schema/types"
 )
@@ -29,14 +32,36 @@ type aciPuller struct {
 
 	// labels are a set of app container labels.
 	labels map[types.ACIdentifier]string
+
+	// trustStore holds the keys used to verify the image's signature when the
+	// puller isn't insecure.
+	trustStore *trust.Store
+
+	// download configures how the image is downloaded, including the
+	// credentials sent when discovering the image and retrieving it and its
+	// signature.
+	download remotehttp.Options
+
+	// endpoints caches the endpoints discovered for images. It may be nil.
+	endpoints *EndpointCache
 }
 
-// New creates a new aciPuller to fetch an App Container Image.
-func New(insecure bool, labels map[types.ACIdentifier]string) remote.Puller {
-	return &aciPuller{
-		insecure: insecure,
-		labels:   labels,
+// New creates a new aciPuller to fetch an App Container Image. Unless insecure
+// is set, the image's signature is verified against the trust store. The image
+// is downloaded with the download options, which may be nil, and requests to
+// hosts with credentials in their credential store are authenticated.
+// Discovered endpoints are reused from the endpoint cache, when one is given.
+func New(insecure bool, labels map[types.ACIdentifier]string, trustStore *trust.Store, download *remotehttp.Options, endpoints *EndpointCache) remote.Puller {
+	a := &aciPuller{
+		insecure:   insecure,
+		labels:     labels,
+		trustStore: trustStore,
+		endpoints:  endpoints,
 	}
+	if download != nil {
+		a.download = *download
+	}
+	return a
 }
 
 // Pull can be used to retrieve a remote image, and optionally discover
@@ -51,26 +76,103 @@ func (a *aciPuller) Pull(aci string) ([]io.ReadCloser, error) {
 		app.Labels[k] = v
 	}
 
-	insecureOption := discovery.InsecureNone
-	if a.insecure {
-		insecureOption = discovery.InsecureHTTP
+	if !a.insecure && a.trustStore == nil {
+		return nil, fmt.Errorf("no trust store is available to verify the signature of %q", aci)
 	}
 
-	endpoints, _, err := discovery.DiscoverACIEndpoints(*app, nil, insecureOption)
-	if err != nil {
-		return nil, err
+	key := endpointKey(app, a.insecure)
+	endpoints := a.endpoints.get(key)
+	if endpoints == nil {
+		endpoints, _, err = discovery.DiscoverACIEndpoints(*app, a.download.Credentials.Headers(), discovery.InsecureNone)
+		if err != nil && a.insecure {
+			// Discovery sends the same headers over HTTPS and HTTP, so it only
+			// falls back to plain HTTP without the credentials.
+			endpoints, _, err = discovery.DiscoverACIEndpoints(*app, nil, discovery.InsecureHTTP)
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.endpoints.set(key, endpoints)
 	}
 
-	httpPuller := remotehttp.New()
+	httpPuller := remotehttp.New(&a.download)
 
+	var lastErr error
 	for _, ep := range endpoints {
 		readers, err := httpPuller.Pull(ep.ACI)
 		if err != nil {
-			// TODO: log
+			lastErr = err
+			continue
+		}
+		if a.insecure {
+			return readers, nil
+		}
+
+		image, err := a.verify(app.Name.String(), readers, ep.ASC)
+		if err != nil {
+			lastErr = err
 			continue
 		}
-		// TODO: verify signature of downloaded ACI(s).
-		return readers, nil
+		return []io.ReadCloser{image}, nil
+	}
+
+	// the image may have moved, so it is discovered again next time
+	a.endpoints.remove(key)
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to find a valid image for %q: %v", aci, lastErr)
 	}
 	return nil, fmt.Errorf("failed to find a valid image for %q", aci)
 }
+
+// verify checks the downloaded image against the signature at the ASC
+// endpoint, and that the image has the name it was discovered with, since the
+// signature is only checked against keys trusted for that name. The image is
+// buffered to disk so it can be read both to check the signature and to load
+// it.
+func (a *aciPuller) verify(name string, readers []io.ReadCloser, asc string) (io.ReadCloser, error) {
+	for _, r := range readers {
+		defer r.Close()
+	}
+	if len(readers) != 1 {
+		return nil, fmt.Errorf("expected 1 image, got %d", len(readers))
+	}
+
+	image, err := tempfile.New(readers[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkName(image, name); err != nil {
+		image.Close()
+		return nil, err
+	}
+
+	signatures, err := remotehttp.New(&remotehttp.Options{Credentials: a.download.Credentials}).Pull(asc)
+	if err != nil {
+		image.Close()
+		return nil, fmt.Errorf("failed to retrieve the signature: %v", err)
+	}
+	defer signatures[0].Close()
+
+	if _, err := a.trustStore.Verify(name, image, signatures[0]); err != nil {
+		image.Close()
+		return nil, err
+	}
+	if _, err := image.Seek(0, 0); err != nil {
+		image.Close()
+		return nil, err
+	}
+	return image, nil
+}
+
+// checkName ensures the image's manifest has the name, and rewinds the image.
+func checkName(image io.ReadSeeker, name string) error {
+	manifest, err := appcaci.ManifestFromImage(image)
+	if err != nil {
+		return fmt.Errorf("failed to read the image manifest: %v", err)
+	}
+	if manifest.Name.String() != name {
+		return fmt.Errorf("image is named %q, expected %q", manifest.Name, name)
+	}
+	_, err = image.Seek(0, 0)
+	return err
+}
@@ -3,18 +3,26 @@
 package aci
 
 import (
+	"archive/tar"
+	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/remote"
 	"github.com/apcera/kurma/pkg/remote/aci/server"
+	"github.com/appc/spec/discovery"
 	"github.com/appc/spec/schema/types"
 
+	remotehttp "github.com/apcera/kurma/pkg/remote/http"
 	tt "github.com/apcera/util/testtool"
 )
 
@@ -32,7 +40,7 @@ func TestACIPull_ImageNotFound(t *testing.T) {
 func TestACIPull_InsecureHTTPDiscover(t *testing.T) {
 	img := "etcd"
 
-	server, imageName := bootstrapACIServerWithImage(t, img, true)
+	server, imageName := bootstrapACIServerWithImage(t, img, true, server.AuthNone)
 	defer server.Close()
 
 	puller := buildACIPuller(true)
@@ -54,7 +62,7 @@ func TestACIPull_InsecureHTTPDiscover(t *testing.T) {
 func TestACIPull_SecureHTTPSDiscover(t *testing.T) {
 	img := "etcd"
 
-	server, imageName := bootstrapACIServerWithImage(t, img, false)
+	server, imageName := bootstrapACIServerWithImage(t, img, false, server.AuthNone)
 	defer server.Close()
 
 	puller := buildACIPuller(true)
@@ -65,15 +73,92 @@ func TestACIPull_SecureHTTPSDiscover(t *testing.T) {
 	}
 }
 
+func TestACIPull_Credentials(t *testing.T) {
+	tests := []struct {
+		auth       server.AuthType
+		credential *credentials.Credential
+	}{
+		{server.AuthBasic, &credentials.Credential{Host: "localhost", Username: "bar", Password: "baz"}},
+		{server.AuthOauth, &credentials.Credential{Host: "localhost", Token: "sometoken"}},
+	}
+	for _, test := range tests {
+		creds, err := credentials.New("")
+		tt.TestExpectSuccess(t, err)
+		tt.TestExpectSuccess(t, creds.Add(test.credential))
+
+		// the server's endpoints are on its address rather than its name
+		endpoint := *test.credential
+		endpoint.Host = "127.0.0.1"
+		tt.TestExpectSuccess(t, creds.Add(&endpoint))
+
+		// credentials are never sent over plain HTTP, so the pull is rejected
+		server, imageName := bootstrapACIServerWithImage(t, "etcd", true, test.auth)
+		_, err = buildACIPullerWithCredentials(true, creds).Pull(imageName)
+		tt.TestExpectError(t, err)
+		server.Close()
+
+		server, imageName = bootstrapACIServerWithImage(t, "etcd", false, test.auth)
+		restore := trustTestServers()
+
+		// anonymous pulls are rejected
+		_, err = buildACIPuller(true).Pull(imageName)
+		tt.TestExpectError(t, err)
+
+		acis, err := buildACIPullerWithCredentials(true, creds).Pull(imageName)
+		tt.TestExpectSuccess(t, err)
+		tt.TestEqual(t, len(acis), 1)
+		acis[0].Close()
+
+		restore()
+		server.Close()
+	}
+}
+
+// trustTestServers has discovery and downloads skip verifying the test
+// server's certificate. It returns a function restoring the original clients.
+func trustTestServers() func() {
+	transport := discovery.Client.Transport
+	client := remotehttp.Client
+	discovery.Client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	remotehttp.Client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	return func() {
+		discovery.Client.Transport = transport
+		remotehttp.Client = client
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	manifest := []byte(`{"acKind":"ImageManifest","acVersion":"0.7.4","name":"example.com/app"}`)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tt.TestExpectSuccess(t, tw.WriteHeader(&tar.Header{Name: "manifest", Mode: 0644, Size: int64(len(manifest))}))
+	_, err := tw.Write(manifest)
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, tw.Close())
+	image := bytes.NewReader(buf.Bytes())
+
+	// the image must have the name its signature was checked for
+	tt.TestExpectSuccess(t, checkName(image, "example.com/app"))
+	tt.TestEqual(t, image.Len(), buf.Len())
+	tt.TestExpectError(t, checkName(image, "example.com/other"))
+}
+
 func buildACIPuller(insecure bool) remote.Puller {
+	return buildACIPullerWithCredentials(insecure, nil)
+}
+
+func buildACIPullerWithCredentials(insecure bool, creds *credentials.Store) remote.Puller {
 	labels := make(map[types.ACIdentifier]string)
 	labels[types.ACIdentifier("os")] = runtime.GOOS
 	labels[types.ACIdentifier("arch")] = runtime.GOARCH
 
-	return New(insecure, labels)
+	return New(insecure, labels, nil, &remotehttp.Options{Credentials: creds}, nil)
 }
 
-func bootstrapACIServerWithImage(t *testing.T, img string, insecure bool) (*server.Server, string) {
+func bootstrapACIServerWithImage(t *testing.T, img string, insecure bool, auth server.AuthType) (*server.Server, string) {
 	// Binding ports like 80, 443 requires root.
 	tt.TestRequiresRoot(t)
 
@@ -81,6 +166,7 @@ func bootstrapACIServerWithImage(t *testing.T, img string, insecure bool) (*serv
 	if insecure {
 		setup.Protocol = server.ProtocolHttp
 	}
+	setup.Auth = auth
 	server := server.NewServer(setup)
 
 	if testing.Verbose() {
@@ -142,3 +228,32 @@ func logMessages(t *testing.T, server *server.Server) {
 		}
 	}
 }
+
+func TestEndpointCache(t *testing.T) {
+	now := time.Now()
+	cache := NewEndpointCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	app, err := discovery.NewAppFromString("example.com/app:1.0,os=linux,arch=amd64")
+	tt.TestExpectSuccess(t, err)
+	key := endpointKey(app, false)
+	tt.TestEqual(t, key, endpointKey(app.Copy(), false))
+	tt.TestNotEqual(t, key, endpointKey(app, true))
+
+	endpoints := discovery.ACIEndpoints{{ACI: "https://example.com/app.aci", ASC: "https://example.com/app.aci.asc"}}
+	cache.set(key, endpoints)
+	tt.TestEqual(t, cache.get(key), endpoints)
+
+	// entries expire after the ttl
+	now = now.Add(time.Minute)
+	tt.TestEqual(t, len(cache.get(key)), 0)
+
+	cache.set(key, endpoints)
+	cache.remove(key)
+	tt.TestEqual(t, len(cache.get(key)), 0)
+
+	// a nil cache holds nothing
+	cache = nil
+	cache.set(key, endpoints)
+	tt.TestEqual(t, len(cache.get(key)), 0)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/remote"
 
 	"github.com/apcera/util/docker"
@@ -32,14 +33,21 @@ type dockerPuller struct {
 	// squashLayers, if true, will squash together all of the layers of the
 	// Docker image into a single tarball.
 	squashLayers bool
+
+	// credentials holds the usernames and passwords used to authenticate with
+	// registries.
+	credentials *credentials.Store
 }
 
-// New creates a new dockerPuller to pull a remote Docker image.
-func New(insecure bool) remote.Puller {
+// New creates a new dockerPuller to pull a remote Docker image. Registries
+// with a username and password in the credential store are authenticated
+// with them.
+func New(insecure bool, creds *credentials.Store) remote.Puller {
 	puller := &dockerPuller{
 		insecure:     insecure,
 		convertToACI: true, // FIXME: should we support pull without conversion?
 		squashLayers: true,
+		credentials:  creds,
 	}
 	return puller
 }
@@ -72,6 +80,14 @@ func (d *dockerPuller) Pull(dockerImageURI string) ([]io.ReadCloser, error) {
 		},
 		Insecure: d.insecure,
 	}
+	host := dockerURL.HostPort()
+	if host == "" {
+		host = credentials.DockerHub
+	}
+	if c := d.credentials.Get(host); c != nil {
+		config.Username = c.Username
+		config.Password = c.Password
+	}
 
 	if d.convertToACI {
 		return d.pullAsACI(schemelessURL, config)
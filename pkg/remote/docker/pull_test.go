@@ -18,7 +18,7 @@ func init() {
 }
 
 func TestDockerPull_ImageNotFound(t *testing.T) {
-	puller := New(true)
+	puller := New(true, nil)
 
 	imageURI := "docker://fake"
 
@@ -29,7 +29,7 @@ func TestDockerPull_ImageNotFound(t *testing.T) {
 }
 
 func TestDockerPull(t *testing.T) {
-	puller := New(true)
+	puller := New(true, nil)
 
 	imageURI := fmt.Sprintf("%s/library/nats:latest", dockerRegistryURL)
 	u, err := url.Parse(imageURI)
@@ -48,7 +48,7 @@ func TestDockerPull(t *testing.T) {
 }
 
 func TestDockerPull_NoSquash(t *testing.T) {
-	puller := New(true)
+	puller := New(true, nil)
 
 	dockerImgPuller, ok := puller.(*dockerPuller)
 	if !ok {
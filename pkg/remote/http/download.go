@@ -0,0 +1,316 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apcera/kurma/pkg/remote"
+)
+
+var (
+	// activeDownloads holds the partial files being downloaded into, so
+	// concurrent pulls of the same image don't write to the same file.
+	activeDownloads = make(map[string]bool)
+	activeLock      sync.Mutex
+)
+
+// A download retrieves an image into a partial file. When it is interrupted,
+// it is resumed with a range request.
+type download struct {
+	client *client
+	uri    string
+
+	// path is the partial file the image is downloaded into.
+	path string
+
+	// state describes the partial file, and is saved alongside it.
+	state downloadState
+
+	// active is whether the path is registered in activeDownloads.
+	active bool
+
+	// tempDir is the temporary directory the image is downloaded into when
+	// partial downloads aren't kept, which is removed once the pull is done.
+	tempDir string
+}
+
+// downloadState is saved alongside a partial download. The partial download
+// is only resumed if the image still has the same validator.
+type downloadState struct {
+	URI string `json:"uri"`
+
+	// Validator is the image's strong ETag or its last modification time,
+	// which are sent in the If-Range header.
+	Validator string `json:"validator,omitempty"`
+
+	// Total is the size of the image, or -1 if it isn't known.
+	Total int64 `json:"total"`
+}
+
+// retryableError is an error which interrupted a download, which may succeed
+// if it is retried.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// newDownload prepares the download of the image. Partial downloads are kept
+// in the options' directory, named by the hash of the image's URI.
+func (c *client) newDownload(uri string) (*download, error) {
+	d := &download{
+		client: c,
+		uri:    uri,
+		state:  downloadState{URI: uri, Total: -1},
+	}
+
+	if dir := c.options.Directory; dir != "" {
+		if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+			return nil, fmt.Errorf("failed to create the download directory: %v", err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(uri))))
+
+		activeLock.Lock()
+		if !activeDownloads[path] {
+			activeDownloads[path] = true
+			d.path, d.active = path, true
+		}
+		activeLock.Unlock()
+	}
+
+	// the image is downloaded into a temporary directory if partial downloads
+	// aren't kept, or if the image is already being downloaded
+	if d.path == "" {
+		dir, err := ioutil.TempDir("", "kurma-download")
+		if err != nil {
+			return nil, err
+		}
+		d.tempDir = dir
+		d.path = filepath.Join(dir, "image")
+		return d, nil
+	}
+
+	d.loadState()
+	return d, nil
+}
+
+// loadState reads the state of an existing partial download. Partial
+// downloads which can't be validated are started over.
+func (d *download) loadState() {
+	var state downloadState
+	b, err := ioutil.ReadFile(d.path + ".json")
+	if err == nil && json.Unmarshal(b, &state) == nil && state.URI == d.uri && state.Validator != "" {
+		d.state = state
+		return
+	}
+	d.discard()
+}
+
+func (d *download) saveState() error {
+	b, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(d.path+".json", b, os.FileMode(0600))
+}
+
+// fetch downloads the image, or the remainder of it if it was partially
+// downloaded. Errors which may be resolved by retrying are returned as a
+// retryableError.
+func (d *download) fetch() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, os.FileMode(0600))
+	if err != nil {
+		return fmt.Errorf("failed to create the download file: %v", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := fi.Size()
+	if offset > 0 && d.state.Validator == "" {
+		// the image may have changed, so it can't safely be resumed
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+
+	req, err := http.NewRequest("GET", d.uri, nil)
+	if err != nil {
+		return err
+	}
+	d.client.options.Credentials.Authorize(req)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", d.state.Validator)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return d.restart(f, fmt.Errorf("invalid Content-Range %q resuming %q", resp.Header.Get("Content-Range"), d.uri))
+		}
+		d.state.Total = total
+
+	case resp.StatusCode == http.StatusOK:
+		// the whole image is sent when the download can't be resumed
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+		d.state.Total = resp.ContentLength
+		d.state.Validator = validator(resp)
+		if err := d.saveState(); err != nil {
+			return err
+		}
+
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if offset == d.state.Total {
+			return nil
+		}
+		return d.restart(f, fmt.Errorf("the partial download of %q is invalid", d.uri))
+
+	default:
+		err := fmt.Errorf("HTTP %d on retrieving %q", resp.StatusCode, d.uri)
+		switch resp.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return &retryableError{err}
+		}
+		if resp.StatusCode >= 500 {
+			return &retryableError{err}
+		}
+		return err
+	}
+
+	w := &progressWriter{w: f, download: d, downloaded: offset}
+	w.report()
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return &retryableError{fmt.Errorf("failed to download %q: %v", d.uri, err)}
+	}
+	if d.state.Total >= 0 && offset+n != d.state.Total {
+		return &retryableError{fmt.Errorf("failed to download %q: %v", d.uri, io.ErrUnexpectedEOF)}
+	}
+	return nil
+}
+
+// restart throws away the partial download, so it is started over when it is
+// retried.
+func (d *download) restart(f *os.File, err error) error {
+	if terr := f.Truncate(0); terr != nil {
+		return terr
+	}
+	d.state = downloadState{URI: d.uri, Total: -1}
+	os.Remove(d.path + ".json")
+	return &retryableError{err}
+}
+
+// open returns the downloaded image. The download's files are removed, and
+// the image remains readable until it is closed.
+func (d *download) open() (*os.File, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return nil, err
+	}
+	d.discard()
+	return f, nil
+}
+
+// discard removes the partial download.
+func (d *download) discard() {
+	os.Remove(d.path)
+	os.Remove(d.path + ".json")
+}
+
+// close releases the download's partial file, so it may be resumed by another
+// pull.
+func (d *download) close() {
+	if d.active {
+		activeLock.Lock()
+		delete(activeDownloads, d.path)
+		activeLock.Unlock()
+	}
+	if d.tempDir != "" {
+		os.RemoveAll(d.tempDir)
+	}
+}
+
+// validator returns the value sent in the If-Range header when resuming the
+// download of the response's content. Weak ETags can't be used to resume.
+func validator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange returns the first byte and the total size from a
+// "bytes first-last/total" Content-Range header. The total is -1 when it is
+// unknown.
+func parseContentRange(s string) (int64, int64, error) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	first, err := strconv.ParseInt(strings.SplitN(parts[0], "-", 2)[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	if parts[1] == "*" {
+		return first, -1, nil
+	}
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+	}
+	return first, total, nil
+}
+
+// progressWriter reports the progress of a download as it is written.
+type progressWriter struct {
+	w          io.Writer
+	download   *download
+	downloaded int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.downloaded += int64(n)
+	p.report()
+	return n, err
+}
+
+func (p *progressWriter) report() {
+	if progress := p.download.client.options.Progress; progress != nil {
+		progress(remote.Progress{
+			URI:        p.download.uri,
+			Downloaded: p.downloaded,
+			Total:      p.download.state.Total,
+		})
+	}
+}
@@ -3,13 +3,20 @@
 package http
 
 import (
-	"fmt"
 	"io"
 	"net/http"
+	"time"
 
+	"github.com/apcera/kurma/pkg/credentials"
 	"github.com/apcera/kurma/pkg/remote"
 )
 
+const (
+	// DefaultRetries is the number of times an interrupted download is retried
+	// when the options don't specify otherwise.
+	DefaultRetries = 5
+)
+
 var (
 	// Client is the http.Client that is used by Pull to download images
 	// TODO: this is only exported/global to support setting a Proxy on the
@@ -17,33 +24,88 @@ var (
 	Client *http.Client = &http.Client{
 		Transport: &http.Transport{},
 	}
+
+	// retryDelay is how long to wait before retrying a failed download. It is
+	// doubled with each retry, up to maxRetryDelay.
+	retryDelay    = time.Second
+	maxRetryDelay = 30 * time.Second
 )
 
+// Options configures how images are downloaded. The zero value downloads
+// anonymously, with the default number of retries.
+type Options struct {
+	// Credentials holds the credentials sent to the hosts images are
+	// downloaded from. It may be nil.
+	Credentials *credentials.Store
+
+	// Directory holds partially downloaded images, so a download which fails
+	// is resumed the next time the image is pulled. When it is empty, partial
+	// downloads are only resumed while retrying.
+	Directory string
+
+	// Retries is the number of times an interrupted download is resumed before
+	// giving up. DefaultRetries is used when it is zero, and a negative value
+	// disables retries.
+	Retries int
+
+	// Progress is called as images are downloaded. It may be nil.
+	Progress remote.ProgressFunc
+}
+
 // A client represents a client for pulling remote images over HTTP.
 type client struct {
 	*http.Client
+	options Options
 }
 
-// New creates a new HTTP image pull client.
-func New() remote.Puller {
-	return &client{
+// New creates a new HTTP image pull client. Downloads which are interrupted
+// are retried with backoff, resuming from where they left off when the server
+// supports range requests. The options may be nil.
+func New(options *Options) remote.Puller {
+	c := &client{
 		Client: Client,
 	}
+	if options != nil {
+		c.options = *options
+	}
+	if c.options.Retries == 0 {
+		c.options.Retries = DefaultRetries
+	}
+	return c
 }
 
 // Pull fetches a remote image. Callers should close the ReadCloser after
 // reading.
 func (c *client) Pull(imageURI string) ([]io.ReadCloser, error) {
-	resp, err := c.Client.Get(imageURI)
+	d, err := c.newDownload(imageURI)
 	if err != nil {
 		return nil, err
 	}
+	defer d.close()
+
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := d.fetch()
+		if err == nil {
+			break
+		}
+		if _, ok := err.(*retryableError); !ok {
+			d.discard()
+			return nil, err
+		}
+		if attempt >= c.options.Retries {
+			return nil, err
+		}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-	default:
-		return nil, fmt.Errorf("HTTP %d on retrieving %q", resp.StatusCode, imageURI)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
 	}
 
-	return []io.ReadCloser{resp.Body}, nil
+	f, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	return []io.ReadCloser{f}, nil
 }
@@ -0,0 +1,185 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/remote"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func init() {
+	retryDelay = time.Millisecond
+}
+
+// flakyServer serves an image with range support, cutting off the first
+// responses partway through the image.
+type flakyServer struct {
+	*httptest.Server
+	image []byte
+	etag  string
+
+	// failures is the number of responses to cut off.
+	failures int
+
+	// ranges are the Range headers of each request.
+	ranges []string
+
+	// authorizations are the Authorization headers of each request.
+	authorizations []string
+	lock           sync.Mutex
+}
+
+func newFlakyServer(image []byte, failures int) *flakyServer {
+	s := &flakyServer{image: image, etag: `"v1"`, failures: failures}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	s.ranges = append(s.ranges, req.Header.Get("Range"))
+	s.authorizations = append(s.authorizations, req.Header.Get("Authorization"))
+	fail := s.failures > 0
+	s.failures--
+	s.lock.Unlock()
+
+	if req.URL.Path != "/image.aci" {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	if !fail {
+		http.ServeContent(w, req, "image.aci", time.Time{}, bytes.NewReader(s.image))
+		return
+	}
+
+	// send a third of the image, then drop the connection
+	w.Header().Set("Content-Length", strconv.Itoa(len(s.image)))
+	w.Write(s.image[:len(s.image)/3])
+	if hj, ok := w.(http.Hijacker); ok {
+		conn, _, _ := hj.Hijack()
+		conn.Close()
+	}
+}
+
+func testImage() []byte {
+	return bytes.Repeat([]byte("kurma image "), 10000)
+}
+
+func pullImage(t *testing.T, puller remote.Puller, uri string) []byte {
+	readers, err := puller.Pull(uri)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(readers), 1)
+	defer readers[0].Close()
+	b, err := ioutil.ReadAll(readers[0])
+	tt.TestExpectSuccess(t, err)
+	return b
+}
+
+func TestPullRetriesAndResumes(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	image := testImage()
+	server := newFlakyServer(image, 2)
+	defer server.Close()
+
+	var progress []remote.Progress
+	puller := New(&Options{Progress: func(p remote.Progress) { progress = append(progress, p) }})
+	tt.TestEqual(t, pullImage(t, puller, server.URL+"/image.aci"), image)
+
+	// each retry resumes from what was downloaded before
+	offset := strconv.Itoa(len(image) / 3)
+	tt.TestEqual(t, server.ranges, []string{"", "bytes=" + offset + "-", "bytes=" + offset + "-"})
+
+	last := progress[len(progress)-1]
+	tt.TestEqual(t, last.Downloaded, int64(len(image)))
+	tt.TestEqual(t, last.Total, int64(len(image)))
+}
+
+func TestPullResumesFromDirectory(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	image := testImage()
+	server := newFlakyServer(image, 1)
+	defer server.Close()
+	uri := server.URL + "/image.aci"
+	dir := tt.TempDir(t)
+
+	// without retries, the interrupted download is left in the directory
+	_, err := New(&Options{Directory: dir, Retries: -1}).Pull(uri)
+	tt.TestExpectError(t, err)
+	files, err := ioutil.ReadDir(dir)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(files), 2)
+
+	tt.TestEqual(t, pullImage(t, New(&Options{Directory: dir}), uri), image)
+	tt.TestEqual(t, server.ranges[1], "bytes="+strconv.Itoa(len(image)/3)+"-")
+
+	// the partial download is removed once it completes
+	files, err = ioutil.ReadDir(dir)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(files), 0)
+}
+
+func TestPullRestartsChangedImage(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	server := newFlakyServer(testImage(), 1)
+	defer server.Close()
+	uri := server.URL + "/image.aci"
+	dir := tt.TempDir(t)
+
+	_, err := New(&Options{Directory: dir, Retries: -1}).Pull(uri)
+	tt.TestExpectError(t, err)
+
+	// the image changed, so the server sends all of the new image
+	server.image = bytes.Repeat([]byte("updated image "), 5000)
+	server.etag = `"v2"`
+	tt.TestEqual(t, pullImage(t, New(&Options{Directory: dir}), uri), server.image)
+}
+
+func TestPullNotFound(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	server := newFlakyServer(testImage(), 0)
+	defer server.Close()
+
+	// missing images aren't retried
+	_, err := New(nil).Pull(server.URL + "/missing.aci")
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, len(server.ranges), 1)
+}
+
+func TestPullPlainHTTPCredentials(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	image := testImage()
+	server := newFlakyServer(image, 0)
+	defer server.Close()
+
+	// credentials for the host match on any port, but must not be sent over
+	// plain HTTP
+	store, err := credentials.New("")
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, store.Add(&credentials.Credential{Host: "127.0.0.1", Token: "secret"}))
+
+	puller := New(&Options{Credentials: store})
+	tt.TestEqual(t, pullImage(t, puller, server.URL+"/image.aci"), image)
+	tt.TestEqual(t, server.authorizations, []string{""})
+}
@@ -0,0 +1,543 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+)
+
+const (
+	// layerNamePrefix prefixes the chain ID of a layer to form the name of its
+	// ACI. Naming layers by chain ID, which covers the layer and every layer
+	// beneath it, lets images which share base layers share their ACIs.
+	layerNamePrefix = "oci-layer/"
+
+	// opaqueNameSuffix is appended to the name of a layer's ACI to form the
+	// name of the ACI hiding the layer's opaque directories.
+	opaqueNameSuffix = "/opaque"
+
+	// whiteoutPrefix prefixes the names of files which hide the files with the
+	// rest of the name in lower layers.
+	whiteoutPrefix = ".wh."
+
+	// whiteoutMetaPrefix prefixes the names of files with special meanings,
+	// rather than files which are hidden.
+	whiteoutMetaPrefix = ".wh..wh."
+
+	// opaqueWhiteout marks the directory containing it as opaque, hiding its
+	// contents in lower layers.
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+var (
+	// archLabels maps image architectures to the ACI arch label.
+	archLabels = map[string]string{
+		"amd64": "amd64",
+		"386":   "i386",
+		"arm64": "aarch64",
+		"arm":   "armv7l",
+	}
+
+	// aciModTime is the modification time given to generated files, so the
+	// same image always converts to the same ACI.
+	aciModTime = time.Unix(0, 0)
+)
+
+// converter generates the ACIs for an image's layers.
+type converter struct {
+	source  source
+	images  ImageFinder
+	config  *imageConfig
+	layers  []descriptor
+	diffIDs []string
+}
+
+// convert returns the ACI for the image, followed by the ACIs of the layers
+// which are not yet available, from the top down. Each layer's ACI depends on
+// the layer beneath it, through the ACI hiding the layer's opaque directories
+// if it has any, and the image's depends on the top layer.
+func (c *converter) convert() ([]io.ReadCloser, error) {
+	var layers []io.ReadCloser
+	successful := false
+	defer func() {
+		if !successful {
+			for _, l := range layers {
+				l.Close()
+			}
+		}
+	}()
+
+	var parent *types.Dependency
+	var chainID string
+	for i, layer := range c.layers {
+		diffID := c.diffIDs[i]
+		if chainID == "" {
+			chainID = diffID
+		} else {
+			chainID = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(chainID+" "+diffID)))
+		}
+		name := layerNamePrefix + strings.Replace(chainID, ":", "-", 1)
+
+		var hash string
+		if c.images != nil {
+			hash, _ = c.images.FindImage(name, "")
+		}
+		if hash == "" {
+			acis, h, err := c.convertLayer(name, layer, diffID, parent)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range acis {
+				layers = append(layers, f)
+			}
+			hash = h
+		}
+
+		var err error
+		if parent, err = newDependency(name, hash); err != nil {
+			return nil, err
+		}
+	}
+
+	top, _, err := c.convertImage(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	acis := []io.ReadCloser{top}
+	for i := len(layers) - 1; i >= 0; i-- {
+		acis = append(acis, layers[i])
+	}
+	successful = true
+	return acis, nil
+}
+
+// convertLayer generates the ACIs for a layer, verifying the layer's content
+// against its digest and diff ID. The ACIs are returned from the bottom up,
+// along with the hash of the layer's own ACI.
+//
+// Whiteout files are converted to the format used by overlay, which the stager
+// prefers: each becomes a character device with the device number 0/0.
+// Overlay marks opaque directories with an extended attribute, which isn't kept
+// when ACIs are extracted, so they are instead hidden by whiteouts in an ACI
+// beneath the layer's, leaving the layer's directories in their place.
+func (c *converter) convertLayer(name string, layer descriptor, diffID string, parent *types.Dependency) ([]*os.File, string, error) {
+	r, err := c.source.blob(layer.Digest)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	// layers may be gzipped or plain tarballs
+	br := bufio.NewReader(r)
+	var lr io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decompress layer %s: %v", layer.Digest, err)
+		}
+		defer gz.Close()
+		lr = gz
+	}
+
+	// the layer is buffered so its opaque directories are known before its
+	// ACI's manifest is written
+	buf, err := ioutil.TempFile("", "oci-layer")
+	if err != nil {
+		return nil, "", err
+	}
+	os.Remove(buf.Name())
+	defer buf.Close()
+
+	diff := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(buf, diff), lr); err == nil {
+		// read the remainder of the layer so its digest covers all of it
+		_, err = io.Copy(ioutil.Discard, br)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to retrieve layer %s: %v", layer.Digest, err)
+	}
+	if digest := fmt.Sprintf("sha256:%x", diff.Sum(nil)); digest != diffID {
+		return nil, "", fmt.Errorf("layer %s has diff ID %s, expected %s", layer.Digest, digest, diffID)
+	}
+
+	if _, err := buf.Seek(0, 0); err != nil {
+		return nil, "", err
+	}
+	opaque, err := opaqueDirs(tar.NewReader(buf))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to convert layer %s: %v", layer.Digest, err)
+	}
+
+	var acis []*os.File
+	if len(opaque) > 0 {
+		opaqueName := name + opaqueNameSuffix
+		f, hash, err := convertOpaqueDirs(opaqueName, opaque, parent)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to convert layer %s: %v", layer.Digest, err)
+		}
+		acis = append(acis, f)
+		if parent, err = newDependency(opaqueName, hash); err != nil {
+			f.Close()
+			return nil, "", err
+		}
+	}
+
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	if parent != nil {
+		manifest.Dependencies = types.Dependencies{*parent}
+	}
+
+	f, hash, err := func() (*os.File, string, error) {
+		if _, err := buf.Seek(0, 0); err != nil {
+			return nil, "", err
+		}
+		w, err := newACIWriter(manifest)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := copyLayer(w.Writer, tar.NewReader(buf)); err != nil {
+			w.abort()
+			return nil, "", fmt.Errorf("failed to convert layer %s: %v", layer.Digest, err)
+		}
+		return w.finish()
+	}()
+	if err != nil {
+		for _, f := range acis {
+			f.Close()
+		}
+		return nil, "", err
+	}
+	return append(acis, f), hash, nil
+}
+
+// copyLayer copies the files in the layer beneath the ACI's rootfs, converting
+// whiteout files to character devices. Opaque directory markers are dropped.
+func copyLayer(tw *tar.Writer, tr *tar.Reader) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := cleanName(hdr.Name)
+		if name == "" {
+			continue
+		}
+
+		base := path.Base(name)
+		if strings.HasPrefix(base, whiteoutMetaPrefix) {
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			hdr = &tar.Header{
+				Name:     path.Join("rootfs", path.Dir(name), strings.TrimPrefix(base, whiteoutPrefix)),
+				ModTime:  hdr.ModTime,
+				Typeflag: tar.TypeChar,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		hdr.Name = path.Join("rootfs", name)
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = path.Join("rootfs", cleanName(hdr.Linkname))
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// opaqueDir is a directory whose contents in lower layers are hidden, along
+// with the layer's headers for the directories containing it.
+type opaqueDir struct {
+	name    string
+	parents []*tar.Header
+}
+
+// opaqueDirs returns the layer's opaque directories. Directories within
+// another opaque directory are left out, since they are already hidden.
+func opaqueDirs(tr *tar.Reader) ([]*opaqueDir, error) {
+	dirs := make(map[string]*tar.Header)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := cleanName(hdr.Name)
+		switch {
+		case name == "":
+		case hdr.Typeflag == tar.TypeDir:
+			dirs[name] = hdr
+		case path.Base(name) == opaqueWhiteout && path.Dir(name) != ".":
+			names = append(names, path.Dir(name))
+		}
+	}
+
+	sort.Strings(names)
+	var opaque []*opaqueDir
+	for _, name := range names {
+		if len(opaque) > 0 {
+			last := opaque[len(opaque)-1].name
+			if name == last || strings.HasPrefix(name, last+"/") {
+				continue
+			}
+		}
+
+		dir := &opaqueDir{name: name}
+		for p := path.Dir(name); p != "."; p = path.Dir(p) {
+			h := tar.Header{Mode: 0755, ModTime: aciModTime}
+			if hdr := dirs[p]; hdr != nil {
+				h = *hdr
+			}
+			h.Name = path.Join("rootfs", p) + "/"
+			h.Typeflag = tar.TypeDir
+			dir.parents = append([]*tar.Header{&h}, dir.parents...)
+		}
+		opaque = append(opaque, dir)
+	}
+	return opaque, nil
+}
+
+// convertOpaqueDirs generates the ACI holding whiteouts for a layer's opaque
+// directories. The directories the whiteouts are in keep the attributes they
+// have in the layer.
+func convertOpaqueDirs(name string, opaque []*opaqueDir, parent *types.Dependency) (*os.File, string, error) {
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	if parent != nil {
+		manifest.Dependencies = types.Dependencies{*parent}
+	}
+
+	w, err := newACIWriter(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	written := make(map[string]bool)
+	for _, dir := range opaque {
+		for _, hdr := range dir.parents {
+			if written[hdr.Name] {
+				continue
+			}
+			written[hdr.Name] = true
+			if err := w.WriteHeader(hdr); err != nil {
+				w.abort()
+				return nil, "", err
+			}
+		}
+		hdr := &tar.Header{Name: path.Join("rootfs", dir.name), ModTime: aciModTime, Typeflag: tar.TypeChar}
+		if err := w.WriteHeader(hdr); err != nil {
+			w.abort()
+			return nil, "", err
+		}
+	}
+	return w.finish()
+}
+
+// cleanName returns the path of a file within a layer relative to its root.
+// Paths are cleaned as though they were absolute, so they can't escape it.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// convertImage generates the ACI for the image itself, which has no files of
+// its own and runs the image's configured command.
+func (c *converter) convertImage(parent *types.Dependency) (*os.File, string, error) {
+	name, err := types.SanitizeACIdentifier(c.source.name())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate the image name: %v", err)
+	}
+
+	manifest := schema.BlankImageManifest()
+	manifest.Name = types.ACIdentifier(name)
+	if ref := c.source.reference(); ref != "" {
+		manifest.Labels = append(manifest.Labels, types.Label{Name: "version", Value: ref})
+	}
+	if c.config.OS == "linux" {
+		manifest.Labels = append(manifest.Labels, types.Label{Name: "os", Value: c.config.OS})
+		if arch, ok := archLabels[c.config.Architecture]; ok {
+			manifest.Labels = append(manifest.Labels, types.Label{Name: "arch", Value: arch})
+		}
+	}
+	if parent != nil {
+		manifest.Dependencies = types.Dependencies{*parent}
+	}
+	if manifest.App, err = c.app(); err != nil {
+		return nil, "", err
+	}
+
+	w, err := newACIWriter(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	return w.finish()
+}
+
+// app generates the ACI app from the image's config. Images without a command
+// have no app.
+func (c *converter) app() (*types.App, error) {
+	config := c.config.Config
+	exec := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(exec) == 0 {
+		return nil, nil
+	}
+
+	app := &types.App{
+		Exec:             types.Exec(exec),
+		User:             "0",
+		Group:            "0",
+		WorkingDirectory: config.WorkingDir,
+	}
+	if config.User != "" {
+		parts := strings.SplitN(config.User, ":", 2)
+		app.User = parts[0]
+		if len(parts) == 2 {
+			app.Group = parts[1]
+		}
+	}
+
+	for _, env := range config.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		app.Environment.Set(parts[0], parts[1])
+	}
+
+	for exposed := range config.ExposedPorts {
+		parts := strings.SplitN(exposed, "/", 2)
+		port, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exposed port %q", exposed)
+		}
+		protocol := "tcp"
+		if len(parts) == 2 {
+			protocol = parts[1]
+		}
+		name, err := types.SanitizeACName(fmt.Sprintf("%d-%s", port, protocol))
+		if err != nil {
+			return nil, err
+		}
+		app.Ports = append(app.Ports, types.Port{
+			Name:     types.ACName(name),
+			Protocol: protocol,
+			Port:     uint(port),
+		})
+	}
+	sort.Sort(portsByName(app.Ports))
+	return app, nil
+}
+
+// portsByName sorts ports by name, so the generated manifest doesn't depend
+// on map ordering.
+type portsByName []types.Port
+
+func (p portsByName) Len() int           { return len(p) }
+func (p portsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p portsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func newDependency(name, hash string) (*types.Dependency, error) {
+	id, err := types.NewHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Dependency{ImageName: types.ACIdentifier(name), ImageID: id}, nil
+}
+
+// aciWriter writes an ACI to an unlinked temporary file, hashing it as it is
+// written so its image ID is known once it is finished.
+type aciWriter struct {
+	*tar.Writer
+	f *os.File
+	h hash.Hash
+}
+
+// newACIWriter creates the ACI and writes its manifest and rootfs directory.
+func newACIWriter(manifest *schema.ImageManifest) (*aciWriter, error) {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize the image manifest: %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "oci-layer")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+
+	w := &aciWriter{f: f, h: sha512.New()}
+	w.Writer = tar.NewWriter(io.MultiWriter(f, w.h))
+
+	hdr := &tar.Header{
+		Name:     "manifest",
+		Mode:     0644,
+		Size:     int64(len(b)),
+		ModTime:  aciModTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := w.WriteHeader(hdr); err == nil {
+		_, err = w.Write(b)
+	}
+	if err == nil {
+		err = w.WriteHeader(&tar.Header{Name: "rootfs/", Mode: 0755, ModTime: aciModTime, Typeflag: tar.TypeDir})
+	}
+	if err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+// finish completes the ACI and returns it, rewound, along with its hash.
+func (w *aciWriter) finish() (*os.File, string, error) {
+	if err := w.Close(); err != nil {
+		w.abort()
+		return nil, "", err
+	}
+	if _, err := w.f.Seek(0, 0); err != nil {
+		w.abort()
+		return nil, "", err
+	}
+	return w.f, fmt.Sprintf("sha512-%x", w.h.Sum(nil)), nil
+}
+
+func (w *aciWriter) abort() {
+	w.f.Close()
+}
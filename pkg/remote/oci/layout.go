@@ -0,0 +1,117 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// refNameAnnotation is the annotation naming a manifest within an image
+	// layout's index.
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// layout retrieves an image from an OCI image layout directory.
+type layout struct {
+	dir string
+	ref string
+}
+
+// newLayout parses an "oci:PATH[:REF]" URI. The reference may be omitted if
+// the layout contains a single image.
+func newLayout(uri string) (*layout, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(uri, "oci:"), "//")
+	l := &layout{dir: s}
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		l.dir, l.ref = s[:i], s[i+1:]
+	}
+	if l.dir == "" {
+		return nil, fmt.Errorf("invalid OCI image layout %q", uri)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(l.dir, "oci-layout"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OCI image layout: %v", err)
+	}
+	var version struct {
+		ImageLayoutVersion string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(b, &version); err != nil {
+		return nil, fmt.Errorf("failed to parse the OCI image layout: %v", err)
+	}
+	if version.ImageLayoutVersion != "1.0.0" {
+		return nil, fmt.Errorf("unsupported OCI image layout version %q", version.ImageLayoutVersion)
+	}
+	return l, nil
+}
+
+func (l *layout) name() string {
+	return filepath.Base(filepath.Clean(l.dir))
+}
+
+func (l *layout) reference() string {
+	return l.ref
+}
+
+// manifest returns the manifest with the digest, or the one named by the ref
+// within the layout's index. An empty ref selects the layout's only image.
+func (l *layout) manifest(ref string) (*manifest, error) {
+	if strings.HasPrefix(ref, "sha256:") {
+		return l.readManifest(ref)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(l.dir, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OCI image index: %v", err)
+	}
+	index, err := parseManifest(b, "", mediaTypeOCIIndex)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		if len(index.Manifests) != 1 {
+			return nil, fmt.Errorf("the OCI image layout contains %d images, a reference is required", len(index.Manifests))
+		}
+		return l.readManifest(index.Manifests[0].Digest)
+	}
+
+	for _, d := range index.Manifests {
+		if d.Annotations[refNameAnnotation] == ref {
+			return l.readManifest(d.Digest)
+		}
+	}
+	return nil, fmt.Errorf("image %q not found in the OCI image layout", ref)
+}
+
+func (l *layout) readManifest(digest string) (*manifest, error) {
+	r, err := l.blob(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %v", digest, err)
+	}
+	return parseManifest(b, digest, "")
+}
+
+func (l *layout) blob(digest string) (io.ReadCloser, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || strings.ContainsRune(parts[1], os.PathSeparator) {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	f, err := os.Open(filepath.Join(l.dir, "blobs", parts[0], parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %v", digest, err)
+	}
+	return newVerifiedReader(f, digest)
+}
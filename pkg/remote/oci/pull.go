@@ -0,0 +1,267 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/remote"
+	"github.com/appc/spec/schema"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// ErrSchema1 is returned when a registry only has a schema 1 manifest for an
+// image. Such images must be retrieved with docker2aci instead.
+var ErrSchema1 = errors.New("schema 1 image manifests are not supported")
+
+// ImageFinder locates images which have already been loaded, so the layers
+// they hold aren't retrieved again.
+type ImageFinder interface {
+	FindImage(name, version string) (string, *schema.ImageManifest)
+}
+
+// A puller retrieves images from a Docker registry using the v2 API, or from
+// an OCI image layout on disk, without squashing their layers. Each layer is
+// converted into its own ACI which depends on the layer beneath it, so layers
+// shared between images are only stored once.
+type puller struct {
+	insecure    bool
+	images      ImageFinder
+	credentials *credentials.Store
+}
+
+// New creates a Puller for "docker://" registry and "oci:" image layout URIs.
+// When insecure is set, registries may be accessed over plain HTTP. The images
+// are used to skip layers which are already available, and may be nil.
+// Registries are authenticated with using the credentials in the store.
+func New(insecure bool, images ImageFinder, creds *credentials.Store) remote.Puller {
+	return &puller{
+		insecure:    insecure,
+		images:      images,
+		credentials: creds,
+	}
+}
+
+// source provides the manifests and blobs of an image.
+type source interface {
+	// name returns the name given to the image.
+	name() string
+
+	// reference returns the tag or digest of the image to pull.
+	reference() string
+
+	// manifest retrieves a manifest, or an index of manifests, by tag or
+	// digest.
+	manifest(ref string) (*manifest, error)
+
+	// blob retrieves the blob with the digest.
+	blob(digest string) (io.ReadCloser, error)
+}
+
+// descriptor references content within a manifest or index.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// manifest is either an image manifest, or an index of manifests for
+// different platforms.
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+func (m *manifest) isIndex() bool {
+	switch m.MediaType {
+	case mediaTypeDockerManifestList, mediaTypeOCIIndex:
+		return true
+	case "":
+		return len(m.Manifests) > 0
+	}
+	return false
+}
+
+// imageConfig is the portion of an image's configuration used to generate
+// its ACI.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// Pull retrieves the image and returns the ACIs for the layers which are not
+// already available. The first is the image itself, followed by its layers
+// from the top down. Callers are responsible for closing the Readers.
+func (p *puller) Pull(uri string) ([]io.ReadCloser, error) {
+	var src source
+	var err error
+	switch {
+	case strings.HasPrefix(uri, "docker://"):
+		src, err = newRegistry(uri, p.insecure, p.credentials)
+	case strings.HasPrefix(uri, "oci:"):
+		src, err = newLayout(uri)
+	default:
+		return nil, fmt.Errorf("only 'docker://' and 'oci:' scheme image URLs supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := resolveManifest(src)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := fetchConfig(src, m.Config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.RootFS.DiffIDs) != len(m.Layers) {
+		return nil, fmt.Errorf("image config lists %d layers, but the manifest has %d",
+			len(config.RootFS.DiffIDs), len(m.Layers))
+	}
+
+	c := &converter{
+		source:  src,
+		images:  p.images,
+		config:  config,
+		layers:  m.Layers,
+		diffIDs: config.RootFS.DiffIDs,
+	}
+	return c.convert()
+}
+
+// resolveManifest retrieves the image's manifest, selecting the one for the
+// current platform if the image has an index of manifests.
+func resolveManifest(src source) (*manifest, error) {
+	m, err := src.manifest(src.reference())
+	if err != nil {
+		return nil, err
+	}
+	if !m.isIndex() {
+		return m, nil
+	}
+
+	for _, d := range m.Manifests {
+		if d.Platform == nil || (d.Platform.OS == runtime.GOOS && d.Platform.Architecture == runtime.GOARCH) {
+			m, err = src.manifest(d.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if m.isIndex() {
+				return nil, fmt.Errorf("manifest %s is a nested index", d.Digest)
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("image has no manifest for %s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// fetchConfig retrieves and parses the image's configuration.
+func fetchConfig(src source, d descriptor) (*imageConfig, error) {
+	r, err := src.blob(d.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the image config: %v", err)
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the image config: %v", err)
+	}
+	var config *imageConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the image config: %v", err)
+	}
+	return config, nil
+}
+
+// parseManifest parses a manifest, checking it against the digest when the
+// reference is a digest.
+func parseManifest(b []byte, ref, mediaType string) (*manifest, error) {
+	if strings.HasPrefix(ref, "sha256:") {
+		if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(b)); digest != ref {
+			return nil, fmt.Errorf("manifest digest %s does not match %s", digest, ref)
+		}
+	}
+
+	var m *manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse the image manifest: %v", err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = mediaType
+	}
+	if m.SchemaVersion == 1 {
+		return nil, ErrSchema1
+	}
+	if m.SchemaVersion != 2 {
+		return nil, fmt.Errorf("unsupported manifest schema version %d", m.SchemaVersion)
+	}
+	return m, nil
+}
+
+// verifiedReader checks the SHA256 digest of the content once it has been
+// read in full.
+type verifiedReader struct {
+	io.ReadCloser
+	digest string
+	h      hash.Hash
+}
+
+// newVerifiedReader wraps the content to check it against the digest.
+func newVerifiedReader(r io.ReadCloser, digest string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		r.Close()
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	return &verifiedReader{ReadCloser: r, digest: digest, h: sha256.New()}, nil
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.h.Write(p[:n])
+	if err == io.EOF {
+		if digest := fmt.Sprintf("sha256:%x", v.h.Sum(nil)); digest != v.digest {
+			return n, fmt.Errorf("content digest %s does not match %s", digest, v.digest)
+		}
+	}
+	return n, err
+}
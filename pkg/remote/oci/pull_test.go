@@ -0,0 +1,448 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/apcera/kurma/pkg/credentials"
+	"github.com/apcera/kurma/pkg/imagestore"
+	"github.com/appc/spec/schema"
+
+	remotehttp "github.com/apcera/kurma/pkg/remote/http"
+	tt "github.com/apcera/util/testtool"
+)
+
+// testImage holds the manifest and blobs of an image.
+type testImage struct {
+	manifest []byte
+	blobs    map[string][]byte
+}
+
+func digestOf(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+// buildLayer returns a gzipped layer containing the files and its diff ID.
+func buildLayer(t *testing.T, files map[string]string) ([]byte, string) {
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	for name, contents := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		tt.TestExpectSuccess(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(contents))
+		tt.TestExpectSuccess(t, err)
+	}
+	tt.TestExpectSuccess(t, tw.Close())
+
+	var blob bytes.Buffer
+	gz := gzip.NewWriter(&blob)
+	_, err := gz.Write(layer.Bytes())
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, gz.Close())
+	return blob.Bytes(), digestOf(layer.Bytes())
+}
+
+// buildImage creates an image from the layers, listed from the bottom up.
+func buildImage(t *testing.T, layers ...map[string]string) *testImage {
+	img := &testImage{blobs: make(map[string][]byte)}
+
+	var config imageConfig
+	config.OS = "linux"
+	config.Architecture = "amd64"
+	config.Config.Entrypoint = []string{"/bin/app"}
+	config.Config.Cmd = []string{"--serve"}
+	config.Config.Env = []string{"PATH=/bin"}
+	config.Config.ExposedPorts = map[string]struct{}{"8080/tcp": {}}
+
+	m := &manifest{SchemaVersion: 2, MediaType: mediaTypeOCIManifest}
+	for _, files := range layers {
+		blob, diffID := buildLayer(t, files)
+		img.blobs[digestOf(blob)] = blob
+		m.Layers = append(m.Layers, descriptor{Digest: digestOf(blob), Size: int64(len(blob))})
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	}
+
+	b, err := json.Marshal(config)
+	tt.TestExpectSuccess(t, err)
+	img.blobs[digestOf(b)] = b
+	m.Config = descriptor{Digest: digestOf(b), Size: int64(len(b))}
+
+	img.manifest, err = json.Marshal(m)
+	tt.TestExpectSuccess(t, err)
+	return img
+}
+
+// testRegistry serves images and requires a token from its token service.
+// When it has a username, the token service requires it and its password.
+type testRegistry struct {
+	*httptest.Server
+	images    map[string]*testImage
+	blobPulls map[string]int
+	lock      sync.Mutex
+
+	username string
+	password string
+}
+
+func newTestRegistry(images map[string]*testImage) *testRegistry {
+	r := &testRegistry{images: images, blobPulls: make(map[string]int)}
+	r.Server = httptest.NewServer(r)
+	return r
+}
+
+// newTLSTestRegistry creates a registry served over HTTPS, and has registries
+// trust its certificate until the returned function is called.
+func newTLSTestRegistry(images map[string]*testImage) (*testRegistry, func()) {
+	r := &testRegistry{images: images, blobPulls: make(map[string]int)}
+	r.Server = httptest.NewTLSServer(r)
+
+	client := remotehttp.Client
+	remotehttp.Client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	return r, func() {
+		remotehttp.Client = client
+		r.Close()
+	}
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		if req.URL.Query().Get("scope") != "repository:example/app:pull" {
+			http.Error(w, "bad scope", 400)
+			return
+		}
+		if username, password, _ := req.BasicAuth(); username != r.username || password != r.password {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, r.URL))
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/v2/example/app/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, req)
+		return
+	}
+	switch parts[0] {
+	case "manifests":
+		img, ok := r.images[parts[1]]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", mediaTypeOCIManifest)
+		w.Write(img.manifest)
+	case "blobs":
+		for _, img := range r.images {
+			if blob, ok := img.blobs[parts[1]]; ok {
+				r.lock.Lock()
+				r.blobPulls[parts[1]]++
+				r.lock.Unlock()
+				w.Write(blob)
+				return
+			}
+		}
+		http.NotFound(w, req)
+	}
+}
+
+// loadACIs loads the pulled ACIs, from the bottom up, and returns the hash of
+// the first.
+func loadACIs(t *testing.T, manager interface {
+	CreateImage(io.Reader) (string, *schema.ImageManifest, error)
+}, acis []io.ReadCloser) string {
+	var hash string
+	for i := len(acis) - 1; i >= 0; i-- {
+		var err error
+		hash, _, err = manager.CreateImage(acis[i])
+		tt.TestExpectSuccess(t, err)
+		acis[i].Close()
+	}
+	return hash
+}
+
+func TestNewRegistry(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	tests := []struct {
+		uri, host, repo, ref string
+	}{
+		{"docker://nats", dockerHubRegistry, "library/nats", "latest"},
+		{"docker:///user/plugin:1.0", dockerHubRegistry, "user/plugin", "1.0"},
+		{"docker://quay.io/coreos/etcd:v3", "quay.io", "coreos/etcd", "v3"},
+		{"docker://localhost:5000/app@sha256:abc", "localhost:5000", "app", "sha256:abc"},
+	}
+	for _, test := range tests {
+		r, err := newRegistry(test.uri, false, nil)
+		tt.TestExpectSuccess(t, err)
+		tt.TestEqual(t, []string{r.host, r.repo, r.ref}, []string{test.host, test.repo, test.ref})
+	}
+
+	_, err := newRegistry("docker://", false, nil)
+	tt.TestExpectError(t, err)
+}
+
+func TestRegistryPull(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	base := map[string]string{"etc/base": "base"}
+	app := buildImage(t, base, map[string]string{"./bin/app": "app"})
+	other := buildImage(t, base, map[string]string{"bin/other": "other"})
+	registry := newTestRegistry(map[string]*testImage{"1.0": app, "2.0": other})
+	defer registry.Close()
+	host := strings.TrimPrefix(registry.URL, "http://")
+
+	manager, err := imagestore.New(&imagestore.Options{Directory: tt.TempDir(t)})
+	tt.TestExpectSuccess(t, err)
+
+	// each layer is converted into its own image, beneath the image itself
+	acis, err := New(true, manager, nil).Pull(fmt.Sprintf("docker://%s/example/app:1.0", host))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(acis), 3)
+	hash := loadACIs(t, manager, acis)
+
+	image := manager.GetImage(hash)
+	tt.TestEqual(t, image.Name.String(), "127.0.0.1_"+strings.Split(host, ":")[1]+"/example/app")
+	version, _ := image.Labels.Get("version")
+	tt.TestEqual(t, version, "1.0")
+	tt.TestEqual(t, []string(image.App.Exec), []string{"/bin/app", "--serve"})
+	tt.TestEqual(t, image.App.Ports[0].Port, uint(8080))
+
+	tree, err := manager.ResolveTree(hash)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(tree.Order), 3)
+	b, err := ioutil.ReadFile(filepath.Join(tree.Paths[tree.Order[1]], "bin", "app"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "app")
+	b, err = ioutil.ReadFile(filepath.Join(tree.Paths[tree.Order[2]], "etc", "base"))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, string(b), "base")
+
+	// the shared base layer isn't retrieved again for another image
+	acis, err = New(true, manager, nil).Pull(fmt.Sprintf("docker://%s/example/app:2.0", host))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(acis), 2)
+	otherTree, err := manager.ResolveTree(loadACIs(t, manager, acis))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, otherTree.Order[2], tree.Order[2])
+
+	var m manifest
+	tt.TestExpectSuccess(t, json.Unmarshal(app.manifest, &m))
+	tt.TestEqual(t, registry.blobPulls[m.Layers[0].Digest], 1)
+
+	// missing images fail
+	_, err = New(true, manager, nil).Pull(fmt.Sprintf("docker://%s/example/app:3.0", host))
+	tt.TestExpectError(t, err)
+}
+
+func TestRegistryPullCredentials(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	images := map[string]*testImage{"latest": buildImage(t, map[string]string{"bin/app": "app"})}
+	registry, cleanup := newTLSTestRegistry(images)
+	registry.username, registry.password = "user", "pass"
+	defer cleanup()
+	host := strings.TrimPrefix(registry.URL, "https://")
+	uri := fmt.Sprintf("docker://%s/example/app", host)
+
+	// anonymous tokens aren't issued
+	_, err := New(true, nil, nil).Pull(uri)
+	tt.TestExpectError(t, err)
+
+	creds, err := credentials.New("")
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, creds.Add(&credentials.Credential{Host: "127.0.0.1", Username: "user", Password: "wrong"}))
+	_, err = New(true, nil, creds).Pull(uri)
+	tt.TestExpectError(t, err)
+
+	// credentials for the host and port are preferred over the host's
+	tt.TestExpectSuccess(t, creds.Add(&credentials.Credential{Host: host, Username: "user", Password: "pass"}))
+	acis, err := New(true, nil, creds).Pull(uri)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(acis), 2)
+	for _, aci := range acis {
+		aci.Close()
+	}
+
+	// credentials aren't sent to registries accessed over plain HTTP
+	plain := newTestRegistry(images)
+	plain.username, plain.password = "user", "pass"
+	defer plain.Close()
+	plainHost := strings.TrimPrefix(plain.URL, "http://")
+	tt.TestExpectSuccess(t, creds.Add(&credentials.Credential{Host: plainHost, Username: "user", Password: "pass"}))
+	_, err = New(true, nil, creds).Pull(fmt.Sprintf("docker://%s/example/app", plainHost))
+	tt.TestExpectError(t, err)
+}
+
+func TestRegistryPullSchema1(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	img := &testImage{manifest: []byte(`{"schemaVersion":1,"name":"example/app","tag":"latest"}`)}
+	registry := newTestRegistry(map[string]*testImage{"latest": img})
+	defer registry.Close()
+
+	// schema 1 images are left for docker2aci to convert
+	_, err := New(true, nil, nil).Pull(fmt.Sprintf("docker://%s/example/app", strings.TrimPrefix(registry.URL, "http://")))
+	tt.TestEqual(t, err, ErrSchema1)
+}
+
+func TestRegistryPullCorruptBlob(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	img := buildImage(t, map[string]string{"bin/app": "app"})
+	for digest, blob := range img.blobs {
+		if len(blob) > 0 && blob[0] == 0x1f {
+			img.blobs[digest] = append(blob[:len(blob)-1:len(blob)-1], blob[len(blob)-1]^0xff)
+		}
+	}
+	registry := newTestRegistry(map[string]*testImage{"latest": img})
+	defer registry.Close()
+
+	_, err := New(true, nil, nil).Pull(fmt.Sprintf("docker://%s/example/app", strings.TrimPrefix(registry.URL, "http://")))
+	tt.TestExpectError(t, err)
+}
+
+// aciEntries returns the headers of the files in the ACI, by name.
+func aciEntries(t *testing.T, aci io.Reader) map[string]*tar.Header {
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(aci)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		tt.TestExpectSuccess(t, err)
+		entries[hdr.Name] = hdr
+	}
+}
+
+func TestRegistryPullWhiteouts(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	img := buildImage(t,
+		map[string]string{"etc/old": "old", "var/cache/a/file": "a", "var/lib/b": "b"},
+		map[string]string{"etc/.wh.old": "", "var/cache/.wh..wh..opq": "", "var/cache/a/.wh..wh..opq": "", "var/cache/new": "new"})
+	registry := newTestRegistry(map[string]*testImage{"latest": img})
+	defer registry.Close()
+
+	acis, err := New(true, nil, nil).Pull(fmt.Sprintf("docker://%s/example/app", strings.TrimPrefix(registry.URL, "http://")))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(acis), 4)
+	defer func() {
+		for _, aci := range acis {
+			aci.Close()
+		}
+	}()
+
+	// whiteouts become character devices, and opaque markers are dropped
+	top := aciEntries(t, acis[1])
+	tt.TestEqual(t, top["rootfs/etc/old"].Typeflag, byte(tar.TypeChar))
+	tt.TestEqual(t, top["rootfs/etc/old"].Devmajor, int64(0))
+	tt.TestEqual(t, top["rootfs/etc/old"].Devminor, int64(0))
+	tt.TestEqual(t, top["rootfs/var/cache/new"].Typeflag, byte(tar.TypeReg))
+	for name := range top {
+		tt.TestEqual(t, strings.Contains(name, whiteoutPrefix), false)
+	}
+
+	// opaque directories are hidden by whiteouts beneath the layer
+	opaque := aciEntries(t, acis[2])
+	tt.TestEqual(t, len(opaque), 4)
+	tt.TestEqual(t, opaque["rootfs/var/"].Typeflag, byte(tar.TypeDir))
+	tt.TestEqual(t, opaque["rootfs/var/cache"].Typeflag, byte(tar.TypeChar))
+
+	var m schema.ImageManifest
+	tt.TestExpectSuccess(t, json.Unmarshal(readManifest(t, acis[1]), &m))
+	tt.TestEqual(t, m.Dependencies[0].ImageName.String(), m.Name.String()+opaqueNameSuffix)
+}
+
+// readManifest returns the manifest of the ACI, rewinding it first.
+func readManifest(t *testing.T, aci io.ReadCloser) []byte {
+	_, err := aci.(io.Seeker).Seek(0, 0)
+	tt.TestExpectSuccess(t, err)
+	tr := tar.NewReader(aci)
+	for {
+		hdr, err := tr.Next()
+		tt.TestExpectSuccess(t, err)
+		if hdr.Name == "manifest" {
+			b, err := ioutil.ReadAll(tr)
+			tt.TestExpectSuccess(t, err)
+			return b
+		}
+	}
+}
+
+func TestLayoutPull(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	img := buildImage(t, map[string]string{"etc/base": "base"}, map[string]string{"bin/app": "app"})
+
+	dir := filepath.Join(tt.TempDir(t), "app")
+	tt.TestExpectSuccess(t, os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755))
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644))
+	img.blobs[digestOf(img.manifest)] = img.manifest
+	for digest, blob := range img.blobs {
+		path := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+		tt.TestExpectSuccess(t, ioutil.WriteFile(path, blob, 0644))
+	}
+	index := &manifest{
+		SchemaVersion: 2,
+		Manifests: []descriptor{{
+			MediaType:   mediaTypeOCIManifest,
+			Digest:      digestOf(img.manifest),
+			Size:        int64(len(img.manifest)),
+			Annotations: map[string]string{refNameAnnotation: "1.0"},
+		}},
+	}
+	b, err := json.Marshal(index)
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, ioutil.WriteFile(filepath.Join(dir, "index.json"), b, 0644))
+
+	manager, err := imagestore.New(&imagestore.Options{Directory: tt.TempDir(t)})
+	tt.TestExpectSuccess(t, err)
+
+	for _, uri := range []string{"oci:" + dir + ":1.0", "oci://" + dir} {
+		acis, err := New(true, nil, nil).Pull(uri)
+		tt.TestExpectSuccess(t, err)
+		tt.TestEqual(t, len(acis), 3)
+
+		hash := loadACIs(t, manager, acis)
+		tt.TestEqual(t, manager.GetImage(hash).Name.String(), "app")
+		tree, err := manager.ResolveTree(hash)
+		tt.TestExpectSuccess(t, err)
+		tt.TestEqual(t, len(tree.Order), 3)
+	}
+
+	// only the images differ, as they were pulled with different references
+	tt.TestEqual(t, len(manager.ListImages()), 4)
+
+	_, err = New(true, nil, nil).Pull("oci:" + dir + ":2.0")
+	tt.TestExpectError(t, err)
+}
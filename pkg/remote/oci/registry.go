@@ -0,0 +1,249 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/apcera/kurma/pkg/credentials"
+
+	remotehttp "github.com/apcera/kurma/pkg/remote/http"
+)
+
+const (
+	// dockerHubRegistry is the registry used when an image doesn't name one.
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+var (
+	// manifestMediaTypes are the manifest formats accepted from registries.
+	manifestMediaTypes = []string{
+		mediaTypeDockerManifest,
+		mediaTypeDockerManifestList,
+		mediaTypeOCIManifest,
+		mediaTypeOCIIndex,
+	}
+
+	// challengeParamRegexp matches the parameters of a WWW-Authenticate
+	// challenge.
+	challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// registry retrieves an image from a Docker registry using the v2 API.
+type registry struct {
+	client     *http.Client
+	host       string
+	repo       string
+	ref        string
+	scheme     string
+	insecure   bool
+	credential *credentials.Credential
+	auth       string
+}
+
+// newRegistry parses a "docker://[host/]repo[:tag|@digest]" URI. Images
+// without a host are retrieved from Docker Hub. The registry's credentials
+// are looked up in the store, which may be nil.
+func newRegistry(uri string, insecure bool, creds *credentials.Store) (*registry, error) {
+	r := &registry{
+		client:   remotehttp.Client,
+		host:     dockerHubRegistry,
+		ref:      "latest",
+		scheme:   "https",
+		insecure: insecure,
+	}
+
+	s := strings.TrimPrefix(strings.TrimPrefix(uri, "docker://"), "/")
+	if i := strings.Index(s, "/"); i > 0 {
+		if host := s[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.host = host
+			s = s[i+1:]
+		}
+	}
+
+	if i := strings.Index(s, "@"); i >= 0 {
+		s, r.ref = s[:i], s[i+1:]
+	} else if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		s, r.ref = s[:i], s[i+1:]
+	}
+	if s == "" || r.ref == "" {
+		return nil, fmt.Errorf("invalid docker image %q", uri)
+	}
+	if r.host == dockerHubRegistry && !strings.Contains(s, "/") {
+		s = "library/" + s
+	}
+	r.repo = s
+
+	// a configured token is presented to the registry up front, while a
+	// username and password are only used once the registry asks for them
+	r.credential = creds.Get(r.host)
+	if r.credential != nil && r.credential.Token != "" {
+		r.auth = r.credential.Header()
+	}
+	return r, nil
+}
+
+func (r *registry) name() string {
+	return r.host + "/" + r.repo
+}
+
+func (r *registry) reference() string {
+	return r.ref
+}
+
+func (r *registry) manifest(ref string) (*manifest, error) {
+	resp, err := r.get("manifests/"+ref, manifestMediaTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the manifest for %s:%s: %v", r.name(), ref, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the manifest for %s:%s: %v", r.name(), ref, err)
+	}
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	return parseManifest(b, ref, mediaType)
+}
+
+func (r *registry) blob(digest string) (io.ReadCloser, error) {
+	resp, err := r.get("blobs/"+digest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve blob %s: %v", digest, err)
+	}
+	return newVerifiedReader(resp.Body, digest)
+}
+
+// get requests the path beneath the repository, authenticating and falling
+// back to plain HTTP as needed.
+func (r *registry) get(path string, accept []string) (*http.Response, error) {
+	resp, err := r.do(path, accept)
+	if err != nil && r.insecure && r.scheme == "https" {
+		// any authorization was obtained for HTTPS, so it isn't sent over HTTP
+		r.scheme = "http"
+		r.auth = ""
+		resp, err = r.do(path, accept)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && r.auth == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := r.authenticate(challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = r.do(path, accept); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %d from registry %s", resp.StatusCode, r.host)
+	}
+	return resp, nil
+}
+
+func (r *registry) do(path string, accept []string) (*http.Response, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme, r.host, r.repo, path)
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+	if r.auth != "" {
+		req.Header.Set("Authorization", r.auth)
+	}
+	return r.client.Do(req)
+}
+
+// authenticate responds to the registry's challenge. Basic challenges are
+// answered with the registry's username and password. For Bearer challenges,
+// a pull token for the repository is retrieved from the token service named
+// in the challenge, which is authenticated with the username and password if
+// the registry has them, and is anonymous otherwise. Credentials are never used
+// for registries accessed over plain HTTP.
+func (r *registry) authenticate(challenge string) error {
+	credential := r.credential
+	if r.scheme != "https" {
+		credential = nil
+	}
+
+	switch {
+	case strings.HasPrefix(challenge, "Basic "):
+		if credential == nil || credential.Username == "" {
+			return fmt.Errorf("registry %s requires a username and password over HTTPS", r.host)
+		}
+		r.auth = credential.Header()
+		return nil
+	case !strings.HasPrefix(challenge, "Bearer "):
+		return fmt.Errorf("registry %s requires unsupported authentication %q", r.host, challenge)
+	}
+
+	params := make(map[string]string)
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return fmt.Errorf("registry %s returned an authentication challenge without a realm", r.host)
+	}
+
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid authentication realm %q: %v", params["realm"], err)
+	}
+	query := u.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", r.repo))
+	u.RawQuery = query.Encode()
+	if u.Scheme != "https" {
+		credential = nil
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if credential != nil && credential.Username != "" {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve a registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("registry %s rejected the configured credentials", r.host)
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to retrieve a registry token: HTTP %d", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to parse the registry token: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return fmt.Errorf("registry %s did not return a token", r.host)
+	}
+	r.auth = "Bearer " + token.Token
+	return nil
+}
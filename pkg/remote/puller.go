@@ -12,3 +12,19 @@ type Puller interface {
 	// format and content of requested image.
 	Pull(uri string) ([]io.ReadCloser, error)
 }
+
+// Progress describes how much of an image has been downloaded.
+type Progress struct {
+	// URI is the location the image is being downloaded from.
+	URI string `json:"uri"`
+
+	// Downloaded is the number of bytes downloaded so far, including those
+	// downloaded before the download was resumed.
+	Downloaded int64 `json:"downloaded"`
+
+	// Total is the size of the image in bytes, or -1 if it isn't known.
+	Total int64 `json:"total"`
+}
+
+// A ProgressFunc is called as an image is downloaded.
+type ProgressFunc func(Progress)
@@ -0,0 +1,170 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+// Package resources translates the resource isolators into the cgroup settings
+// applied to a pod or container.
+package resources
+
+import (
+	"fmt"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+const (
+	// CPUPeriod is the CFS scheduling period, in microseconds, that CPU limits
+	// are enforced over.
+	CPUPeriod = int64(100000)
+
+	// minCPUShares and minCPUQuota are the smallest values the kernel accepts.
+	minCPUShares = int64(2)
+	minCPUQuota  = int64(1000)
+
+	// MinMemory is the smallest memory limit allowed. Anything lower is unlikely
+	// to be intentional and will leave the app killed as soon as it starts.
+	MinMemory = int64(4 * 1024 * 1024)
+)
+
+// Apply sets the cgroup resources for any resource/cpu, resource/memory,
+// os/linux/pids-limit, and os/linux/block-io-weight isolators in the list. An
+// error is returned if an isolator's values are not usable.
+func Apply(isolators types.Isolators, r *configs.Resources) error {
+	for _, iso := range isolators {
+		var err error
+		switch value := iso.Value().(type) {
+		case *types.ResourceCPU:
+			err = applyCPU(value, r)
+		case *types.ResourceMemory:
+			err = applyMemory(value, r)
+		case *kschema.LinuxPidsLimit:
+			r.PidsLimit = value.Limit
+		case *kschema.LinuxBlockIOWeight:
+			r.BlkioWeight = value.Weight
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %q isolator: %v", iso.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyCPU converts the CPU request into relative CPU shares, with one core
+// being equal to the kernel's default of 1024 shares, and the CPU limit into a
+// CFS quota.
+func applyCPU(cpu *types.ResourceCPU, r *configs.Resources) error {
+	if err := checkResource(cpu); err != nil {
+		return err
+	}
+	request, limit := cpu.Request(), cpu.Limit()
+
+	if request != nil {
+		shares := request.MilliValue() * 1024 / 1000
+		if shares < minCPUShares {
+			shares = minCPUShares
+		}
+		r.CpuShares = shares
+	}
+
+	if limit != nil {
+		quota := limit.MilliValue() * CPUPeriod / 1000
+		if quota < minCPUQuota {
+			quota = minCPUQuota
+		}
+		r.CpuPeriod = CPUPeriod
+		r.CpuQuota = quota
+	}
+	return nil
+}
+
+// applyMemory converts the memory limit into a hard limit and the request into
+// a soft limit. Swap is capped at the memory limit so the app can't exceed its
+// limit by swapping.
+func applyMemory(memory *types.ResourceMemory, r *configs.Resources) error {
+	if err := checkResource(memory); err != nil {
+		return err
+	}
+	request, limit := memory.Request(), memory.Limit()
+
+	if request != nil {
+		r.MemoryReservation = request.Value()
+	}
+
+	if limit != nil {
+		if limit.Value() < MinMemory {
+			return fmt.Errorf("limit must be at least %d bytes", MinMemory)
+		}
+		r.Memory = limit.Value()
+		r.MemorySwap = limit.Value()
+	}
+	return nil
+}
+
+// checkResource ensures any request or limit given is greater than zero and
+// that the request doesn't exceed the limit.
+func checkResource(r types.Resource) error {
+	request, limit := r.Request(), r.Limit()
+	if request != nil && request.MilliValue() <= 0 {
+		return fmt.Errorf("request must be greater than zero")
+	}
+	if limit != nil && limit.MilliValue() <= 0 {
+		return fmt.Errorf("limit must be greater than zero")
+	}
+	if request != nil && limit != nil && request.MilliValue() > limit.MilliValue() {
+		return fmt.Errorf("request must not be greater than the limit")
+	}
+	return nil
+}
+
+// CheckNested ensures that an app's limits and requests fit within the limits
+// of the pod it is part of. Apps may leave their limits unset, in which case
+// they are only bound by the pod's limits.
+func CheckNested(pod, app *configs.Resources) error {
+	if pod.Memory > 0 {
+		if app.Memory > pod.Memory {
+			return fmt.Errorf("memory limit of %d bytes exceeds the pod's limit of %d bytes", app.Memory, pod.Memory)
+		}
+		if app.MemoryReservation > pod.Memory {
+			return fmt.Errorf("memory request of %d bytes exceeds the pod's limit of %d bytes", app.MemoryReservation, pod.Memory)
+		}
+	}
+	if pod.CpuQuota > 0 {
+		if app.CpuQuota > pod.CpuQuota {
+			return fmt.Errorf("cpu limit exceeds the pod's cpu limit")
+		}
+		if sharesToQuota(app.CpuShares) > pod.CpuQuota {
+			return fmt.Errorf("cpu request exceeds the pod's cpu limit")
+		}
+	}
+	if pod.PidsLimit > 0 && app.PidsLimit > pod.PidsLimit {
+		return fmt.Errorf("pids limit of %d exceeds the pod's limit of %d", app.PidsLimit, pod.PidsLimit)
+	}
+	return nil
+}
+
+// CheckRequests ensures that the combined requests of all of a pod's apps can
+// be satisfied within the pod's limits.
+func CheckRequests(pod *configs.Resources, apps []*configs.Resources) error {
+	var memory, shares int64
+	for _, app := range apps {
+		memory += app.MemoryReservation
+		shares += app.CpuShares
+	}
+
+	if pod.Memory > 0 && memory > pod.Memory {
+		return fmt.Errorf("the apps' combined memory requests of %d bytes exceed the pod's limit of %d bytes", memory, pod.Memory)
+	}
+	if pod.CpuQuota > 0 && sharesToQuota(shares) > pod.CpuQuota {
+		return fmt.Errorf("the apps' combined cpu requests exceed the pod's cpu limit")
+	}
+	return nil
+}
+
+// sharesToQuota converts CPU shares back into the CFS quota for the same number
+// of cores, so that requests can be compared to limits.
+func sharesToQuota(shares int64) int64 {
+	return shares * CPUPeriod / 1024
+}
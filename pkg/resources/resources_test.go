@@ -0,0 +1,136 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package resources
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func parseIsolators(t *testing.T, s string) types.Isolators {
+	var isolators types.Isolators
+	tt.TestExpectSuccess(t, json.Unmarshal([]byte(s), &isolators))
+	return isolators
+}
+
+func TestApply(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	isolators := parseIsolators(t, `[
+		{"name": "resource/cpu", "value": {"request": "500m", "limit": "2"}},
+		{"name": "resource/memory", "value": {"request": "128Mi", "limit": "256Mi"}},
+		{"name": "os/linux/pids-limit", "value": {"limit": 100}},
+		{"name": "os/linux/block-io-weight", "value": {"weight": 500}}
+	]`)
+
+	r := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(isolators, r))
+	tt.TestEqual(t, r.CpuShares, int64(512))
+	tt.TestEqual(t, r.CpuPeriod, CPUPeriod)
+	tt.TestEqual(t, r.CpuQuota, int64(200000))
+	tt.TestEqual(t, r.MemoryReservation, int64(128*1024*1024))
+	tt.TestEqual(t, r.Memory, int64(256*1024*1024))
+	tt.TestEqual(t, r.MemorySwap, int64(256*1024*1024))
+	tt.TestEqual(t, r.PidsLimit, int64(100))
+	tt.TestEqual(t, r.BlkioWeight, uint16(500))
+}
+
+func TestApplyMinimums(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	isolators := parseIsolators(t, `[{"name": "resource/cpu", "value": {"request": "1m", "limit": "1m"}}]`)
+
+	r := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(isolators, r))
+	tt.TestEqual(t, r.CpuShares, minCPUShares)
+	tt.TestEqual(t, r.CpuQuota, minCPUQuota)
+}
+
+func TestApplyInvalid(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	// other isolators are ignored
+	tt.TestExpectSuccess(t, Apply(parseIsolators(t, `[{"name": "os/linux/capabilities-retain-set", "value": {"set": ["CAP_KILL"]}}]`), &configs.Resources{}))
+
+	tests := map[string]string{
+		`[{"name": "resource/cpu", "value": {"limit": "0"}}]`:                       `invalid "resource/cpu" isolator: limit must be greater than zero`,
+		`[{"name": "resource/cpu", "value": {"request": "2", "limit": "1"}}]`:       `invalid "resource/cpu" isolator: request must not be greater than the limit`,
+		`[{"name": "resource/memory", "value": {"request": "-1"}}]`:                 `invalid "resource/memory" isolator: request must be greater than zero`,
+		`[{"name": "resource/memory", "value": {"limit": "1Mi"}}]`:                  `invalid "resource/memory" isolator: limit must be at least 4194304 bytes`,
+		`[{"name": "resource/memory", "value": {"request": "1Gi", "limit": "1G"}}]`: `invalid "resource/memory" isolator: request must not be greater than the limit`,
+	}
+	for s, expected := range tests {
+		err := Apply(parseIsolators(t, s), &configs.Resources{})
+		tt.TestExpectError(t, err)
+		tt.TestEqual(t, err.Error(), expected)
+	}
+}
+
+func TestCheckNested(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	pod := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(parseIsolators(t, `[
+		{"name": "resource/cpu", "value": {"limit": "1"}},
+		{"name": "resource/memory", "value": {"limit": "1Gi"}},
+		{"name": "os/linux/pids-limit", "value": {"limit": 100}}
+	]`), pod))
+
+	// apps without limits, or with limits inside the pod's, are fine
+	tt.TestExpectSuccess(t, CheckNested(pod, &configs.Resources{}))
+	app := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(parseIsolators(t, `[
+		{"name": "resource/cpu", "value": {"request": "1", "limit": "1"}},
+		{"name": "resource/memory", "value": {"request": "512Mi", "limit": "1Gi"}}
+	]`), app))
+	tt.TestExpectSuccess(t, CheckNested(pod, app))
+
+	tests := map[string]string{
+		`[{"name": "resource/cpu", "value": {"limit": "1500m"}}]`:     "cpu limit exceeds the pod's cpu limit",
+		`[{"name": "resource/cpu", "value": {"request": "2"}}]`:       "cpu request exceeds the pod's cpu limit",
+		`[{"name": "resource/memory", "value": {"limit": "2Gi"}}]`:    "memory limit of 2147483648 bytes exceeds the pod's limit of 1073741824 bytes",
+		`[{"name": "resource/memory", "value": {"request": "2Gi"}}]`:  "memory request of 2147483648 bytes exceeds the pod's limit of 1073741824 bytes",
+		`[{"name": "os/linux/pids-limit", "value": {"limit": 1000}}]`: "pids limit of 1000 exceeds the pod's limit of 100",
+	}
+	for s, expected := range tests {
+		app := &configs.Resources{}
+		tt.TestExpectSuccess(t, Apply(parseIsolators(t, s), app))
+		err := CheckNested(pod, app)
+		tt.TestExpectError(t, err)
+		tt.TestEqual(t, err.Error(), expected)
+	}
+}
+
+func TestCheckRequests(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	pod := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(parseIsolators(t, `[
+		{"name": "resource/cpu", "value": {"limit": "1"}},
+		{"name": "resource/memory", "value": {"limit": "1Gi"}}
+	]`), pod))
+
+	half := &configs.Resources{}
+	tt.TestExpectSuccess(t, Apply(parseIsolators(t, `[
+		{"name": "resource/cpu", "value": {"request": "500m"}},
+		{"name": "resource/memory", "value": {"request": "512Mi"}}
+	]`), half))
+	tt.TestExpectSuccess(t, CheckRequests(pod, []*configs.Resources{half, half}))
+
+	err := CheckRequests(pod, []*configs.Resources{half, half, half})
+	tt.TestExpectError(t, err)
+	tt.TestEqual(t, err.Error(), "the apps' combined memory requests of 1610612736 bytes exceed the pod's limit of 1073741824 bytes")
+
+	// without pod limits, any requests are allowed
+	tt.TestExpectSuccess(t, CheckRequests(&configs.Resources{}, []*configs.Resources{half, half, half}))
+}
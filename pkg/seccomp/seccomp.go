@@ -0,0 +1,139 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+// Package seccomp builds the seccomp syscall filters applied to app
+// containers from the default profile and any seccomp isolators.
+package seccomp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+// DefaultBlockedSyscalls are the syscalls blocked for every app that doesn't
+// specify a retain set. They allow changing kernel or host state, escaping the
+// container's namespaces, or inspecting other processes, and are rarely needed
+// by applications.
+var DefaultBlockedSyscalls = []string{
+	"acct",
+	"add_key",
+	"bpf",
+	"clock_adjtime",
+	"clock_settime",
+	"create_module",
+	"delete_module",
+	"finit_module",
+	"get_kernel_syms",
+	"get_mempolicy",
+	"init_module",
+	"ioperm",
+	"iopl",
+	"kcmp",
+	"kexec_file_load",
+	"kexec_load",
+	"keyctl",
+	"lookup_dcookie",
+	"mbind",
+	"mount",
+	"move_pages",
+	"name_to_handle_at",
+	"nfsservctl",
+	"open_by_handle_at",
+	"perf_event_open",
+	"personality",
+	"pivot_root",
+	"process_vm_readv",
+	"process_vm_writev",
+	"ptrace",
+	"query_module",
+	"quotactl",
+	"reboot",
+	"request_key",
+	"set_mempolicy",
+	"setns",
+	"settimeofday",
+	"stime",
+	"swapoff",
+	"swapon",
+	"sysfs",
+	"umount",
+	"umount2",
+	"unshare",
+	"uselib",
+	"userfaultfd",
+	"ustat",
+	"vm86",
+	"vm86old",
+}
+
+// Profile returns the seccomp filter for an app with the given isolators. A
+// retain set allows only the listed syscalls, while a remove set blocks the
+// listed syscalls along with the default ones. Without either, the default
+// profile is used, unless the app is privileged, in which case nil is returned
+// and no filter is applied.
+func Profile(isolators types.Isolators, privileged bool) (*configs.Seccomp, error) {
+	retain := isolators.GetByName(kschema.LinuxSeccompRetainSetName)
+	remove := isolators.GetByName(kschema.LinuxSeccompRemoveSetName)
+	if retain != nil && remove != nil {
+		return nil, fmt.Errorf("the %q and %q isolators cannot be combined", kschema.LinuxSeccompRetainSetName, kschema.LinuxSeccompRemoveSetName)
+	}
+
+	switch {
+	case retain != nil:
+		set, ok := retain.Value().(kschema.LinuxSeccompSet)
+		if !ok {
+			return nil, fmt.Errorf("invalid %q isolator", retain.Name)
+		}
+		return newProfile(configs.Errno, configs.Allow, set.Syscalls()), nil
+
+	case remove != nil:
+		set, ok := remove.Value().(kschema.LinuxSeccompSet)
+		if !ok {
+			return nil, fmt.Errorf("invalid %q isolator", remove.Name)
+		}
+		syscalls := append(append([]string{}, DefaultBlockedSyscalls...), set.Syscalls()...)
+		return newProfile(configs.Allow, configs.Errno, syscalls), nil
+
+	case privileged:
+		return nil, nil
+
+	default:
+		return newProfile(configs.Allow, configs.Errno, DefaultBlockedSyscalls), nil
+	}
+}
+
+// HasIsolator returns whether a seccomp isolator is present in the list.
+func HasIsolator(isolators types.Isolators) bool {
+	return isolators.GetByName(kschema.LinuxSeccompRetainSetName) != nil ||
+		isolators.GetByName(kschema.LinuxSeccompRemoveSetName) != nil
+}
+
+// newProfile returns a filter that takes the action on the listed syscalls and
+// the default action on all others. Duplicate syscalls are only listed once.
+func newProfile(defaultAction, action configs.Action, syscalls []string) *configs.Seccomp {
+	seen := make(map[string]bool, len(syscalls))
+	names := make([]string, 0, len(syscalls))
+	for _, name := range syscalls {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	profile := &configs.Seccomp{
+		DefaultAction: defaultAction,
+		Syscalls:      make([]*configs.Syscall, 0, len(names)),
+	}
+	for _, name := range names {
+		profile.Syscalls = append(profile.Syscalls, &configs.Syscall{
+			Name:   name,
+			Action: action,
+		})
+	}
+	return profile
+}
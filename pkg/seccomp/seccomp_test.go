@@ -0,0 +1,96 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+func parseIsolators(t *testing.T, s string) types.Isolators {
+	var isolators types.Isolators
+	tt.TestExpectSuccess(t, json.Unmarshal([]byte(s), &isolators))
+	return isolators
+}
+
+func syscallActions(profile *configs.Seccomp) map[string]configs.Action {
+	actions := make(map[string]configs.Action)
+	for _, s := range profile.Syscalls {
+		actions[s.Name] = s.Action
+	}
+	return actions
+}
+
+func TestDefaultProfile(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	profile, err := Profile(nil, false)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, profile.DefaultAction, configs.Allow)
+	tt.TestEqual(t, len(profile.Syscalls), len(DefaultBlockedSyscalls))
+	actions := syscallActions(profile)
+	tt.TestEqual(t, actions["mount"], configs.Errno)
+	tt.TestEqual(t, actions["keyctl"], configs.Errno)
+
+	// privileged apps aren't filtered by default
+	profile, err = Profile(nil, true)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, profile == nil, true)
+}
+
+func TestRemoveSet(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	isolators := parseIsolators(t, `[
+		{"name": "os/linux/seccomp-remove-set", "value": {"set": ["chmod", "mount"]}}
+	]`)
+
+	profile, err := Profile(isolators, true)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, profile.DefaultAction, configs.Allow)
+	tt.TestEqual(t, len(profile.Syscalls), len(DefaultBlockedSyscalls)+1)
+	actions := syscallActions(profile)
+	tt.TestEqual(t, actions["chmod"], configs.Errno)
+	tt.TestEqual(t, actions["mount"], configs.Errno)
+}
+
+func TestRetainSet(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	isolators := parseIsolators(t, `[
+		{"name": "os/linux/seccomp-retain-set", "value": {"set": ["read", "write", "exit"]}}
+	]`)
+
+	profile, err := Profile(isolators, false)
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, profile.DefaultAction, configs.Errno)
+	tt.TestEqual(t, syscallActions(profile), map[string]configs.Action{
+		"exit":  configs.Allow,
+		"read":  configs.Allow,
+		"write": configs.Allow,
+	})
+}
+
+func TestInvalidIsolators(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	isolators := parseIsolators(t, `[
+		{"name": "os/linux/seccomp-retain-set", "value": {"set": ["read"]}},
+		{"name": "os/linux/seccomp-remove-set", "value": {"set": ["mount"]}}
+	]`)
+	_, err := Profile(isolators, false)
+	tt.TestExpectError(t, err)
+
+	var empty types.Isolators
+	err = json.Unmarshal([]byte(`[{"name": "os/linux/seccomp-remove-set", "value": {"set": []}}]`), &empty)
+	tt.TestExpectError(t, err)
+}
@@ -0,0 +1,252 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package trust
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/appc/spec/schema/types"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const (
+	// rootDirectory holds the keys which are trusted for all images.
+	rootDirectory = "root.d"
+
+	// prefixDirectory holds a directory for each image name prefix, containing
+	// the keys trusted for images under that prefix.
+	prefixDirectory = "prefix.d"
+)
+
+// Store manages the public keys which are trusted to sign images. Each key is
+// trusted for the images whose name falls under the key's prefix. A key with
+// an empty prefix is trusted for all images.
+type Store struct {
+	directory string
+	lock      sync.RWMutex
+}
+
+// Key describes a trusted public key.
+type Key struct {
+	Prefix      string
+	Fingerprint string
+	Identities  []string
+}
+
+// New creates a Store which keeps its keys within the specified directory.
+func New(directory string) (*Store, error) {
+	for _, dir := range []string{rootDirectory, prefixDirectory} {
+		if err := os.MkdirAll(filepath.Join(directory, dir), os.FileMode(0755)); err != nil {
+			return nil, fmt.Errorf("failed to create the trusted keys directory: %v", err)
+		}
+	}
+	return &Store{directory: directory}, nil
+}
+
+// AddKeys trusts the public keys within the armored keyring for the images
+// under the prefix. It returns the keys which were added.
+func (s *Store) AddKeys(prefix string, r io.Reader) ([]*Key, error) {
+	dir, err := s.prefixPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the keys: %v", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return nil, fmt.Errorf("failed to create the key directory: %v", err)
+	}
+
+	keys := make([]*Key, 0, len(entities))
+	for _, entity := range entities {
+		// only the public portion of the key is kept
+		var buf bytes.Buffer
+		w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := entity.Serialize(w); err != nil {
+			return nil, fmt.Errorf("failed to serialize the key: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		key := newKey(prefix, entity)
+		if err := ioutil.WriteFile(filepath.Join(dir, key.Fingerprint), buf.Bytes(), os.FileMode(0644)); err != nil {
+			return nil, fmt.Errorf("failed to write key %s: %v", key.Fingerprint, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RemoveKey stops trusting the key for the images under the prefix.
+func (s *Store) RemoveKey(prefix, fingerprint string) error {
+	dir, err := s.prefixPath(prefix)
+	if err != nil {
+		return err
+	}
+	if fingerprint == "" || strings.ContainsRune(fingerprint, os.PathSeparator) {
+		return fmt.Errorf("invalid key fingerprint %q", fingerprint)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.Remove(filepath.Join(dir, strings.ToLower(fingerprint))); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("key %s is not trusted for prefix %q", fingerprint, prefix)
+		}
+		return err
+	}
+
+	// clean up the prefix's directory once its last key is removed
+	if prefix != "" {
+		os.Remove(dir)
+	}
+	return nil
+}
+
+// Keys returns all of the trusted keys, sorted by prefix and fingerprint.
+func (s *Store) Keys() ([]*Key, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	prefixes := []string{""}
+	dirs, err := ioutil.ReadDir(filepath.Join(s.directory, prefixDirectory))
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range dirs {
+		prefix, err := url.QueryUnescape(fi.Name())
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var keys []*Key
+	for _, prefix := range prefixes {
+		entities, err := s.loadKeys(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			keys = append(keys, newKey(prefix, entity))
+		}
+	}
+	return keys, nil
+}
+
+// Verify checks the armored detached signature of the image against the keys
+// trusted for the image's name. It returns the key which signed the image.
+func (s *Store) Verify(name string, image, signature io.Reader) (*Key, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var keyring openpgp.EntityList
+	prefixes := map[*openpgp.Entity]string{}
+	for _, prefix := range namePrefixes(name) {
+		entities, err := s.loadKeys(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			prefixes[entity] = prefix
+		}
+		keyring = append(keyring, entities...)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no keys are trusted for image %s", name)
+	}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, image, signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the signature of image %s: %v", name, err)
+	}
+	return newKey(prefixes[signer], signer), nil
+}
+
+// loadKeys reads the keys trusted for exactly the prefix.
+func (s *Store) loadKeys(prefix string) (openpgp.EntityList, error) {
+	dir, err := s.prefixPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entities openpgp.EntityList
+	for _, fi := range files {
+		f, err := os.Open(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		el, err := openpgp.ReadArmoredKeyRing(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %v", fi.Name(), err)
+		}
+		entities = append(entities, el...)
+	}
+	return entities, nil
+}
+
+// prefixPath returns the directory holding the keys for the prefix.
+func (s *Store) prefixPath(prefix string) (string, error) {
+	if prefix == "" {
+		return filepath.Join(s.directory, rootDirectory), nil
+	}
+	if _, err := types.NewACIdentifier(prefix); err != nil {
+		return "", fmt.Errorf("invalid prefix %q: %v", prefix, err)
+	}
+	return filepath.Join(s.directory, prefixDirectory, url.QueryEscape(prefix)), nil
+}
+
+// namePrefixes returns every prefix that the image name falls under, ending at
+// a path separator, including the name itself and the empty root prefix.
+func namePrefixes(name string) []string {
+	prefixes := []string{""}
+	for i := range name {
+		if name[i] == '/' {
+			prefixes = append(prefixes, name[:i])
+		}
+	}
+	return append(prefixes, name)
+}
+
+func newKey(prefix string, entity *openpgp.Entity) *Key {
+	key := &Key{
+		Prefix:      prefix,
+		Fingerprint: fmt.Sprintf("%x", entity.PrimaryKey.Fingerprint),
+	}
+	for name := range entity.Identities {
+		key.Identities = append(key.Identities, name)
+	}
+	sort.Strings(key.Identities)
+	return key
+}
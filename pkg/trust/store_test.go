@@ -0,0 +1,108 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package trust
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	tt "github.com/apcera/util/testtool"
+)
+
+// newTestKey generates a key and returns it along with its armored public key.
+func newTestKey(t *testing.T, name string) (*openpgp.Entity, []byte) {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	tt.TestExpectSuccess(t, err)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	tt.TestExpectSuccess(t, err)
+	tt.TestExpectSuccess(t, entity.Serialize(w))
+	tt.TestExpectSuccess(t, w.Close())
+	return entity, buf.Bytes()
+}
+
+func sign(t *testing.T, entity *openpgp.Entity, data string) string {
+	var buf bytes.Buffer
+	tt.TestExpectSuccess(t, openpgp.ArmoredDetachSign(&buf, entity, strings.NewReader(data), nil))
+	return buf.String()
+}
+
+func TestStoreKeys(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	store, err := New(tt.TempDir(t))
+	tt.TestExpectSuccess(t, err)
+
+	_, rootKey := newTestKey(t, "root")
+	_, appKey := newTestKey(t, "app")
+
+	added, err := store.AddKeys("", bytes.NewReader(rootKey))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(added), 1)
+	tt.TestEqual(t, added[0].Identities, []string{"root <root@example.com>"})
+
+	added, err = store.AddKeys("example.com/app", bytes.NewReader(appKey))
+	tt.TestExpectSuccess(t, err)
+	appFingerprint := added[0].Fingerprint
+
+	_, err = store.AddKeys("Invalid Prefix", bytes.NewReader(appKey))
+	tt.TestExpectError(t, err)
+	_, err = store.AddKeys("example.com", strings.NewReader("not a key"))
+	tt.TestExpectError(t, err)
+
+	keys, err := store.Keys()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(keys), 2)
+	tt.TestEqual(t, keys[0].Prefix, "")
+	tt.TestEqual(t, keys[1].Prefix, "example.com/app")
+
+	tt.TestExpectSuccess(t, store.RemoveKey("example.com/app", appFingerprint))
+	tt.TestExpectError(t, store.RemoveKey("example.com/app", appFingerprint))
+
+	keys, err = store.Keys()
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, len(keys), 1)
+}
+
+func TestStoreVerify(t *testing.T) {
+	tt.StartTest(t)
+	defer tt.FinishTest(t)
+
+	store, err := New(tt.TempDir(t))
+	tt.TestExpectSuccess(t, err)
+
+	entity, key := newTestKey(t, "signer")
+	_, err = store.AddKeys("example.com/app", bytes.NewReader(key))
+	tt.TestExpectSuccess(t, err)
+
+	image := "image contents"
+	signature := sign(t, entity, image)
+
+	// the key is trusted for the image and those beneath it
+	signer, err := store.Verify("example.com/app", strings.NewReader(image), strings.NewReader(signature))
+	tt.TestExpectSuccess(t, err)
+	tt.TestEqual(t, signer.Prefix, "example.com/app")
+	_, err = store.Verify("example.com/app/sub", strings.NewReader(image), strings.NewReader(signature))
+	tt.TestExpectSuccess(t, err)
+
+	// but not for other images, even those sharing a partial prefix
+	_, err = store.Verify("example.com/other", strings.NewReader(image), strings.NewReader(signature))
+	tt.TestExpectError(t, err)
+	_, err = store.Verify("example.com/application", strings.NewReader(image), strings.NewReader(signature))
+	tt.TestExpectError(t, err)
+
+	// and a tampered image fails verification
+	_, err = store.Verify("example.com/app", strings.NewReader("tampered"), strings.NewReader(signature))
+	tt.TestExpectError(t, err)
+
+	// signatures by untrusted keys are rejected
+	other, _ := newTestKey(t, "other")
+	_, err = store.Verify("example.com/app", strings.NewReader(image), strings.NewReader(sign(t, other, image)))
+	tt.TestExpectError(t, err)
+}
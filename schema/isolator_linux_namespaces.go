@@ -62,6 +62,18 @@ func (n *LinuxNamespaces) AssertValid() error {
 	return nil
 }
 
+// Get returns the value for the named namespace, and whether the isolator
+// explicitly specifies it.
+func (n *LinuxNamespaces) Get(name string) (LinuxNamespaceValue, bool) {
+	val, ok := n.ns[name]
+	return val, ok
+}
+
+// Set sets the value for the named namespace.
+func (n *LinuxNamespaces) Set(name string, val LinuxNamespaceValue) {
+	n.ns[name] = val
+}
+
 func (n *LinuxNamespaces) IPC() LinuxNamespaceValue {
 	return n.ns[nsIPC]
 }
@@ -102,20 +114,13 @@ func (n *LinuxNamespaces) SetUTS(val LinuxNamespaceValue) {
 	n.ns[nsUTS] = val
 }
 
+// AsIsolator returns a types.Isolator for the namespace settings.
+//
 // The appc/spec doesn't have a method to generate a new isolator live in
 // code. You can instantiate a new one, but it its parsed interface version of
 // the object is a private field. To get one programmatically and have it be
 // usable, then we need to loop it through json.
-func GenerateHostNamespaceIsolator() (*types.Isolator, error) {
-	n := &LinuxNamespaces{
-		ns: map[string]LinuxNamespaceValue{
-			nsIPC:  LinuxNamespaceHost,
-			nsNet:  LinuxNamespaceHost,
-			nsUser: LinuxNamespaceHost,
-			nsUTS:  LinuxNamespaceHost,
-		},
-	}
-
+func (n *LinuxNamespaces) AsIsolator() (*types.Isolator, error) {
 	var interim struct {
 		Name  string              `json:"name"`
 		Value types.IsolatorValue `json:"value"`
@@ -135,3 +140,17 @@ func GenerateHostNamespaceIsolator() (*types.Isolator, error) {
 
 	return &i, nil
 }
+
+// GenerateHostNamespaceIsolator returns a namespaces isolator that requests the
+// host's namespaces for everything other than the pid namespace.
+func GenerateHostNamespaceIsolator() (*types.Isolator, error) {
+	n := &LinuxNamespaces{
+		ns: map[string]LinuxNamespaceValue{
+			nsIPC:  LinuxNamespaceHost,
+			nsNet:  LinuxNamespaceHost,
+			nsUser: LinuxNamespaceHost,
+			nsUTS:  LinuxNamespaceHost,
+		},
+	}
+	return n.AsIsolator()
+}
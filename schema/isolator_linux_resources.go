@@ -0,0 +1,80 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/appc/spec/schema/types"
+)
+
+const (
+	LinuxPidsLimitName     = "os/linux/pids-limit"
+	LinuxBlockIOWeightName = "os/linux/block-io-weight"
+
+	// The range of weights accepted by the blkio cgroup controller.
+	MinBlockIOWeight = 10
+	MaxBlockIOWeight = 1000
+)
+
+func init() {
+	types.AddIsolatorValueConstructor(LinuxPidsLimitName, newLinuxPidsLimit)
+	types.AddIsolatorValueConstructor(LinuxBlockIOWeightName, newLinuxBlockIOWeight)
+}
+
+func newLinuxPidsLimit() types.IsolatorValue {
+	return &LinuxPidsLimit{}
+}
+
+func newLinuxBlockIOWeight() types.IsolatorValue {
+	return &LinuxBlockIOWeight{}
+}
+
+// LinuxPidsLimit caps the number of processes and threads that can exist within
+// the pod or app at once.
+type LinuxPidsLimit struct {
+	Limit int64 `json:"limit"`
+}
+
+func (l *LinuxPidsLimit) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type pidsLimit LinuxPidsLimit
+	var pl pidsLimit
+	if err := json.Unmarshal(b, &pl); err != nil {
+		return err
+	}
+	*l = LinuxPidsLimit(pl)
+	return nil
+}
+
+func (l *LinuxPidsLimit) AssertValid() error {
+	if l.Limit <= 0 {
+		return fmt.Errorf("pids limit must be greater than zero")
+	}
+	return nil
+}
+
+// LinuxBlockIOWeight sets the relative share of block I/O the pod or app
+// receives when contending with others.
+type LinuxBlockIOWeight struct {
+	Weight uint16 `json:"weight"`
+}
+
+func (w *LinuxBlockIOWeight) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type blockIOWeight LinuxBlockIOWeight
+	var bw blockIOWeight
+	if err := json.Unmarshal(b, &bw); err != nil {
+		return err
+	}
+	*w = LinuxBlockIOWeight(bw)
+	return nil
+}
+
+func (w *LinuxBlockIOWeight) AssertValid() error {
+	if w.Weight < MinBlockIOWeight || w.Weight > MaxBlockIOWeight {
+		return fmt.Errorf("block I/O weight must be between %d and %d", MinBlockIOWeight, MaxBlockIOWeight)
+	}
+	return nil
+}
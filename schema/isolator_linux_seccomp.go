@@ -0,0 +1,97 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/appc/spec/schema/types"
+)
+
+const (
+	LinuxSeccompRetainSetName = "os/linux/seccomp-retain-set"
+	LinuxSeccompRemoveSetName = "os/linux/seccomp-remove-set"
+)
+
+func init() {
+	types.AddIsolatorValueConstructor(LinuxSeccompRetainSetName, newLinuxSeccompRetainSet)
+	types.AddIsolatorValueConstructor(LinuxSeccompRemoveSetName, newLinuxSeccompRemoveSet)
+}
+
+func newLinuxSeccompRetainSet() types.IsolatorValue {
+	return &LinuxSeccompRetainSet{}
+}
+
+func newLinuxSeccompRemoveSet() types.IsolatorValue {
+	return &LinuxSeccompRemoveSet{}
+}
+
+// LinuxSeccompSet is implemented by both seccomp isolators and returns the
+// syscalls they list.
+type LinuxSeccompSet interface {
+	Syscalls() []string
+	AssertValid() error
+}
+
+// LinuxSeccompRetainSet restricts the app to only the listed syscalls. Any
+// other syscall fails with EPERM.
+type LinuxSeccompRetainSet struct {
+	Set []string `json:"set"`
+}
+
+func (s *LinuxSeccompRetainSet) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type retainSet LinuxSeccompRetainSet
+	var rs retainSet
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return err
+	}
+	*s = LinuxSeccompRetainSet(rs)
+	return nil
+}
+
+func (s *LinuxSeccompRetainSet) Syscalls() []string {
+	return s.Set
+}
+
+func (s *LinuxSeccompRetainSet) AssertValid() error {
+	return assertValidSyscalls(s.Set)
+}
+
+// LinuxSeccompRemoveSet blocks the listed syscalls in addition to those blocked
+// by the default profile. Blocked syscalls fail with EPERM.
+type LinuxSeccompRemoveSet struct {
+	Set []string `json:"set"`
+}
+
+func (s *LinuxSeccompRemoveSet) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type removeSet LinuxSeccompRemoveSet
+	var rs removeSet
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return err
+	}
+	*s = LinuxSeccompRemoveSet(rs)
+	return nil
+}
+
+func (s *LinuxSeccompRemoveSet) Syscalls() []string {
+	return s.Set
+}
+
+func (s *LinuxSeccompRemoveSet) AssertValid() error {
+	return assertValidSyscalls(s.Set)
+}
+
+func assertValidSyscalls(set []string) error {
+	if len(set) == 0 {
+		return fmt.Errorf("set must be non-empty")
+	}
+	for _, name := range set {
+		if name == "" {
+			return fmt.Errorf("syscall names must not be empty")
+		}
+	}
+	return nil
+}
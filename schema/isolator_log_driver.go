@@ -0,0 +1,88 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/appc/spec/schema/types"
+)
+
+const (
+	LogDriverName = "kurma/log-driver"
+
+	LogDriverFile   = "file"
+	LogDriverSyslog = "syslog"
+	LogDriverJSON   = "json"
+)
+
+func init() {
+	types.AddIsolatorValueConstructor(LogDriverName, newLogDriver)
+}
+
+func newLogDriver() types.IsolatorValue {
+	return &LogDriver{}
+}
+
+// LogDriver is a pod isolator which selects where the output of the pod's apps
+// is sent in addition to the local log files. The address is a URL, such as
+// "udp://10.0.0.1:514" or "unix:///dev/log" for syslog, or "tcp://10.0.0.1:5000"
+// for JSON records. Note that it is reached from within the pod's network
+// namespace.
+type LogDriver struct {
+	Driver  string `json:"driver"`
+	Address string `json:"address,omitempty"`
+}
+
+func (l *LogDriver) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type logDriver LogDriver
+	var ld logDriver
+	if err := json.Unmarshal(b, &ld); err != nil {
+		return err
+	}
+	*l = LogDriver(ld)
+	return nil
+}
+
+func (l *LogDriver) AssertValid() error {
+	switch l.Driver {
+	case LogDriverFile:
+		return nil
+	case LogDriverSyslog, LogDriverJSON:
+	default:
+		return fmt.Errorf("unrecognized log driver %q", l.Driver)
+	}
+
+	network, address, err := l.Endpoint()
+	if err != nil {
+		return err
+	}
+	if l.Driver == LogDriverJSON && network != "tcp" {
+		return fmt.Errorf("the json log driver only supports tcp addresses")
+	}
+	if address == "" {
+		return fmt.Errorf("log driver address is missing a host or path")
+	}
+	return nil
+}
+
+// Endpoint returns the network and address to connect to the log collector
+// with, in the form used by net.Dial.
+func (l *LogDriver) Endpoint() (string, string, error) {
+	u, err := url.Parse(l.Address)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse log driver address: %v", err)
+	}
+	switch u.Scheme {
+	case "tcp", "udp":
+		return u.Scheme, u.Host, nil
+	case "unix":
+		// syslog daemons listen on datagram sockets
+		return "unixgram", u.Path, nil
+	default:
+		return "", "", fmt.Errorf("unsupported log driver address scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	VolumesName = "kurma/volumes"
+
+	// VolumeKindNamed is a volume which is kept in the host's volume directory
+	// and persists beyond the lifetime of the pod.
+	VolumeKindNamed = "named"
+
+	// VolumeKindTmpfs is a memory backed volume which is limited in size and
+	// discarded along with the pod.
+	VolumeKindTmpfs = "tmpfs"
+)
+
+func init() {
+	types.AddIsolatorValueConstructor(VolumesName, newVolumes)
+}
+
+func newVolumes() types.IsolatorValue {
+	return &Volumes{}
+}
+
+// Volumes is a pod isolator which supports kinds of volumes beyond the "empty"
+// and "host" kinds in the pod manifest. It maps the name of a volume in the pod
+// manifest to the kind it should use in its place. The volume must be declared
+// as an "empty" volume in the manifest, and its mode, uid, and gid are still
+// applied to it.
+type Volumes map[string]*VolumeOptions
+
+// VolumeOptions is the kind and settings for a single volume. The size only
+// applies to tmpfs volumes and is given in bytes, such as "64MiB".
+type VolumeOptions struct {
+	Kind string `json:"kind"`
+	Size string `json:"size,omitempty"`
+}
+
+func (v *Volumes) UnmarshalJSON(b []byte) error {
+	// Use an alias type so this function isn't called recursively.
+	type volumes Volumes
+	var vs volumes
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return err
+	}
+	*v = Volumes(vs)
+	return nil
+}
+
+func (v *Volumes) AssertValid() error {
+	for name, opts := range *v {
+		if _, err := types.NewACName(name); err != nil {
+			return fmt.Errorf("invalid volume name %q: %v", name, err)
+		}
+		if opts == nil {
+			return fmt.Errorf("volume %q is missing its kind", name)
+		}
+		if err := opts.assertValid(); err != nil {
+			return fmt.Errorf("volume %q %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Get returns the options for the named volume, or nil if it doesn't have any.
+func (v *Volumes) Get(name string) *VolumeOptions {
+	if v == nil {
+		return nil
+	}
+	return (*v)[name]
+}
+
+func (o *VolumeOptions) assertValid() error {
+	switch o.Kind {
+	case VolumeKindNamed:
+		if o.Size != "" {
+			return fmt.Errorf("size can only be set on %s volumes", VolumeKindTmpfs)
+		}
+		return nil
+	case VolumeKindTmpfs:
+		if o.Size == "" {
+			return fmt.Errorf("must set a size")
+		}
+		_, err := o.SizeBytes()
+		return err
+	default:
+		return fmt.Errorf("has unrecognized kind %q", o.Kind)
+	}
+}
+
+// SizeBytes returns the size limit of a tmpfs volume in bytes.
+func (o *VolumeOptions) SizeBytes() (uint64, error) {
+	size, err := humanize.ParseBytes(o.Size)
+	if err != nil {
+		return 0, fmt.Errorf("has invalid size %q: %v", o.Size, err)
+	}
+	if size == 0 {
+		return 0, fmt.Errorf("size must be greater than zero")
+	}
+	return size, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package schema
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartPolicyName is the name of the policy that determines when a pod or an
+// app within it should be restarted after exiting.
+type RestartPolicyName string
+
+const (
+	RestartNever     = RestartPolicyName("never")
+	RestartOnFailure = RestartPolicyName("on-failure")
+	RestartAlways    = RestartPolicyName("always")
+
+	defaultRestartBackoff    = time.Second
+	defaultRestartMaxBackoff = time.Minute * 5
+)
+
+// RestartPolicy defines when and how often processes should be restarted after
+// they exit. Restarts are delayed with an exponential backoff, starting at
+// Backoff and doubling on each restart up to MaxBackoff.
+type RestartPolicy struct {
+	Policy     RestartPolicyName `json:"policy"`
+	MaxRetries int               `json:"maxRetries,omitempty"`
+	Backoff    string            `json:"backoff,omitempty"`
+	MaxBackoff string            `json:"maxBackoff,omitempty"`
+}
+
+// AssertValid ensures the policy name is recognized and the backoff durations
+// can be parsed.
+func (p *RestartPolicy) AssertValid() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Policy {
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("unrecognized restart policy %q", p.Policy)
+	}
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("restart policy maxRetries must not be negative")
+	}
+	if _, err := parseBackoff(p.Backoff, defaultRestartBackoff); err != nil {
+		return fmt.Errorf("invalid restart policy backoff: %v", err)
+	}
+	if _, err := parseBackoff(p.MaxBackoff, defaultRestartMaxBackoff); err != nil {
+		return fmt.Errorf("invalid restart policy maxBackoff: %v", err)
+	}
+	return nil
+}
+
+// ShouldRestart returns whether a process that exited with the provided exit
+// code should be restarted, given how many times it has already been restarted.
+// A nil policy never restarts. MaxRetries of 0 allows unlimited restarts.
+func (p *RestartPolicy) ShouldRestart(exitCode, restarts int) bool {
+	if p == nil {
+		return false
+	}
+	if p.MaxRetries > 0 && restarts >= p.MaxRetries {
+		return false
+	}
+	switch p.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exitCode != 0
+	default:
+		return false
+	}
+}
+
+// Delay returns how long to wait before performing the next restart, given how
+// many times the process has already been restarted.
+func (p *RestartPolicy) Delay(restarts int) time.Duration {
+	if p == nil {
+		return 0
+	}
+	backoff, _ := parseBackoff(p.Backoff, defaultRestartBackoff)
+	maxBackoff, _ := parseBackoff(p.MaxBackoff, defaultRestartMaxBackoff)
+
+	delay := backoff
+	for i := 0; i < restarts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+func parseBackoff(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+	return d, nil
+}
@@ -2,6 +2,10 @@
 
 package common
 
+import (
+	"github.com/apcera/kurma/pkg/logrotate"
+)
+
 type StagerRuntimeState string
 
 const (
@@ -14,6 +18,9 @@ type StagerConfig struct {
 	RequiredNamespaces []string `json:"requiredNamespaces"`
 	DefaultNamespaces  []string `json:"defaultNamespaces"`
 	GraphStorage       string   `json:"graphStorage"`
+
+	// LogRotation configures how the app log files are rotated.
+	LogRotation logrotate.Options `json:"logRotation"`
 }
 
 type StagerState struct {
@@ -26,4 +33,5 @@ type StagerAppState struct {
 	Exited     bool   `json:"exited"`
 	ExitCode   int    `json:"exitCode,omitempty"`
 	ExitReason string `json:"exitReason,omitempty"`
+	Restarts   int    `json:"restarts,omitempty"`
 }
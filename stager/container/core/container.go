@@ -5,6 +5,7 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -18,6 +19,8 @@ import (
 	"github.com/apcera/kurma/pkg/graphstorage/overlay"
 	"github.com/apcera/kurma/stager/container/common"
 	"github.com/apcera/logray"
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
 	"github.com/opencontainers/runc/libcontainer"
 )
 
@@ -49,24 +52,29 @@ type containerSetup struct {
 	appContainers map[string]libcontainer.Container
 	appProcesses  map[string]*libcontainer.Process
 	appWaitch     map[string]chan struct{}
+	appIO         map[string]*os.File
 }
 
 // writeState is used to persist the current stager state to the state.json
 // file. This can be read by other processes calling in to the stager's exposed
-// command API to quickly access the pod state.
+// command API to quickly access the pod state. It is written to a temporary
+// file and renamed into place so readers never see a partial write.
 func (cs *containerSetup) writeState() error {
-	f, err := os.OpenFile("state.json", os.O_WRONLY|os.O_CREATE, os.FileMode(0600))
+	cs.stateMutex.Lock()
+	defer cs.stateMutex.Unlock()
+
+	f, err := os.OpenFile("/state.json.tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(0600))
 	if err != nil {
 		return fmt.Errorf("failed to open the state JSON file")
 	}
 	defer f.Close()
 
-	cs.stateMutex.Lock()
-	defer cs.stateMutex.Unlock()
-
 	if err := json.NewEncoder(f).Encode(cs.state); err != nil {
 		return fmt.Errorf("failed to write the stager state: %v", err)
 	}
+	if err := os.Rename("/state.json.tmp", "/state.json"); err != nil {
+		return fmt.Errorf("failed to write the stager state: %v", err)
+	}
 	return nil
 }
 
@@ -150,6 +158,14 @@ func (cs *containerSetup) containerFilesystem() error {
 	os.Mkdir("/init", os.FileMode(0755))
 	os.Mkdir("/logs", os.FileMode(0755))
 
+	// The init container's root needs to be owned by root within the user
+	// namespace so its mount points can be created.
+	if userns := cs.manifest.UserNamespace; userns != nil {
+		if err := os.Chown("/init", userns.HostUID, userns.HostGID); err != nil {
+			return fmt.Errorf("failed to set ownership of the init filesystem: %v", err)
+		}
+	}
+
 	var provisioner graphstorage.StorageProvisioner
 	switch cs.stagerConfig.GraphStorage {
 	case "aufs":
@@ -227,8 +243,9 @@ func (cs *containerSetup) launchInit() error {
 	}
 	cs.initContainer = container
 
-	// Open the log file
-	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE | os.O_EXCL | os.O_TRUNC
+	// Open the log file, appending to it since the logs are kept when the pod is
+	// restarted.
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
 	initlog, err := os.OpenFile("/logs/init.log", flags, os.FileMode(0666))
 	if err != nil {
 		return fmt.Errorf("failed to open init process log: %v", err)
@@ -265,7 +282,6 @@ func (cs *containerSetup) createContainers() error {
 	// Create the mount namespace for each app
 	for _, runtimeApp := range cs.manifest.Pod.Apps {
 		name := runtimeApp.Name.String()
-		app := cs.getPodApp(runtimeApp)
 
 		// create the container config
 		containerConfig, err := cs.getAppContainerConfig(runtimeApp)
@@ -281,62 +297,121 @@ func (cs *containerSetup) createContainers() error {
 		cs.appContainers[name] = container
 		cs.appMutex.Unlock()
 
-		// validate the working directory
-		workingDirectory := app.WorkingDirectory
-		if workingDirectory == "" {
-			workingDirectory = "/"
+		if err := cs.startApp(runtimeApp); err != nil {
+			return err
 		}
+	}
 
-		cs.log.Tracef("Launching application [%q:%q]: %#v", app.User, app.Group, app.Exec)
+	return nil
+}
 
-		// Open a log file that all output from the container will be written to
-		flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE | os.O_EXCL | os.O_TRUNC
-		applog, err := os.OpenFile(filepath.Join("/logs", name), flags, os.FileMode(0666))
-		if err != nil {
-			return err
-		}
-		defer applog.Close()
+// startApp launches the process for an application within its already created
+// container. It is used for the initial launch as well as when an application
+// is restarted.
+func (cs *containerSetup) startApp(runtimeApp schema.RuntimeApp) error {
+	name := runtimeApp.Name.String()
+	app := cs.getPodApp(runtimeApp)
 
-		process := &libcontainer.Process{
-			Cwd:  workingDirectory,
-			User: app.User,
-			Args: app.Exec,
-		}
-		for _, env := range app.Environment {
-			process.Env = append(process.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
-		}
+	// validate the working directory
+	workingDirectory := app.WorkingDirectory
+	if workingDirectory == "" {
+		workingDirectory = "/"
+	}
 
-		// apply inputs/outputs passed in, then apply defaults
-		cs.applyIO(name, process)
-		if process.Stdout == nil {
-			process.Stdout = applog
-		}
-		if process.Stderr == nil {
-			process.Stderr = applog
-		}
+	cs.log.Tracef("Launching application [%q:%q]: %#v", app.User, app.Group, app.Exec)
 
-		if err := container.Start(process); err != nil {
-			return fmt.Errorf("failed to launch app %q process: %v", name, err)
-		}
-		cs.appMutex.Lock()
-		cs.appProcesses[name] = process
+	// Open the app's logs. They are closed once the process exits.
+	applog, err := cs.openAppLogs(name)
+	if err != nil {
+		return err
+	}
+
+	process := &libcontainer.Process{
+		Cwd:  workingDirectory,
+		User: app.User,
+		Args: app.Exec,
+	}
+	for _, env := range app.Environment {
+		process.Env = append(process.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
+	}
+
+	// Hold the app lock while starting the process so that a shutdown can't
+	// begin between the process starting and it being tracked.
+	cs.appMutex.Lock()
+	container := cs.appContainers[name]
+	if container == nil {
 		cs.appMutex.Unlock()
+		applog.Close()
+		return fmt.Errorf("no container was found for app %q", name)
+	}
 
-		pid, err := process.Pid()
-		if err != nil {
-			return fmt.Errorf("failed to retrieve the pid of application %q: %v", name, err)
-		}
-		cs.log.Tracef("Launched app %q process, pid: %d", name, pid)
-		cs.stateMutex.Lock()
-		cs.state.Apps[name].Pid = pid
-		cs.stateMutex.Unlock()
+	// apply inputs/outputs passed in, then apply defaults
+	cs.applyIO(name, process)
+	if process.Stdout == nil {
+		process.Stdout = applog.stdout
+	}
+	if process.Stderr == nil {
+		process.Stderr = applog.stderr
+	}
+
+	if err := container.Start(process); err != nil {
+		cs.appMutex.Unlock()
+		applog.Close()
+		return fmt.Errorf("failed to launch app %q process: %v", name, err)
+	}
+	cs.appProcesses[name] = process
+	cs.appMutex.Unlock()
 
-		go cs.appWait(name, process)
+	pid, err := process.Pid()
+	if err != nil {
+		applog.Close()
+		return fmt.Errorf("failed to retrieve the pid of application %q: %v", name, err)
 	}
+	cs.log.Tracef("Launched app %q process, pid: %d", name, pid)
+	cs.stateMutex.Lock()
+	cs.state.Apps[name].Pid = pid
+	cs.stateMutex.Unlock()
 
+	go cs.appWait(name, process, applog)
 	return nil
 }
 
+// restartApp relaunches an application that has exited once the restart
+// policy's backoff has elapsed. The app's existing container is reused.
+func (cs *containerSetup) restartApp(name string, delay time.Duration) {
+	cs.log.Infof("Restarting application %q in %v", name, delay)
+	time.Sleep(delay)
+
+	if cs.isShuttingDown() {
+		return
+	}
+
+	runtimeApp := cs.manifest.Pod.Apps.Get(types.ACName(name))
+	if runtimeApp == nil {
+		cs.log.Errorf("Unable to restart application %q, it was not found in the manifest", name)
+		return
+	}
+
+	cs.stateMutex.Lock()
+	cs.state.Apps[name].Restarts++
+	cs.state.Apps[name].Exited = false
+	cs.state.Apps[name].ExitCode = 0
+	cs.state.Apps[name].ExitReason = ""
+	cs.stateMutex.Unlock()
+
+	if err := cs.startApp(*runtimeApp); err != nil {
+		cs.log.Errorf("Failed to restart application %q: %v", name, err)
+		cs.stateMutex.Lock()
+		cs.state.Apps[name].Exited = true
+		cs.state.Apps[name].ExitReason = err.Error()
+		cs.stateMutex.Unlock()
+	}
+
+	if err := cs.writeState(); err != nil {
+		cs.log.Errorf("Failed to write state file: %v", err)
+	}
+}
+
 // markRunning is used to update the state flag that indicates the pod has been
 // fully setup.
 func (cs *containerSetup) markRunning() {
@@ -470,14 +545,15 @@ func (cs *containerSetup) initWait() {
 }
 
 // appWait is used to call Wait on an app's process and update the container
-// state if the processes exits.
-func (cs *containerSetup) appWait(name string, process *libcontainer.Process) {
+// state if the processes exits. The app's log is closed once it has exited.
+func (cs *containerSetup) appWait(name string, process *libcontainer.Process, applog io.Closer) {
 	ch := make(chan struct{})
 	cs.appMutex.Lock()
 	cs.appWaitch[name] = ch
 	cs.appMutex.Unlock()
 
 	ps, err := process.Wait()
+	applog.Close()
 	close(ch)
 
 	cs.stateMutex.Lock()
@@ -489,9 +565,12 @@ func (cs *containerSetup) appWait(name string, process *libcontainer.Process) {
 	if err != nil {
 		cs.state.Apps[name].ExitReason = err.Error()
 	}
+	exitCode := cs.state.Apps[name].ExitCode
+	exitReason := cs.state.Apps[name].ExitReason
+	restarts := cs.state.Apps[name].Restarts
 	cs.stateMutex.Unlock()
 
-	cs.log.Warnf("Application %q has exited %d: %s", name, cs.state.Apps[name].ExitCode, cs.state.Apps[name].ExitReason)
+	cs.log.Warnf("Application %q has exited %d: %s", name, exitCode, exitReason)
 
 	if cs.isShuttingDown() {
 		return
@@ -500,6 +579,10 @@ func (cs *containerSetup) appWait(name string, process *libcontainer.Process) {
 	if err := cs.writeState(); err != nil {
 		cs.log.Errorf("Failed to write state file: %v", err)
 	}
+
+	if policy := cs.manifest.RestartPolicy; policy.ShouldRestart(exitCode, restarts) {
+		cs.restartApp(name, policy.Delay(restarts))
+	}
 }
 
 // stop is used to teardown the stager and its applications. Note that the
@@ -3,6 +3,7 @@
 package core
 
 import (
+	"os"
 	"runtime"
 
 	"github.com/apcera/logray"
@@ -17,6 +18,7 @@ func Run() error {
 		appContainers: make(map[string]libcontainer.Container),
 		appProcesses:  make(map[string]*libcontainer.Process),
 		appWaitch:     make(map[string]chan struct{}),
+		appIO:         make(map[string]*os.File),
 	}
 
 	if err := run(cs); err != nil {
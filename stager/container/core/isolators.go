@@ -7,16 +7,20 @@ import (
 	"syscall"
 
 	"github.com/apcera/kurma/pkg/capabilities"
+	"github.com/apcera/kurma/pkg/seccomp"
 	"github.com/appc/spec/schema/types"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
+	lseccomp "github.com/opencontainers/runc/libcontainer/seccomp"
 
 	kschema "github.com/apcera/kurma/schema"
 )
 
 var (
 	isolatorFuncs = map[string]func(*containerSetup, types.IsolatorValue, *types.App, *configs.Config) error{
-		kschema.LinuxPrivilegedName: (*containerSetup).applyPrivilegedIsolator,
+		kschema.LinuxPrivilegedName:          (*containerSetup).applyPrivilegedIsolator,
+		types.LinuxCapabilitiesRetainSetName: (*containerSetup).applyCapabilitiesRetainSet,
+		types.LinuxCapabilitiesRevokeSetName: (*containerSetup).applyCapabilitiesRemoveSet,
 	}
 )
 
@@ -62,3 +66,81 @@ func (cs *containerSetup) applyPrivilegedIsolator(iso types.IsolatorValue, app *
 	container.Devices = devices
 	return nil
 }
+
+// applyCapabilitiesRetainSet replaces the app's capabilities with only those
+// listed in the isolator.
+func (cs *containerSetup) applyCapabilitiesRetainSet(iso types.IsolatorValue, app *types.App, container *configs.Config) error {
+	set, ok := iso.(*types.LinuxCapabilitiesRetainSet)
+	if !ok {
+		return nil
+	}
+	if app.Isolators.GetByName(types.LinuxCapabilitiesRevokeSetName) != nil {
+		return fmt.Errorf("cannot be combined with the %q isolator", types.LinuxCapabilitiesRevokeSetName)
+	}
+
+	caps, err := capabilities.FromSet(set)
+	if err != nil {
+		return err
+	}
+	container.Capabilities = caps
+	return nil
+}
+
+// applyCapabilitiesRemoveSet drops the capabilities listed in the isolator from
+// the app's capabilities.
+func (cs *containerSetup) applyCapabilitiesRemoveSet(iso types.IsolatorValue, app *types.App, container *configs.Config) error {
+	set, ok := iso.(*types.LinuxCapabilitiesRevokeSet)
+	if !ok {
+		return nil
+	}
+
+	remove, err := capabilities.FromSet(set)
+	if err != nil {
+		return err
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, c := range remove {
+		removed[c] = true
+	}
+
+	caps := make([]string, 0, len(container.Capabilities))
+	for _, c := range container.Capabilities {
+		if !removed[c] {
+			caps = append(caps, c)
+		}
+	}
+	container.Capabilities = caps
+	return nil
+}
+
+// applySeccomp sets the app's seccomp filter from the default profile or its
+// seccomp isolators. Privileged apps aren't filtered unless they specify an
+// isolator. If the stager was built without seccomp support, the default
+// profile is skipped, but an app that explicitly requests filtering fails.
+func (cs *containerSetup) applySeccomp(name string, app *types.App, container *configs.Config) error {
+	privileged := false
+	if iso := app.Isolators.GetByName(kschema.LinuxPrivilegedName); iso != nil {
+		if piso, ok := iso.Value().(*kschema.LinuxPrivileged); ok {
+			privileged = bool(*piso)
+		}
+	}
+
+	profile, err := seccomp.Profile(app.Isolators, privileged)
+	if err != nil {
+		return fmt.Errorf("failed to generate seccomp profile: %v", err)
+	}
+	if profile == nil {
+		return nil
+	}
+
+	if !lseccomp.IsEnabled() {
+		if seccomp.HasIsolator(app.Isolators) {
+			return fmt.Errorf("app requested seccomp filtering, but seccomp is not supported by the stager")
+		}
+		cs.log.Warnf("Seccomp is not supported, app %q will run without a syscall filter.", name)
+		return nil
+	}
+
+	container.Seccomp = profile
+	return nil
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+func testApp(t *testing.T, isolators string) *types.App {
+	app := &types.App{}
+	if err := json.Unmarshal([]byte(isolators), &app.Isolators); err != nil {
+		t.Fatalf("failed to parse isolators: %v", err)
+	}
+	return app
+}
+
+func TestCapabilitiesRetainSet(t *testing.T) {
+	cs := &containerSetup{}
+	container := &configs.Config{Capabilities: []string{"CAP_KILL", "CAP_NET_RAW"}}
+	app := testApp(t, `[{"name": "os/linux/capabilities-retain-set", "value": {"set": ["CAP_NET_ADMIN", "CAP_KILL"]}}]`)
+
+	if err := cs.applyIsolators(app, container); err != nil {
+		t.Fatalf("expected no error applying isolators, got %v", err)
+	}
+	if !reflect.DeepEqual(container.Capabilities, []string{"CAP_NET_ADMIN", "CAP_KILL"}) {
+		t.Fatalf("unexpected capabilities: %v", container.Capabilities)
+	}
+}
+
+func TestCapabilitiesRemoveSet(t *testing.T) {
+	cs := &containerSetup{}
+	container := &configs.Config{Capabilities: []string{"CAP_KILL", "CAP_NET_RAW", "CAP_CHOWN"}}
+	app := testApp(t, `[{"name": "os/linux/capabilities-remove-set", "value": {"set": ["CAP_NET_RAW"]}}]`)
+
+	if err := cs.applyIsolators(app, container); err != nil {
+		t.Fatalf("expected no error applying isolators, got %v", err)
+	}
+	if !reflect.DeepEqual(container.Capabilities, []string{"CAP_KILL", "CAP_CHOWN"}) {
+		t.Fatalf("unexpected capabilities: %v", container.Capabilities)
+	}
+}
+
+func TestCapabilitiesInvalid(t *testing.T) {
+	cs := &containerSetup{}
+
+	app := testApp(t, `[{"name": "os/linux/capabilities-remove-set", "value": {"set": ["CAP_BOGUS"]}}]`)
+	if err := cs.applyIsolators(app, &configs.Config{}); err == nil {
+		t.Fatalf("expected an error with an unrecognized capability")
+	}
+
+	app = testApp(t, `[
+		{"name": "os/linux/capabilities-retain-set", "value": {"set": ["CAP_KILL"]}},
+		{"name": "os/linux/capabilities-remove-set", "value": {"set": ["CAP_NET_RAW"]}}
+	]`)
+	if err := cs.applyIsolators(app, &configs.Config{}); err == nil {
+		t.Fatalf("expected an error when combining the retain and remove sets")
+	}
+}
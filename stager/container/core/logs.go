@@ -0,0 +1,98 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+package core
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/apcera/kurma/pkg/logdriver"
+	"github.com/apcera/kurma/pkg/logrotate"
+	"github.com/appc/spec/schema"
+
+	kschema "github.com/apcera/kurma/schema"
+)
+
+// appLogs holds the writers an app's output is sent to. Output always goes to
+// the app's local log file, and is also forwarded to a remote collector when a
+// log driver is configured for the pod.
+type appLogs struct {
+	stdout  io.Writer
+	stderr  io.Writer
+	closers []io.Closer
+}
+
+// Close closes all of the app's log writers.
+func (l *appLogs) Close() error {
+	var err error
+	for _, c := range l.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// openAppLogs opens the writers for an app's output.
+func (cs *containerSetup) openAppLogs(name string) (*appLogs, error) {
+	// Open a log file that all output from the container will be written to. It
+	// is appended to so output is retained across restarts, and is rotated once
+	// it reaches the configured size.
+	applog, err := logrotate.NewWriter(filepath.Join("/logs", name), cs.stagerConfig.LogRotation)
+	if err != nil {
+		return nil, err
+	}
+	logs := &appLogs{
+		stdout:  applog,
+		stderr:  applog,
+		closers: []io.Closer{applog},
+	}
+
+	config := getLogDriverIsolator(cs.manifest.Pod)
+	if config == nil {
+		return logs, nil
+	}
+
+	tags := logdriver.Tags{
+		PodUUID: cs.manifest.UUID,
+		PodName: cs.manifest.Name,
+		AppName: name,
+	}
+
+	tags.Stream = logdriver.StreamStdout
+	stdout, err := logdriver.New(config, tags)
+	if err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("failed to configure log driver: %v", err)
+	}
+	tags.Stream = logdriver.StreamStderr
+	stderr, err := logdriver.New(config, tags)
+	if err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("failed to configure log driver: %v", err)
+	}
+
+	if stdout != nil {
+		logs.stdout = io.MultiWriter(applog, stdout)
+		logs.closers = append(logs.closers, stdout)
+	}
+	if stderr != nil {
+		logs.stderr = io.MultiWriter(applog, stderr)
+		logs.closers = append(logs.closers, stderr)
+	}
+	return logs, nil
+}
+
+// getLogDriverIsolator checks the pod manifest to see if a log driver isolator
+// is specified. If not, it will simply return nil.
+func getLogDriverIsolator(pod *schema.PodManifest) *kschema.LogDriver {
+	for _, iso := range pod.Isolators {
+		if iso.Name.String() == kschema.LogDriverName {
+			if liso, ok := iso.Value().(*kschema.LogDriver); ok {
+				return liso
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Apcera Inc. All rights reserved.
+
+// +build linux,cgo,seccomp
+
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	lseccomp "github.com/opencontainers/runc/libcontainer/seccomp"
+)
+
+// These tests only run when built with the seccomp tag, as the stager is for
+// its ACI. They ensure the stager is actually able to filter syscalls.
+
+const seccompChildEnv = "KURMA_TEST_SECCOMP_CHILD"
+
+func init() {
+	if os.Getenv(seccompChildEnv) != "1" {
+		return
+	}
+
+	// Load a filter blocking getppid on this thread, then ensure the call is
+	// refused with EPERM.
+	runtime.LockOSThread()
+	app := &types.App{}
+	if err := json.Unmarshal([]byte(`[{"name": "os/linux/seccomp-remove-set", "value": {"set": ["getppid"]}}]`), &app.Isolators); err != nil {
+		os.Exit(2)
+	}
+	container := &configs.Config{}
+	if err := (&containerSetup{}).applySeccomp("test", app, container); err != nil {
+		os.Exit(2)
+	}
+	if err := lseccomp.InitSeccomp(container.Seccomp); err != nil {
+		os.Exit(3)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_GETPPID, 0, 0, 0); errno != syscall.EPERM {
+		os.Exit(4)
+	}
+	os.Exit(0)
+}
+
+func TestSeccompEnabled(t *testing.T) {
+	if !lseccomp.IsEnabled() {
+		t.Fatalf("expected seccomp to be enabled in a build with the seccomp tag")
+	}
+
+	cs := &containerSetup{}
+	container := &configs.Config{}
+	if err := cs.applySeccomp("test", testApp(t, `[]`), container); err != nil {
+		t.Fatalf("expected no error applying the default profile, got %v", err)
+	}
+	if container.Seccomp == nil {
+		t.Fatalf("expected the default profile to be applied")
+	}
+}
+
+func TestSeccompFilter(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), seccompChildEnv+"=1")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("expected the filter to block getppid, got %v", err)
+	}
+}
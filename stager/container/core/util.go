@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"syscall"
 
+	"github.com/apcera/kurma/pkg/resources"
 	"github.com/apcera/kurma/stager/container/common"
 	"github.com/appc/spec/schema"
 	"github.com/appc/spec/schema/types"
@@ -119,6 +120,9 @@ func (cs *containerSetup) getInitContainerConfig() (*configs.Config, error) {
 		cs.applyNamespacesIsolator(config, nsiso)
 	}
 
+	// The init process creates the pod's user namespace, if it has one.
+	cs.applyUserNamespace(config, "")
+
 	return config, nil
 }
 
@@ -180,6 +184,9 @@ func (cs *containerSetup) getAppContainerConfig(runtimeApp schema.RuntimeApp) (*
 		Mounts:  defaultContainerMounts,
 	}
 
+	// Join the user namespace created by the init process.
+	cs.applyUserNamespace(config, fmt.Sprintf("/proc/%d/ns/user", initPid))
+
 	app := cs.getPodApp(runtimeApp)
 
 	// apply isolators to the pod
@@ -187,6 +194,16 @@ func (cs *containerSetup) getAppContainerConfig(runtimeApp schema.RuntimeApp) (*
 		return nil, err
 	}
 
+	// filter the syscalls the app may use
+	if err := cs.applySeccomp(name, app, config); err != nil {
+		return nil, err
+	}
+
+	// apply the app's cpu and memory limits to its cgroup
+	if err := resources.Apply(app.Isolators, config.Cgroups.Resources); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -237,6 +254,38 @@ func (cs *containerSetup) applyNamespacesIsolator(config *configs.Config, nsiso
 	}
 }
 
+// applyUserNamespace configures the container to run within the pod's user
+// namespace when the manifest specifies one. An empty path creates the
+// namespace, otherwise the namespace at the path is joined.
+func (cs *containerSetup) applyUserNamespace(config *configs.Config, path string) {
+	userns := cs.manifest.UserNamespace
+	if userns == nil {
+		return
+	}
+
+	config.Namespaces.Add(configs.NEWUSER, path)
+	config.UidMappings = []configs.IDMap{{ContainerID: 0, HostID: userns.HostUID, Size: userns.Size}}
+	config.GidMappings = []configs.IDMap{{ContainerID: 0, HostID: userns.HostGID, Size: userns.Size}}
+
+	// sysfs can only be mounted by the user namespace that owns the network
+	// namespace, which is the host's since the network namespace is created
+	// by kurma. Bind mount the host's instead, keeping the flags that are
+	// locked on it.
+	mounts := make([]*configs.Mount, len(config.Mounts))
+	for i, m := range config.Mounts {
+		if m.Device == "sysfs" {
+			m = &configs.Mount{
+				Source:      "/sys",
+				Destination: m.Destination,
+				Device:      "bind",
+				Flags:       syscall.MS_BIND | syscall.MS_REC | syscall.MS_RDONLY | defaultMountFlags,
+			}
+		}
+		mounts[i] = m
+	}
+	config.Mounts = mounts
+}
+
 // applyDefaultNamespaces adds the default namespace configuration settings for
 // a pod.
 func (cs *containerSetup) applyDefaultNamespaces(config *configs.Config) {
@@ -246,19 +295,31 @@ func (cs *containerSetup) applyDefaultNamespaces(config *configs.Config) {
 }
 
 // applyIO is used to check if any inputs/outputs were provided with the stager
-// for the given app.
+// for the given app. The files are cached so the same file is handed to the app
+// when it is restarted, rather than a second file for the same descriptor. The
+// appMutex must be held when calling it.
 func (cs *containerSetup) applyIO(appname string, process *libcontainer.Process) {
-	if f := checkSpecificIO(appname, "STDIN"); f != nil {
+	if f := cs.specificIO(appname, "STDIN"); f != nil {
 		process.Stdin = f
 	}
-	if f := checkSpecificIO(appname, "STDOUT"); f != nil {
+	if f := cs.specificIO(appname, "STDOUT"); f != nil {
 		process.Stdout = f
 	}
-	if f := checkSpecificIO(appname, "STDERR"); f != nil {
+	if f := cs.specificIO(appname, "STDERR"); f != nil {
 		process.Stderr = f
 	}
 }
 
+func (cs *containerSetup) specificIO(appname, which string) *os.File {
+	key := fmt.Sprintf(io_env_format, appname, which)
+	if f, exists := cs.appIO[key]; exists {
+		return f
+	}
+	f := checkSpecificIO(appname, which)
+	cs.appIO[key] = f
+	return f
+}
+
 const io_env_format = "STAGER_CONTAINER_%s_%s"
 
 func checkSpecificIO(appname, which string) *os.File {